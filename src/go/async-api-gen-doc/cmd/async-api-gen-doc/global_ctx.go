@@ -2,12 +2,9 @@ package asyncapigendoc
 
 import (
 	"context"
-	"os"
 
-	"github.com/dnitsch/async-api-generator/internal/fshelper"
 	"github.com/dnitsch/async-api-generator/internal/generate"
 	"github.com/dnitsch/async-api-generator/internal/storage"
-	log "github.com/dnitsch/simplelog"
 	"github.com/spf13/cobra"
 )
 
@@ -30,46 +27,23 @@ func init() {
 }
 
 func globalCtxExecute(cmd *cobra.Command, args []string) error {
-
-	if verbose {
-		logger = log.New(os.Stdout, log.DebugLvl)
-	}
-
-	conf, cleanUp, err := config(inputLocationStorageConfig)
-	if err != nil {
-		return err
-	}
-	defer cleanUp()
-	logger.Debugf("interim output: %s", conf.InterimOutputDir)
-	logger.Debugf("download output: %s", conf.DownloadDir)
-
 	ctx, cancel := context.WithCancel(cmd.Context())
 	defer cancel()
 
-	if err := fetchPrep(ctx, conf, inputLocationStorageConfig); err != nil {
-		return err
-	}
-
-	files, err := fshelper.ListFiles(conf.DownloadDir)
+	g, cleanUp, err := interimGenerate(ctx)
 	if err != nil {
 		return err
 	}
-
-	g := generate.New(conf, logger)
-
-	g.LoadInputsFromFiles(files)
-
-	if err := g.ConvertProcessed(); err != nil {
-		return err
-	}
-
-	if err := g.BuildContextTree(); err != nil {
-		return err
-	}
+	defer cleanUp()
 
 	if err := g.AsyncAPIFromProcessedTree(); err != nil {
 		return err
 	}
+	if warnings := append(g.Conflicts(), g.CombinedOperations()...); len(warnings) > 0 {
+		if err := warnings.Render(cmd.ErrOrStderr()); err != nil {
+			return err
+		}
+	}
 	return uploadPrep(ctx, g, outputStorageConfig)
 }
 
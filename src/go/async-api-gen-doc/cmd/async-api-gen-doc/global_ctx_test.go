@@ -2,15 +2,18 @@ package asyncapigendoc_test
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"io"
 	"io/fs"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 
 	asyncapigendoc "github.com/dnitsch/async-api-generator/cmd/async-api-gen-doc"
 	"github.com/dnitsch/async-api-generator/internal/fshelper"
+	"github.com/dnitsch/async-api-generator/internal/generate"
 )
 
 func Test_global_Analyis_runs_ok(t *testing.T) {
@@ -58,15 +61,29 @@ func Test_global_Analyis_runs_ok(t *testing.T) {
 			"--output", output})
 
 		cmd.SetErr(b)
-		cmd.Execute()
+		if err := cmd.Execute(); err != nil {
+			t.Fatal(err)
+		}
 
 		rb, err := io.ReadAll(b)
 		if err != nil {
 			t.Fatal(err)
 		}
 
-		if len(rb) > 0 {
-			t.Fatalf("expected error output buffer to be empty\ngot: %v\nwanted 0", string(rb))
+		// both sample services describe themselves in two places,
+		// the conflicts of their info.description are the only diagnostics
+		conflicts := 0
+		for _, line := range strings.Split(string(rb), "\n") {
+			if strings.Contains(line, " warning GD035: info.description ") {
+				conflicts++
+				continue
+			}
+			if strings.Contains(line, " error ") || strings.Contains(line, " warning ") {
+				t.Fatalf("expected only merge conflict warnings in the error output\ngot: %v", string(rb))
+			}
+		}
+		if conflicts != 2 {
+			t.Fatalf("got %d merge conflict warnings, wanted 2\ngot: %v", conflicts, string(rb))
 		}
 		found := []string{}
 		filepath.WalkDir(out, func(path string, d fs.DirEntry, err error) error {
@@ -77,4 +94,77 @@ func Test_global_Analyis_runs_ok(t *testing.T) {
 			t.Fatal("no processed files were emitted")
 		}
 	})
+
+	t.Run("conflicts fail with the error merge policy", func(t *testing.T) {
+		out := t.TempDir()
+		cmd := asyncapigendoc.AsyncAPIGenCmd
+		t.Cleanup(func() {
+			_ = cmd.PersistentFlags().Set("merge-policy", "last-wins")
+		})
+
+		cmd.SetArgs([]string{"global-context", "-i",
+			fmt.Sprintf("local://%s", fshelper.DebugDirHelper(t, "test/interim-generated", "cmd/async-api-gen-doc", "../../")),
+			"--merge-policy", "error",
+			"--output", fmt.Sprintf("local://%s", out)})
+		cmd.SetErr(new(bytes.Buffer))
+
+		err := cmd.Execute()
+		if !errors.Is(err, generate.ErrMergeConflict) {
+			t.Fatalf("got %v, wanted %v", err, generate.ErrMergeConflict)
+		}
+	})
+
+	t.Run("unknown asyncapi version", func(t *testing.T) {
+		cmd := asyncapigendoc.AsyncAPIGenCmd
+		t.Cleanup(func() {
+			_ = cmd.PersistentFlags().Set("asyncapi-version", "2.6")
+		})
+
+		cmd.SetArgs([]string{"global-context", "-i",
+			fmt.Sprintf("local://%s", fshelper.DebugDirHelper(t, "test/interim-generated", "cmd/async-api-gen-doc", "../../")),
+			"--asyncapi-version", "2.5",
+			"--output", fmt.Sprintf("local://%s", t.TempDir())})
+		cmd.SetErr(new(bytes.Buffer))
+
+		err := cmd.Execute()
+		if !errors.Is(err, generate.ErrUnknownAsyncAPIVersion) {
+			t.Fatalf("got %v, wanted %v", err, generate.ErrUnknownAsyncAPIVersion)
+		}
+	})
+
+	t.Run("unknown format", func(t *testing.T) {
+		cmd := asyncapigendoc.AsyncAPIGenCmd
+		t.Cleanup(func() {
+			_ = cmd.PersistentFlags().Set("format", "yaml")
+		})
+
+		cmd.SetArgs([]string{"global-context", "-i",
+			fmt.Sprintf("local://%s", fshelper.DebugDirHelper(t, "test/interim-generated", "cmd/async-api-gen-doc", "../../")),
+			"--format", "toml",
+			"--output", fmt.Sprintf("local://%s", t.TempDir())})
+		cmd.SetErr(new(bytes.Buffer))
+
+		err := cmd.Execute()
+		if !errors.Is(err, generate.ErrUnknownFormat) {
+			t.Fatalf("got %v, wanted %v", err, generate.ErrUnknownFormat)
+		}
+	})
+
+	t.Run("unknown template", func(t *testing.T) {
+		cmd := asyncapigendoc.AsyncAPIGenCmd
+		t.Cleanup(func() {
+			_ = cmd.PersistentFlags().Set("template", "")
+		})
+
+		cmd.SetArgs([]string{"global-context", "-i",
+			fmt.Sprintf("local://%s", fshelper.DebugDirHelper(t, "test/interim-generated", "cmd/async-api-gen-doc", "../../")),
+			"--template", "missing.md",
+			"--output", fmt.Sprintf("local://%s", t.TempDir())})
+		cmd.SetErr(new(bytes.Buffer))
+
+		err := cmd.Execute()
+		if !errors.Is(err, generate.ErrTemplateNotFound) {
+			t.Fatalf("got %v, wanted %v", err, generate.ErrTemplateNotFound)
+		}
+	})
 }
@@ -0,0 +1,59 @@
+package asyncapigendoc
+
+import (
+	"github.com/dnitsch/async-api-generator/internal/lint"
+	"github.com/spf13/cobra"
+)
+
+var (
+	lintConfig string
+	lintCmd    = &cobra.Command{
+		Use:   "lint",
+		Short: `Checks the annotations in a single repo source against the lint rules`,
+		Long: `Checks the annotations in a single repo source against the lint rules, nothing is emitted.
+The rules run over the context tree and the AsyncAPI constructed for each service.
+Rules can be enabled, disabled and given a severity per repo via --lint-config, any finding with an error severity fails the command.`,
+		RunE: lintExecute,
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			if err := validateReportFlags(); err != nil {
+				return err
+			}
+			return setStorageLocation(inputLocation, outputLocation)
+		},
+	}
+)
+
+func init() {
+	lintCmd.PersistentFlags().StringVarP(&lintConfig, "lint-config", "", "", `Path to a YAML file enabling, disabling and setting the severity of the lint rules, defaults to all the built-in rules as warnings`)
+	lintCmd.PersistentFlags().BoolVarP(&isService, "is-service", "s", false, `whether the repo is a service repo`)
+	lintCmd.PersistentFlags().StringVarP(&envFile, "env-file", "", "", `Path to a dotenv style file with KEY=value variables used to expand the content, these override the process environment`)
+	addReportFlags(lintCmd)
+	AsyncAPIGenCmd.AddCommand(lintCmd)
+}
+
+func lintExecute(cmd *cobra.Command, args []string) error {
+	conf := lint.DefaultConfig()
+	if lintConfig != "" {
+		lc, err := lint.LoadConfig(lintConfig)
+		if err != nil {
+			return err
+		}
+		conf = lc
+	}
+
+	g, cleanUp, err := inMemoryGenerate()
+	if err != nil {
+		return err
+	}
+	defer cleanUp()
+
+	diags, err := buildTree(g)
+	if err != nil || diags.HasErrors() {
+		return reportDiagnostics(cmd, diags, err, lint.ErrLint)
+	}
+	services, err := g.Services()
+	if err != nil {
+		return err
+	}
+	return reportDiagnostics(cmd, lint.Run(services, conf), nil, lint.ErrLint)
+}
@@ -0,0 +1,60 @@
+package asyncapigendoc_test
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	asyncapigendoc "github.com/dnitsch/async-api-generator/cmd/async-api-gen-doc"
+	"github.com/dnitsch/async-api-generator/internal/fshelper"
+)
+
+func Test_lint(t *testing.T) {
+	input := fmt.Sprintf("local://%s", fshelper.DebugDirHelper(t, "test/foo.sample", "cmd/async-api-gen-doc", "../../"))
+	strict := filepath.Join(t.TempDir(), "lint.yml")
+	if err := os.WriteFile(strict, []byte("rules:\n  service-title:\n    severity: error\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	ttests := map[string]struct {
+		flags  []string
+		expErr string
+	}{
+		"default rules warn only": {
+			flags: []string{"--is-service"},
+		},
+		"rule configured as error fails": {
+			flags:  []string{"--is-service", "--lint-config", strict},
+			expErr: "GD101",
+		},
+	}
+	for name, tt := range ttests {
+		t.Run(name, func(t *testing.T) {
+			cmd := asyncapigendoc.AsyncAPIGenCmd
+			t.Cleanup(func() {
+				sc, _, _ := cmd.Find([]string{"lint"})
+				_ = sc.PersistentFlags().Set("is-service", "false")
+				_ = sc.PersistentFlags().Set("lint-config", "")
+			})
+			stderr := new(bytes.Buffer)
+			cmd.SetArgs(append([]string{"lint", "-i", input}, tt.flags...))
+			cmd.SetErr(stderr)
+			err := cmd.Execute()
+			if tt.expErr == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !strings.Contains(stderr.String(), "GD101") {
+					t.Errorf("expected the missing title warning\n%s", stderr.String())
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.expErr) {
+				t.Fatalf("got error %v, wanted %s", err, tt.expErr)
+			}
+		})
+	}
+}
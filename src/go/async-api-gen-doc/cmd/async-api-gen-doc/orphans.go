@@ -0,0 +1,115 @@
+package asyncapigendoc
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/dnitsch/async-api-generator/internal/diag"
+	"github.com/dnitsch/async-api-generator/internal/fshelper"
+	"github.com/dnitsch/async-api-generator/internal/generate"
+	"github.com/dnitsch/async-api-generator/internal/parser"
+	log "github.com/dnitsch/simplelog"
+	"github.com/spf13/cobra"
+)
+
+var (
+	interim    bool
+	orphansCmd = &cobra.Command{
+		Use:   "orphans",
+		Short: `Lists the blocks which failed to attach to the context tree and why`,
+		Long: `Lists the blocks which failed to attach to the context tree and why, nothing is emitted.
+Each orphan is reported at its source file and line with the parent id and category it was looking for
+and the closest existing ids of that category in the tree.
+Reads a single repo source by default, or the interim states of many repos with --interim.`,
+		RunE: orphansExecute,
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			if err := validateReportFlags(); err != nil {
+				return err
+			}
+			return setStorageLocation(inputLocation, outputLocation)
+		},
+	}
+)
+
+func init() {
+	orphansCmd.PersistentFlags().BoolVarP(&interim, "interim", "", false, `whether the input holds the interim states generated by single-context, i.e. the global-context input`)
+	orphansCmd.PersistentFlags().BoolVarP(&isService, "is-service", "s", false, `whether the repo is a service repo`)
+	orphansCmd.PersistentFlags().StringVarP(&envFile, "env-file", "", "", `Path to a dotenv style file with KEY=value variables used to expand the content, these override the process environment`)
+	addReportFlags(orphansCmd)
+	AsyncAPIGenCmd.AddCommand(orphansCmd)
+}
+
+func orphansExecute(cmd *cobra.Command, args []string) error {
+	var g *generate.Generate
+	if interim {
+		ig, cleanUp, err := interimGenerate(cmd.Context())
+		if err != nil {
+			return err
+		}
+		defer cleanUp()
+		g = ig
+	} else {
+		sg, cleanUp, err := inMemoryGenerate()
+		if err != nil {
+			return err
+		}
+		defer cleanUp()
+		diags, err := buildTree(sg)
+		if err != nil || diags.HasErrors() {
+			return reportDiagnostics(cmd, diags, err, generate.ErrValidation)
+		}
+		g = sg
+	}
+
+	diags := diag.Diagnostics{}
+	for _, orphan := range g.Orphans() {
+		diags = append(diags, orphan.Diagnostic())
+	}
+	if err := writeReport(diags, inputLocationStorageConfig.Destination, cmd.OutOrStdout()); err != nil {
+		return err
+	}
+	if len(diags) == 0 {
+		fmt.Fprintln(cmd.ErrOrStderr(), "no orphans")
+		return nil
+	}
+	return diags.Render(cmd.ErrOrStderr())
+}
+
+// interimGenerate fetches the interim states from the input and builds the context tree across them
+func interimGenerate(ctx context.Context) (*generate.Generate, func(), error) {
+	if verbose {
+		logger = log.New(os.Stdout, log.DebugLvl)
+	}
+
+	conf, cleanUp, err := config(inputLocationStorageConfig, parser.AllRepo)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	logger.Debugf("interim output: %s", conf.InterimOutputDir)
+	logger.Debugf("download output: %s", conf.DownloadDir)
+
+	if err := fetchPrep(ctx, conf, inputLocationStorageConfig); err != nil {
+		cleanUp()
+		return nil, nil, err
+	}
+
+	files, err := fshelper.ListFiles(conf.DownloadDir)
+	if err != nil {
+		cleanUp()
+		return nil, nil, err
+	}
+
+	g := generate.New(conf, logger)
+	g.LoadInputsFromFiles(files)
+	if err := g.ConvertProcessed(); err != nil {
+		cleanUp()
+		return nil, nil, err
+	}
+	if err := g.BuildContextTree(); err != nil {
+		cleanUp()
+		return nil, nil, err
+	}
+	return g, cleanUp, nil
+}
@@ -0,0 +1,56 @@
+package asyncapigendoc_test
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+
+	asyncapigendoc "github.com/dnitsch/async-api-generator/cmd/async-api-gen-doc"
+	"github.com/dnitsch/async-api-generator/internal/fshelper"
+)
+
+func Test_orphans(t *testing.T) {
+	ttests := map[string]struct {
+		baseDir string
+		flags   []string
+		expect  []string
+	}{
+		"source": {
+			baseDir: "test/foo.sample",
+			flags:   []string{"--is-service"},
+			expect: []string{
+				"someeventpoco.cs",
+				"4:1 warning GD032: pubOperation 'BuxQuz' is orphaned, looking for channel 'foo-stuff~operation-cancelled-domain-event': parent is documented but is itself orphaned",
+				"message 'some' is orphaned, looking for operation 'some': parent is not documented",
+			},
+		},
+		"interim": {
+			baseDir: "test/interim-generated",
+			flags:   []string{"--interim"},
+			expect:  []string{"message 'InitialOrphanEvent' is orphaned, looking for operation 'EventDefinedInOtherSrc'"},
+		},
+	}
+	for name, tt := range ttests {
+		t.Run(name, func(t *testing.T) {
+			cmd := asyncapigendoc.AsyncAPIGenCmd
+			t.Cleanup(func() {
+				sc, _, _ := cmd.Find([]string{"orphans"})
+				_ = sc.PersistentFlags().Set("is-service", "false")
+				_ = sc.PersistentFlags().Set("interim", "false")
+			})
+			input := fmt.Sprintf("local://%s", fshelper.DebugDirHelper(t, tt.baseDir, "cmd/async-api-gen-doc", "../../"))
+			stderr := new(bytes.Buffer)
+			cmd.SetArgs(append([]string{"orphans", "-i", input}, tt.flags...))
+			cmd.SetErr(stderr)
+			if err := cmd.Execute(); err != nil {
+				t.Fatal(err)
+			}
+			for _, want := range tt.expect {
+				if !strings.Contains(stderr.String(), want) {
+					t.Errorf("orphans missing %s\n%s", want, stderr.String())
+				}
+			}
+		})
+	}
+}
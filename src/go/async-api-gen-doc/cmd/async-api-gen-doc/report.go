@@ -0,0 +1,56 @@
+package asyncapigendoc
+
+import (
+	"errors"
+	"io"
+	"os"
+
+	"github.com/dnitsch/async-api-generator/internal/diag"
+	"github.com/spf13/cobra"
+)
+
+var (
+	reportFormat string
+	reportFile   string
+)
+
+func addReportFlags(cmd *cobra.Command) {
+	cmd.PersistentFlags().StringVarP(&reportFormat, "report-format", "", "", `Write all the diagnostics in a machine readable format for CI [sarif, json, junit]`)
+	cmd.PersistentFlags().StringVarP(&reportFile, "report-file", "", "", `Path the --report-format report is written to, defaults to stdout`)
+}
+
+// validateReportFlags fails early on an unknown --report-format
+func validateReportFlags() error {
+	if reportFormat == "" {
+		return nil
+	}
+	_, err := diag.ParseReportFormat(reportFormat)
+	return err
+}
+
+// writeReport writes the diagnostics found in err in the --report-format
+//
+// A clean run writes an empty report, the report is written to stdout when --report-file is not set.
+func writeReport(err error, baseDir string, stdout io.Writer) error {
+	if reportFormat == "" {
+		return nil
+	}
+	format, ferr := diag.ParseReportFormat(reportFormat)
+	if ferr != nil {
+		return ferr
+	}
+	diags := diag.Diagnostics{}
+	if !errors.As(err, &diags) {
+		diags = diag.Collect(err)
+	}
+	w := stdout
+	if reportFile != "" {
+		f, err := os.Create(reportFile)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+	return diag.Report{Tool: AsyncAPIGenCmd.Name(), Version: Version, BaseDir: baseDir}.Write(w, format, diags)
+}
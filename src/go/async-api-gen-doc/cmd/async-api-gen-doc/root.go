@@ -7,6 +7,7 @@ import (
 	"path/filepath"
 
 	"github.com/dnitsch/async-api-generator/internal/generate"
+	"github.com/dnitsch/async-api-generator/internal/lexer"
 	"github.com/dnitsch/async-api-generator/internal/parser"
 	"github.com/dnitsch/async-api-generator/internal/storage"
 	log "github.com/dnitsch/simplelog"
@@ -30,6 +31,13 @@ var (
 	dryRun         bool
 	outputLocation string
 	inputLocation  string
+	lexerConfig    string
+	strict         bool
+	mergePolicy    string
+	asyncAPIVer    string
+	format         string
+	templateDir    string
+	templateName   string
 )
 
 var AsyncAPIGenCmd = &cobra.Command{
@@ -58,26 +66,62 @@ func init() {
 	AsyncAPIGenCmd.PersistentFlags().StringVarP(&inputLocation, "input", "i", "local://.", `Path to start the search in, Must include the protocol - see output for options`)
 	AsyncAPIGenCmd.PersistentFlags().BoolVarP(&verbose, "verbose", "v", false, "Verbose output")
 	AsyncAPIGenCmd.PersistentFlags().BoolVarP(&dryRun, "dry-run", "", false, "Dry run only runs in validate mode and does not emit anything")
+	AsyncAPIGenCmd.PersistentFlags().BoolVarP(&strict, "strict", "", false, `Unknown annotation keys are errors instead of being skipped`)
+	AsyncAPIGenCmd.PersistentFlags().StringVarP(&mergePolicy, "merge-policy", "", string(generate.MergeLastWins), `How a field documented with conflicting values is merged [error, first-wins, last-wins, concatenate, prefer-owner]`)
+	AsyncAPIGenCmd.PersistentFlags().StringVarP(&asyncAPIVer, "asyncapi-version", "", string(generate.AsyncAPI2), `Version of the emitted AsyncAPI documents [2.6, 3.0]`)
+	AsyncAPIGenCmd.PersistentFlags().StringVarP(&format, "format", "", string(generate.FormatYAML), `Format of the emitted AsyncAPI documents [yaml, json]`)
+	AsyncAPIGenCmd.PersistentFlags().StringVarP(&templateDir, "template-dir", "", "", `Directory of templates overriding or added to the built-in templates, the documents are rendered with the templates instead of marshalled in the format`)
+	AsyncAPIGenCmd.PersistentFlags().StringVarP(&templateName, "template", "", "", `Name of the template the documents are rendered with, defaults to the built-in template of the asyncapi-version`)
+	AsyncAPIGenCmd.PersistentFlags().StringVarP(&lexerConfig, "lexer-config", "", "", `Path to a YAML file setting the marker keyword and the comment syntaxes per file glob, defaults to the built-in gendoc markers`)
 }
 
 // config bootstraps pflags into useable config
 //
 // TODO: use viper
-func config(outConf *storage.Conf) (*generate.Config, func(), error) {
+func config(outConf *storage.Conf, mode parser.AnalysisMode) (*generate.Config, func(), error) {
 	dirName := filepath.Base(outConf.Destination)
 
 	conf := &generate.Config{
-		ParserConfig:  parser.Config{ServiceRepoUrl: repoUrl, BusinessDomain: businessDomain, BoundedDomain: boundedCtxDomain, ServiceLanguage: repoLang},
+		ParserConfig:  parser.Config{ServiceRepoUrl: repoUrl, BusinessDomain: businessDomain, BoundedDomain: boundedCtxDomain, ServiceLanguage: repoLang, Strict: strict},
 		SearchDirName: dirName,
+		Mode:          mode,
 		Output:        outConf,
 	}
+	policy, err := generate.ParseMergePolicy(mergePolicy)
+	if err != nil {
+		return nil, nil, err
+	}
+	conf.MergePolicy = policy
+
+	version, err := generate.ParseAsyncAPIVersion(asyncAPIVer)
+	if err != nil {
+		return nil, nil, err
+	}
+	conf.AsyncAPIVersion = version
+
+	docFormat, err := generate.ParseFormat(format)
+	if err != nil {
+		return nil, nil, err
+	}
+	conf.Format = docFormat
+	conf.TemplateDir = templateDir
+	conf.Template = templateName
+
+	if lexerConfig != "" {
+		lc, err := lexer.LoadConfig(lexerConfig)
+		if err != nil {
+			return nil, nil, err
+		}
+		conf.LexerConfig = lc
+	}
+
 	if isService {
 		// use the current search dir name as the serviceId
 		// this allows certain objects to __not__ have parentId or id specified
 		conf.ParserConfig.ServiceId = dirName
 	}
 
-	if !dryRun {
+	if !dryRun && mode != parser.Validate {
 		// create interim local dirs for interim state or interim download storage
 		interim, err := os.MkdirTemp("", ".gendoc-interim-*")
 		if err != nil {
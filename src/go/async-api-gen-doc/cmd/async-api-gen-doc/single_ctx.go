@@ -2,12 +2,14 @@ package asyncapigendoc
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
 
 	"github.com/dnitsch/async-api-generator/internal/fshelper"
 	"github.com/dnitsch/async-api-generator/internal/generate"
+	"github.com/dnitsch/async-api-generator/internal/parser"
 	"github.com/dnitsch/async-api-generator/internal/storage"
 	log "github.com/dnitsch/simplelog"
 	"github.com/spf13/cobra"
@@ -20,6 +22,7 @@ var (
 	repoLang         string
 	isService        bool
 	serviceId        string
+	envFile          string
 	singleCtxCmd     = &cobra.Command{
 		Use:     "single-context",
 		Aliases: []string{"sc", "single"},
@@ -27,6 +30,9 @@ var (
 		Long:    `Runs the gendoc against a single repo source and emits the output to specified storage.`,
 		RunE:    singleCtxExecute,
 		PreRunE: func(cmd *cobra.Command, args []string) error {
+			if err := validateReportFlags(); err != nil {
+				return err
+			}
 			return setStorageLocation(inputLocation, outputLocation)
 		},
 	}
@@ -39,6 +45,8 @@ func init() {
 	singleCtxCmd.PersistentFlags().StringVarP(&repoLang, "lang", "", "C#", `Main Language used in repo`)
 	singleCtxCmd.PersistentFlags().StringVarP(&serviceId, "service-id", "", "", `serviceId`)
 	singleCtxCmd.PersistentFlags().BoolVarP(&isService, "is-service", "s", false, `whether the repo is a service repo`)
+	singleCtxCmd.PersistentFlags().StringVarP(&envFile, "env-file", "", "", `Path to a dotenv style file with KEY=value variables used to expand the content, these override the process environment`)
+	addReportFlags(singleCtxCmd)
 	AsyncAPIGenCmd.AddCommand(singleCtxCmd)
 }
 
@@ -48,13 +56,21 @@ func singleCtxExecute(cmd *cobra.Command, args []string) error {
 		logger = log.New(os.Stdout, log.DebugLvl)
 	}
 
-	conf, cleanUp, err := config(inputLocationStorageConfig)
+	conf, cleanUp, err := config(inputLocationStorageConfig, parser.SingleRepo)
 	if err != nil {
 		return err
 	}
 
 	defer cleanUp()
 
+	if envFile != "" {
+		fileEnv, err := parser.LoadEnvFile(envFile)
+		if err != nil {
+			return err
+		}
+		conf.Environ = append(os.Environ(), fileEnv...)
+	}
+
 	files, err := fshelper.ListFiles(inputLocationStorageConfig.Destination)
 	if err != nil {
 		return err
@@ -64,7 +80,11 @@ func singleCtxExecute(cmd *cobra.Command, args []string) error {
 
 	gendoc.LoadInputsFromFiles(files)
 
-	if err := gendoc.GenDocBlox(); err != nil {
+	err = gendoc.GenDocBlox()
+	if rerr := writeReport(err, inputLocationStorageConfig.Destination, cmd.OutOrStdout()); rerr != nil {
+		return errors.Join(err, rerr)
+	}
+	if err != nil {
 		return err
 	}
 
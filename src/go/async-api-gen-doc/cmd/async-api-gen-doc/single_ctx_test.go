@@ -4,6 +4,8 @@ import (
 	"bytes"
 	"fmt"
 	"io"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 
@@ -96,3 +98,31 @@ func Test_Failures_on_incorrect_input(t *testing.T) {
 		})
 	}
 }
+
+func Test_single_repo_writes_report(t *testing.T) {
+	negativeDir := fmt.Sprintf("local://%s", fshelper.DebugDirHelper(t, "./test/negative", "cmd/async-api-gen-doc", "../../"))
+	reportFile := filepath.Join(t.TempDir(), "gendoc.sarif")
+
+	cmd := asyncapigendoc.AsyncAPIGenCmd
+	// reset the flags shared with the other tests
+	t.Cleanup(func() {
+		sc, _, _ := cmd.Find([]string{"single-context"})
+		_ = sc.PersistentFlags().Set("report-format", "")
+		_ = sc.PersistentFlags().Set("report-file", "")
+	})
+	cmd.SetArgs([]string{"single-context", "-i", negativeDir, "--dry-run", "--report-format", "sarif", "--report-file", reportFile})
+	cmd.SetErr(new(bytes.Buffer))
+	if err := cmd.Execute(); err == nil {
+		t.Fatal("should have failed with error")
+	}
+
+	b, err := os.ReadFile(reportFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{`"version": "2.1.0"`, `"ruleId": "GD001"`, `"startLine"`} {
+		if !strings.Contains(string(b), want) {
+			t.Errorf("report missing %s\n%s", want, b)
+		}
+	}
+}
@@ -0,0 +1,143 @@
+package asyncapigendoc
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/dnitsch/async-api-generator/internal/diag"
+	"github.com/dnitsch/async-api-generator/internal/fshelper"
+	"github.com/dnitsch/async-api-generator/internal/generate"
+	"github.com/dnitsch/async-api-generator/internal/parser"
+	log "github.com/dnitsch/simplelog"
+	"github.com/spf13/cobra"
+)
+
+var validateCmd = &cobra.Command{
+	Use:   "validate",
+	Short: `Validates the annotations in a single repo source without emitting anything`,
+	Long: `Validates the annotations in a single repo source without emitting anything.
+Runs the full pipeline in memory, i.e. parses the source, builds the context tree and renders the AsyncAPI.
+Parser errors and documents not matching the AsyncAPI schema fail the validation, duplicate ids, missing parents, orphans, channels without operations, operations without messages
+and fields documented with conflicting values are reported as warnings, conflicts fail the validation with --merge-policy error.`,
+	RunE: validateExecute,
+	PreRunE: func(cmd *cobra.Command, args []string) error {
+		if err := validateReportFlags(); err != nil {
+			return err
+		}
+		return setStorageLocation(inputLocation, outputLocation)
+	},
+}
+
+func init() {
+	validateCmd.PersistentFlags().BoolVarP(&isService, "is-service", "s", false, `whether the repo is a service repo`)
+	validateCmd.PersistentFlags().StringVarP(&envFile, "env-file", "", "", `Path to a dotenv style file with KEY=value variables used to expand the content, these override the process environment`)
+	addReportFlags(validateCmd)
+	AsyncAPIGenCmd.AddCommand(validateCmd)
+}
+
+func validateExecute(cmd *cobra.Command, args []string) error {
+	g, cleanUp, err := inMemoryGenerate()
+	if err != nil {
+		return err
+	}
+	defer cleanUp()
+
+	diags, err := buildTree(g)
+	if err != nil || diags.HasErrors() {
+		return reportDiagnostics(cmd, diags, err, generate.ErrValidation)
+	}
+	diags = g.Validate()
+	if err := g.AsyncAPIFromProcessedTree(); err != nil {
+		diags = append(diags, diag.Collect(err)...)
+	}
+	diags = append(diags, g.Conflicts()...)
+	diags = append(diags, g.CombinedOperations()...)
+	return reportDiagnostics(cmd, diags, nil, generate.ErrValidation)
+}
+
+// inMemoryGenerate sets up the generator over the input in Validate mode,
+// i.e. nothing is written to the output.
+func inMemoryGenerate() (*generate.Generate, func(), error) {
+	if verbose {
+		logger = log.New(os.Stdout, log.DebugLvl)
+	}
+
+	conf, cleanUp, err := config(inputLocationStorageConfig, parser.Validate)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if envFile != "" {
+		fileEnv, err := parser.LoadEnvFile(envFile)
+		if err != nil {
+			cleanUp()
+			return nil, nil, err
+		}
+		conf.Environ = append(os.Environ(), fileEnv...)
+	}
+
+	files, err := fshelper.ListFiles(inputLocationStorageConfig.Destination)
+	if err != nil {
+		cleanUp()
+		return nil, nil, err
+	}
+
+	g := generate.New(conf, logger)
+	g.LoadInputsFromFiles(files)
+	return g, cleanUp, nil
+}
+
+// buildTree parses the inputs and builds the context tree
+//
+// The parser diagnostics are returned when parsing fails,
+// any error which is not a diagnostic is returned as is.
+func buildTree(g *generate.Generate) (diag.Diagnostics, error) {
+	if err := g.GenDocBlox(); err != nil {
+		diags := diag.Diagnostics{}
+		if !errors.As(err, &diags) {
+			return nil, err
+		}
+		return diags, nil
+	}
+	return nil, g.BuildContextTree()
+}
+
+// reportDiagnostics writes the --report-format report and fails with failErr on any error diagnostics
+//
+// Warnings only do not fail the command and are written to stderr.
+func reportDiagnostics(cmd *cobra.Command, diags diag.Diagnostics, err error, failErr error) error {
+	if err != nil {
+		return err
+	}
+	if err := writeReport(diags, inputLocationStorageConfig.Destination, cmd.OutOrStdout()); err != nil {
+		return err
+	}
+	if diags.HasErrors() {
+		return fmt.Errorf("\n%w%w", diags, failErr)
+	}
+	return renderWarnings(cmd.ErrOrStderr(), diags)
+}
+
+// renderWarnings writes the diagnostics to w with the orphans listed in their own section
+func renderWarnings(w io.Writer, diags diag.Diagnostics) error {
+	rest, orphans := diag.Diagnostics{}, diag.Diagnostics{}
+	for _, d := range diags {
+		if errors.Is(d, generate.ErrOrphan) {
+			orphans = append(orphans, d)
+			continue
+		}
+		rest = append(rest, d)
+	}
+	if err := rest.Render(w); err != nil {
+		return err
+	}
+	if len(orphans) == 0 {
+		return nil
+	}
+	if _, err := fmt.Fprintf(w, "\norphans (%d), see `%s orphans` for the details:\n", len(orphans), AsyncAPIGenCmd.Name()); err != nil {
+		return err
+	}
+	return orphans.Render(w)
+}
@@ -0,0 +1,58 @@
+package asyncapigendoc_test
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+
+	asyncapigendoc "github.com/dnitsch/async-api-generator/cmd/async-api-gen-doc"
+	"github.com/dnitsch/async-api-generator/internal/fshelper"
+)
+
+func Test_validate(t *testing.T) {
+	ttests := map[string]struct {
+		baseDir     string
+		flags       []string
+		expErr      string
+		expWarnings []string
+	}{
+		"sample warns only": {
+			baseDir:     "test/foo.sample",
+			flags:       []string{"--is-service"},
+			expWarnings: []string{"GD030", "orphans (", "GD032"},
+		},
+		"negative fails": {
+			baseDir: "test/negative",
+			expErr:  "validation failed",
+		},
+	}
+	for name, tt := range ttests {
+		t.Run(name, func(t *testing.T) {
+			cmd := asyncapigendoc.AsyncAPIGenCmd
+			t.Cleanup(func() {
+				sc, _, _ := cmd.Find([]string{"validate"})
+				_ = sc.PersistentFlags().Set("is-service", "false")
+			})
+			input := fmt.Sprintf("local://%s", fshelper.DebugDirHelper(t, tt.baseDir, "cmd/async-api-gen-doc", "../../"))
+			stderr := new(bytes.Buffer)
+			cmd.SetArgs(append([]string{"validate", "-i", input}, tt.flags...))
+			cmd.SetErr(stderr)
+			err := cmd.Execute()
+			if tt.expErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.expErr) {
+					t.Fatalf("got error %v, wanted %s", err, tt.expErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, want := range tt.expWarnings {
+				if !strings.Contains(stderr.String(), want) {
+					t.Errorf("warnings missing %s\n%s", want, stderr.String())
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,223 @@
+// Package diag holds the structured diagnostics emitted
+// while analysing the source files.
+//
+// Each Diagnostic points at a position in a source file,
+// the offending source line is only read when the diagnostic is rendered.
+package diag
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+// Severity of a Diagnostic
+type Severity string
+
+const (
+	SeverityError   Severity = "error"
+	SeverityWarning Severity = "warning"
+	SeverityInfo    Severity = "info"
+)
+
+// Diagnostic is a single problem found at a position in a source file
+type Diagnostic struct {
+	File     string   `json:"file"`
+	Path     string   `json:"path"`
+	Line     int      `json:"line"`
+	Column   int      `json:"column"`
+	Severity Severity `json:"severity"`
+	Code     string   `json:"code"`
+	Err      error    `json:"-"`
+}
+
+// Message returns the underlying error message
+func (d *Diagnostic) Message() string {
+	if d.Err == nil {
+		return ""
+	}
+	return d.Err.Error()
+}
+
+func (d *Diagnostic) Error() string {
+	return fmt.Sprintf("[%s:%d:%d] %s", d.File, d.Line, d.Column, d.heading())
+}
+
+func (d *Diagnostic) Unwrap() error {
+	return d.Err
+}
+
+func (d *Diagnostic) heading() string {
+	if d.Code == "" {
+		return fmt.Sprintf("%s: %s", d.Severity, d.Message())
+	}
+	return fmt.Sprintf("%s %s: %s", d.Severity, d.Code, d.Message())
+}
+
+// position returns the `line:column ` prefix, empty for file level diagnostics
+func (d *Diagnostic) position() string {
+	if d.Line < 1 {
+		return ""
+	}
+	return fmt.Sprintf("%d:%d ", d.Line, d.Column)
+}
+
+// location returns the path used to group and read the source
+func (d *Diagnostic) location() string {
+	if d.Path != "" {
+		return d.Path
+	}
+	return d.File
+}
+
+// Diagnostics is a collection of Diagnostic
+// which renders grouped by file when used as an error
+type Diagnostics []*Diagnostic
+
+// Collect extracts all the Diagnostic from the errors
+//
+// Joined errors are flattened and errors which are not a Diagnostic
+// are kept as an error Diagnostic without a position.
+func Collect(errs ...error) Diagnostics {
+	diags := Diagnostics{}
+	for _, err := range errs {
+		if err == nil {
+			continue
+		}
+		if joined, ok := err.(interface{ Unwrap() []error }); ok {
+			diags = append(diags, Collect(joined.Unwrap()...)...)
+			continue
+		}
+		d := &Diagnostic{}
+		if errors.As(err, &d) {
+			diags = append(diags, d)
+			continue
+		}
+		diags = append(diags, &Diagnostic{Severity: SeverityError, Err: err})
+	}
+	return diags
+}
+
+// HasErrors reports whether any of the diagnostics is an error
+func (d Diagnostics) HasErrors() bool {
+	for _, diag := range d {
+		if diag.Severity == SeverityError {
+			return true
+		}
+	}
+	return false
+}
+
+func (d Diagnostics) Error() string {
+	b := &strings.Builder{}
+	_ = d.Render(b)
+	return b.String()
+}
+
+func (d Diagnostics) Unwrap() []error {
+	errs := make([]error, len(d))
+	for i, diag := range d {
+		errs[i] = diag
+	}
+	return errs
+}
+
+// Sorted returns the diagnostics ordered by file, line and column
+func (d Diagnostics) Sorted() Diagnostics {
+	sorted := append(Diagnostics{}, d...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		a, b := sorted[i], sorted[j]
+		if a.location() != b.location() {
+			return a.location() < b.location()
+		}
+		if a.Line != b.Line {
+			return a.Line < b.Line
+		}
+		return a.Column < b.Column
+	})
+	return sorted
+}
+
+// Render writes the diagnostics grouped by file,
+// each followed by the offending source line and a caret under the column.
+//
+//	/path/to/file.cs
+//	  2:11 error GD003: category type incorrect ...
+//	     | //+gendoc category=bar type=nameId
+//	     |           ^
+func (d Diagnostics) Render(w io.Writer) error {
+	current := ""
+	var lines []string
+	for i, diag := range d.Sorted() {
+		if i == 0 || diag.location() != current {
+			current = diag.location()
+			lines = readLines(diag.Path)
+			if _, err := fmt.Fprintf(w, "%s\n", current); err != nil {
+				return err
+			}
+		}
+		if _, err := fmt.Fprintf(w, "  %s%s\n", diag.position(), indent(diag.heading(), "    ")); err != nil {
+			return err
+		}
+		if snippet := snippet(lines, diag.Line, diag.Column); snippet != "" {
+			if _, err := fmt.Fprint(w, snippet); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Snippet returns the offending source line with a caret under the column
+//
+// Returns an empty string when the source cannot be read.
+func (d *Diagnostic) Snippet() string {
+	return snippet(readLines(d.Path), d.Line, d.Column)
+}
+
+func snippet(lines []string, line, column int) string {
+	if line < 1 || line > len(lines) {
+		return ""
+	}
+	src := lines[line-1]
+	caret := strings.Builder{}
+	for i, ch := range []rune(src) {
+		if i >= column-1 {
+			break
+		}
+		// keep tabs so that the caret lines up with the source
+		if ch == '\t' {
+			caret.WriteRune('\t')
+		} else {
+			caret.WriteRune(' ')
+		}
+	}
+	return fmt.Sprintf("     | %s\n     | %s^\n", src, caret.String())
+}
+
+// readLines reads the source lazily, i.e. only when rendering
+func readLines(path string) []string {
+	if path == "" {
+		return nil
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+	lines := []string{}
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		lines = append(lines, strings.TrimRight(scanner.Text(), "\r"))
+	}
+	return lines
+}
+
+func indent(s, prefix string) string {
+	return strings.ReplaceAll(s, "\n", "\n"+prefix)
+}
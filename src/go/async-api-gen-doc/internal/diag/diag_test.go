@@ -0,0 +1,77 @@
+package diag_test
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/dnitsch/async-api-generator/internal/diag"
+)
+
+var errSample = errors.New("sample error")
+
+func Test_Collect_flattens_joined_errors(t *testing.T) {
+	d1 := &diag.Diagnostic{File: "a", Line: 1, Column: 1, Severity: diag.SeverityError, Err: errSample}
+	d2 := &diag.Diagnostic{File: "b", Line: 2, Column: 3, Severity: diag.SeverityWarning, Err: errSample}
+	got := diag.Collect(errors.Join(d1, fmt.Errorf("wrapped: %w", d2)), errors.New("plain"), nil)
+	if len(got) != 3 {
+		t.Fatalf("got %d diagnostics, wanted 3", len(got))
+	}
+	if got[0] != d1 || got[1] != d2 {
+		t.Errorf("diagnostics not extracted in order: %v", got)
+	}
+	if got[2].Severity != diag.SeverityError || got[2].Message() != "plain" {
+		t.Errorf("plain error not kept as an error diagnostic: %v", got[2])
+	}
+	if !errors.Is(got, errSample) {
+		t.Error("diagnostics do not unwrap to the underlying errors")
+	}
+}
+
+func Test_Render_groups_by_file_with_snippet(t *testing.T) {
+	dir := t.TempDir()
+	first := filepath.Join(dir, "a.cs")
+	second := filepath.Join(dir, "b.md")
+	if err := os.WriteFile(first, []byte("let x = 1;\n\t//+gendoc category=bar\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(second, []byte("<!--+gendoc id=foo -->\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	diags := diag.Diagnostics{
+		{File: "b.md", Path: second, Line: 1, Column: 1, Severity: diag.SeverityError, Code: "GD001", Err: errSample},
+		{File: "a.cs", Path: first, Line: 2, Column: 21, Severity: diag.SeverityError, Code: "GD003", Err: errSample},
+		{File: "a.cs", Path: first, Line: 2, Column: 2, Severity: diag.SeverityError, Code: "GD001", Err: errSample},
+		{File: "a.cs", Path: first, Severity: diag.SeverityError, Err: errSample},
+	}
+	got := diags.Error()
+	want := first + `
+  error: sample error
+  2:2 error GD001: sample error
+     | 	//+gendoc category=bar
+     | 	^
+  2:21 error GD003: sample error
+     | 	//+gendoc category=bar
+     | 	                   ^
+` + second + `
+  1:1 error GD001: sample error
+     | <!--+gendoc id=foo -->
+     | ^
+`
+	if got != want {
+		t.Errorf("got:\n%s\nwanted:\n%s", got, want)
+	}
+}
+
+func Test_Diagnostic_Error_includes_position(t *testing.T) {
+	d := &diag.Diagnostic{File: "bar", Line: 2, Column: 41, Severity: diag.SeverityError, Code: "GD003", Err: errSample}
+	if !strings.Contains(d.Error(), "[bar:2:41] error GD003: sample error") {
+		t.Errorf("got: %s", d.Error())
+	}
+	if d.Snippet() != "" {
+		t.Errorf("snippet should be empty without a readable path, got: %s", d.Snippet())
+	}
+}
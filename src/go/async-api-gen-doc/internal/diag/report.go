@@ -0,0 +1,290 @@
+package diag
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+var ErrUnknownReportFormat = errors.New("report format must be one of sarif, json or junit")
+
+// ReportFormat is the machine readable format the diagnostics are written in
+type ReportFormat string
+
+const (
+	ReportSARIF ReportFormat = "sarif"
+	ReportJSON  ReportFormat = "json"
+	ReportJUnit ReportFormat = "junit"
+)
+
+// ParseReportFormat returns the ReportFormat for the name, e.g. `sarif`
+func ParseReportFormat(name string) (ReportFormat, error) {
+	switch format := ReportFormat(strings.ToLower(name)); format {
+	case ReportSARIF, ReportJSON, ReportJUnit:
+		return format, nil
+	}
+	return "", fmt.Errorf("'%s': %w", name, ErrUnknownReportFormat)
+}
+
+// Report writes the diagnostics in a format consumed by CI systems,
+// e.g. SARIF for code scanning or JUnit for test summaries.
+//
+// An empty report is still written when there are no diagnostics
+// so that the consumer can tell a clean run from a missing report.
+type Report struct {
+	// Tool is the name reported as the producer of the diagnostics
+	Tool string
+	// Version of the tool
+	Version string
+	// BaseDir is the root the file locations are made relative to,
+	// code scanning resolves the locations against the repository root.
+	BaseDir string
+}
+
+// Write writes the diagnostics sorted by file, line and column in the format
+func (r Report) Write(w io.Writer, format ReportFormat, diags Diagnostics) error {
+	sorted := diags.Sorted()
+	switch format {
+	case ReportSARIF:
+		return r.writeJSON(w, r.sarif(sorted))
+	case ReportJSON:
+		return r.writeJSON(w, r.json(sorted))
+	case ReportJUnit:
+		return r.writeJUnit(w, sorted)
+	}
+	return fmt.Errorf("'%s': %w", format, ErrUnknownReportFormat)
+}
+
+// uri returns the location of the diagnostic relative to the BaseDir with forward slashes
+func (r Report) uri(d *Diagnostic) string {
+	loc := d.location()
+	if r.BaseDir != "" && filepath.IsAbs(loc) {
+		if rel, err := filepath.Rel(r.BaseDir, loc); err == nil && !strings.HasPrefix(rel, "..") {
+			loc = rel
+		}
+	}
+	return filepath.ToSlash(loc)
+}
+
+func (r Report) writeJSON(w io.Writer, v any) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+type jsonReport struct {
+	Tool        string           `json:"tool"`
+	Version     string           `json:"version"`
+	Errors      int              `json:"errors"`
+	Warnings    int              `json:"warnings"`
+	Diagnostics []jsonDiagnostic `json:"diagnostics"`
+}
+
+type jsonDiagnostic struct {
+	File     string   `json:"file"`
+	Path     string   `json:"path"`
+	Line     int      `json:"line,omitempty"`
+	Column   int      `json:"column,omitempty"`
+	Severity Severity `json:"severity"`
+	Code     string   `json:"code,omitempty"`
+	Message  string   `json:"message"`
+}
+
+func (r Report) json(diags Diagnostics) jsonReport {
+	report := jsonReport{Tool: r.Tool, Version: r.Version, Diagnostics: []jsonDiagnostic{}}
+	for _, d := range diags {
+		switch d.Severity {
+		case SeverityError:
+			report.Errors++
+		case SeverityWarning:
+			report.Warnings++
+		}
+		report.Diagnostics = append(report.Diagnostics, jsonDiagnostic{
+			File:     d.File,
+			Path:     r.uri(d),
+			Line:     d.Line,
+			Column:   d.Column,
+			Severity: d.Severity,
+			Code:     d.Code,
+			Message:  d.Message(),
+		})
+	}
+	return report
+}
+
+// SARIF 2.1.0 subset understood by code scanning
+// https://docs.oasis-open.org/sarif/sarif/v2.1.0/sarif-v2.1.0.html
+const (
+	sarifVersion = "2.1.0"
+	sarifSchema  = "https://json.schemastore.org/sarif-2.1.0.json"
+)
+
+type sarifLog struct {
+	Version string     `json:"version"`
+	Schema  string     `json:"$schema"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool    sarifTool     `json:"tool"`
+	Results []sarifResult `json:"results"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name    string      `json:"name"`
+	Version string      `json:"version,omitempty"`
+	Rules   []sarifRule `json:"rules"`
+}
+
+type sarifRule struct {
+	Id string `json:"id"`
+}
+
+type sarifResult struct {
+	RuleId    string          `json:"ruleId,omitempty"`
+	Level     string          `json:"level"`
+	Message   sarifMessage    `json:"message"`
+	Locations []sarifLocation `json:"locations,omitempty"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifLocation struct {
+	PhysicalLocation sarifPhysicalLocation `json:"physicalLocation"`
+}
+
+type sarifPhysicalLocation struct {
+	ArtifactLocation sarifArtifactLocation `json:"artifactLocation"`
+	Region           *sarifRegion          `json:"region,omitempty"`
+}
+
+type sarifArtifactLocation struct {
+	Uri string `json:"uri"`
+}
+
+type sarifRegion struct {
+	StartLine   int `json:"startLine"`
+	StartColumn int `json:"startColumn,omitempty"`
+}
+
+// sarifLevel maps the severity to the SARIF result level
+func sarifLevel(severity Severity) string {
+	switch severity {
+	case SeverityWarning:
+		return "warning"
+	case SeverityInfo:
+		return "note"
+	}
+	return "error"
+}
+
+func (r Report) sarif(diags Diagnostics) sarifLog {
+	run := sarifRun{
+		Tool:    sarifTool{Driver: sarifDriver{Name: r.Tool, Version: r.Version, Rules: []sarifRule{}}},
+		Results: []sarifResult{},
+	}
+	rules := map[string]bool{}
+	for _, d := range diags {
+		result := sarifResult{
+			RuleId:  d.Code,
+			Level:   sarifLevel(d.Severity),
+			Message: sarifMessage{Text: d.Message()},
+		}
+		if d.Code != "" && !rules[d.Code] {
+			rules[d.Code] = true
+			run.Tool.Driver.Rules = append(run.Tool.Driver.Rules, sarifRule{Id: d.Code})
+		}
+		if uri := r.uri(d); uri != "" {
+			loc := sarifLocation{PhysicalLocation: sarifPhysicalLocation{ArtifactLocation: sarifArtifactLocation{Uri: uri}}}
+			if d.Line > 0 {
+				loc.PhysicalLocation.Region = &sarifRegion{StartLine: d.Line, StartColumn: d.Column}
+			}
+			result.Locations = []sarifLocation{loc}
+		}
+		run.Results = append(run.Results, result)
+	}
+	sort.Slice(run.Tool.Driver.Rules, func(i, j int) bool {
+		return run.Tool.Driver.Rules[i].Id < run.Tool.Driver.Rules[j].Id
+	})
+	return sarifLog{Version: sarifVersion, Schema: sarifSchema, Runs: []sarifRun{run}}
+}
+
+type junitTestSuites struct {
+	XMLName  xml.Name         `xml:"testsuites"`
+	Name     string           `xml:"name,attr"`
+	Tests    int              `xml:"tests,attr"`
+	Failures int              `xml:"failures,attr"`
+	Suites   []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name     string          `xml:"name,attr"`
+	Tests    int             `xml:"tests,attr"`
+	Failures int             `xml:"failures,attr"`
+	Cases    []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+	Skipped   *junitSkipped `xml:"skipped,omitempty"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr"`
+	Text    string `xml:",cdata"`
+}
+
+type junitSkipped struct {
+	Message string `xml:"message,attr"`
+}
+
+// writeJUnit writes a suite per file and a test case per diagnostic,
+// errors are failures and warnings or info are skipped test cases.
+func (r Report) writeJUnit(w io.Writer, diags Diagnostics) error {
+	report := junitTestSuites{Name: r.Tool}
+	for _, d := range diags {
+		uri := r.uri(d)
+		if len(report.Suites) == 0 || report.Suites[len(report.Suites)-1].Name != uri {
+			report.Suites = append(report.Suites, junitTestSuite{Name: uri})
+		}
+		suite := &report.Suites[len(report.Suites)-1]
+		tc := junitTestCase{Name: strings.TrimSpace(d.position() + d.Code), ClassName: uri}
+		if tc.Name == "" {
+			tc.Name = string(d.Severity)
+		}
+		if d.Severity == SeverityError {
+			tc.Failure = &junitFailure{Message: d.Message(), Type: d.Code, Text: d.Snippet()}
+			suite.Failures++
+			report.Failures++
+		} else {
+			tc.Skipped = &junitSkipped{Message: d.Message()}
+		}
+		suite.Tests++
+		report.Tests++
+		suite.Cases = append(suite.Cases, tc)
+	}
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(report); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
@@ -0,0 +1,176 @@
+package diag_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/dnitsch/async-api-generator/internal/diag"
+)
+
+func reportDiagnostics(base string) diag.Diagnostics {
+	return diag.Diagnostics{
+		{File: "b.md", Path: filepath.Join(base, "docs", "b.md"), Line: 4, Column: 2, Severity: diag.SeverityWarning, Code: "GD011", Err: errSample},
+		{File: "a.cs", Path: filepath.Join(base, "src", "a.cs"), Line: 2, Column: 11, Severity: diag.SeverityError, Code: "GD003", Err: errSample},
+		{File: "a.cs", Path: filepath.Join(base, "src", "a.cs"), Severity: diag.SeverityError, Err: errors.New("unreadable")},
+	}
+}
+
+func Test_ParseReportFormat(t *testing.T) {
+	ttests := map[string]struct {
+		input   string
+		want    diag.ReportFormat
+		wantErr error
+	}{
+		"sarif":         {"sarif", diag.ReportSARIF, nil},
+		"json":          {"json", diag.ReportJSON, nil},
+		"junit upper":   {"JUnit", diag.ReportJUnit, nil},
+		"unknown":       {"xml", "", diag.ErrUnknownReportFormat},
+		"empty unknown": {"", "", diag.ErrUnknownReportFormat},
+	}
+	for name, tt := range ttests {
+		t.Run(name, func(t *testing.T) {
+			got, err := diag.ParseReportFormat(tt.input)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("got error %v, wanted %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("got %q, wanted %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_Report_SARIF(t *testing.T) {
+	base := t.TempDir()
+	out := &bytes.Buffer{}
+	r := diag.Report{Tool: "gendoc", Version: "0.0.1", BaseDir: base}
+	if err := r.Write(out, diag.ReportSARIF, reportDiagnostics(base)); err != nil {
+		t.Fatal(err)
+	}
+	got := struct {
+		Version string `json:"version"`
+		Runs    []struct {
+			Tool struct {
+				Driver struct {
+					Name  string `json:"name"`
+					Rules []struct {
+						Id string `json:"id"`
+					} `json:"rules"`
+				} `json:"driver"`
+			} `json:"tool"`
+			Results []struct {
+				RuleId    string `json:"ruleId"`
+				Level     string `json:"level"`
+				Locations []struct {
+					PhysicalLocation struct {
+						ArtifactLocation struct {
+							Uri string `json:"uri"`
+						} `json:"artifactLocation"`
+						Region *struct {
+							StartLine   int `json:"startLine"`
+							StartColumn int `json:"startColumn"`
+						} `json:"region"`
+					} `json:"physicalLocation"`
+				} `json:"locations"`
+			} `json:"results"`
+		} `json:"runs"`
+	}{}
+	if err := json.Unmarshal(out.Bytes(), &got); err != nil {
+		t.Fatalf("invalid sarif: %v\n%s", err, out.String())
+	}
+	if got.Version != "2.1.0" || len(got.Runs) != 1 {
+		t.Fatalf("unexpected sarif log: %s", out.String())
+	}
+	run := got.Runs[0]
+	if run.Tool.Driver.Name != "gendoc" || len(run.Tool.Driver.Rules) != 2 || run.Tool.Driver.Rules[0].Id != "GD003" {
+		t.Errorf("unexpected driver: %+v", run.Tool.Driver)
+	}
+	if len(run.Results) != 3 {
+		t.Fatalf("got %d results, wanted 3", len(run.Results))
+	}
+	if res := run.Results[0]; res.Level != "warning" || res.Locations[0].PhysicalLocation.ArtifactLocation.Uri != "docs/b.md" {
+		t.Errorf("unexpected result: %+v", res)
+	}
+	// file level diagnostic sorts ahead of the positioned ones and has no region
+	if loc := run.Results[1].Locations[0].PhysicalLocation; loc.ArtifactLocation.Uri != "src/a.cs" || loc.Region != nil {
+		t.Errorf("unexpected file level location: %+v", loc)
+	}
+	if res := run.Results[2]; res.RuleId != "GD003" || res.Level != "error" || res.Locations[0].PhysicalLocation.Region.StartColumn != 11 {
+		t.Errorf("unexpected result: %+v", res)
+	}
+}
+
+func Test_Report_JSON(t *testing.T) {
+	base := t.TempDir()
+	out := &bytes.Buffer{}
+	r := diag.Report{Tool: "gendoc", BaseDir: base}
+	if err := r.Write(out, diag.ReportJSON, reportDiagnostics(base)); err != nil {
+		t.Fatal(err)
+	}
+	got := struct {
+		Errors      int `json:"errors"`
+		Warnings    int `json:"warnings"`
+		Diagnostics []struct {
+			Path    string `json:"path"`
+			Line    int    `json:"line"`
+			Code    string `json:"code"`
+			Message string `json:"message"`
+		} `json:"diagnostics"`
+	}{}
+	if err := json.Unmarshal(out.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Errors != 2 || got.Warnings != 1 || len(got.Diagnostics) != 3 {
+		t.Fatalf("unexpected report: %s", out.String())
+	}
+	if d := got.Diagnostics[2]; d.Path != "src/a.cs" || d.Line != 2 || d.Code != "GD003" || d.Message != errSample.Error() {
+		t.Errorf("unexpected diagnostic: %+v", d)
+	}
+}
+
+func Test_Report_JUnit(t *testing.T) {
+	base := t.TempDir()
+	out := &bytes.Buffer{}
+	r := diag.Report{Tool: "gendoc", BaseDir: base}
+	if err := r.Write(out, diag.ReportJUnit, reportDiagnostics(base)); err != nil {
+		t.Fatal(err)
+	}
+	got := out.String()
+	for _, want := range []string{
+		`<testsuites name="gendoc" tests="3" failures="2">`,
+		`<testsuite name="docs/b.md" tests="1" failures="0">`,
+		`<testsuite name="src/a.cs" tests="2" failures="2">`,
+		`<testcase name="2:11 GD003" classname="src/a.cs">`,
+		`<skipped message="sample error"></skipped>`,
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("report missing %s\n%s", want, got)
+		}
+	}
+}
+
+func Test_Report_empty_is_still_written(t *testing.T) {
+	ttests := map[string]struct {
+		format diag.ReportFormat
+		want   string
+	}{
+		"sarif": {diag.ReportSARIF, `"results": []`},
+		"json":  {diag.ReportJSON, `"diagnostics": []`},
+		"junit": {diag.ReportJUnit, `tests="0" failures="0"`},
+	}
+	for name, tt := range ttests {
+		t.Run(name, func(t *testing.T) {
+			out := &bytes.Buffer{}
+			if err := (diag.Report{Tool: "gendoc"}).Write(out, tt.format, nil); err != nil {
+				t.Fatal(err)
+			}
+			if !strings.Contains(out.String(), tt.want) {
+				t.Errorf("got %s, wanted to contain %s", out.String(), tt.want)
+			}
+		})
+	}
+}
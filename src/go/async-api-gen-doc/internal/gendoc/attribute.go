@@ -0,0 +1,197 @@
+package gendoc
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+var (
+	// ErrUnterminatedQuote indicates that a quoted value was not closed before the end of the annotation.
+	ErrUnterminatedQuote = errors.New("quoted value is missing the closing quote")
+	// ErrUnterminatedList indicates that an array like value was not closed before the end of the annotation.
+	ErrUnterminatedList = errors.New("array like value is missing the closing bracket")
+	// ErrUnknownEscape indicates that an unsupported escape sequence was used inside a quoted value.
+	ErrUnknownEscape = errors.New("unknown escape sequence, only \\\", \\', \\\\, \\n and \\t are supported")
+)
+
+// AnnotationError carries the position inside the raw annotation
+// at which the error was detected.
+//
+// Pos is a zero based offset in runes into the annotation string,
+// callers can add it to the column of the annotation in the source.
+type AnnotationError struct {
+	Pos int
+	Msg string
+	Err error
+}
+
+func (e *AnnotationError) Error() string {
+	return fmt.Sprintf("%s\n%s", e.Msg, e.Err)
+}
+
+func (e *AnnotationError) Unwrap() error {
+	return e.Err
+}
+
+// wrapErrAt returns the error at the byte offset of the annotation, converted into runes
+func wrapErrAt(annotation string, pos int, msg string, etyp error) error {
+	return &AnnotationError{Pos: utf8.RuneCountInString(annotation[:min(pos, len(annotation))]), Msg: msg, Err: etyp}
+}
+
+// attribute is a single key=value pair scanned from the raw annotation
+type attribute struct {
+	key    string
+	val    string
+	pos    int // byte offset of the key in the raw annotation
+	valPos int // byte offset of the value in the raw annotation
+}
+
+// attributeScanner walks the raw annotation and emits key/value attributes
+//
+// Values can be:
+//   - bare, e.g. `id=foo`, ending at the next whitespace and allowed to contain `=`
+//   - double quoted, e.g. `title="Order cancelled event"`
+//   - single quoted, e.g. `title='Order "cancelled" event'`
+//   - array like, e.g. `parent=[foo, bar]`, ending at the closing bracket
+//
+// Inside quotes a backslash escapes the quote characters, the backslash itself, `\n` and `\t`.
+type attributeScanner struct {
+	input string
+	pos   int
+}
+
+func scanAttributes(raw string) ([]attribute, error) {
+	s := &attributeScanner{input: raw}
+	attrs := []attribute{}
+	for {
+		s.skipWhitespace()
+		if s.eof() {
+			return attrs, nil
+		}
+		attr, skip, err := s.next()
+		if err != nil {
+			return nil, err
+		}
+		if skip {
+			continue
+		}
+		attrs = append(attrs, attr)
+	}
+}
+
+func (s *attributeScanner) eof() bool {
+	return s.pos >= len(s.input)
+}
+
+func (s *attributeScanner) skipWhitespace() {
+	for !s.eof() && isWhitespace(s.input[s.pos]) {
+		s.pos++
+	}
+}
+
+// next reads the key and the value of a single attribute.
+//
+// Returns skip as true for standalone comment characters, e.g. `-->`
+func (s *attributeScanner) next() (attribute, bool, error) {
+	attr := attribute{pos: s.pos}
+	for !s.eof() && !isWhitespace(s.input[s.pos]) && s.input[s.pos] != '=' {
+		s.pos++
+	}
+	attr.key = s.input[attr.pos:s.pos]
+
+	if s.eof() || s.input[s.pos] != '=' {
+		// bare word without a value
+		if ignore(attr.key) {
+			return attr, true, nil
+		}
+		return attr, false, wrapErrAt(s.input, attr.pos, attr.key, ErrUnparseableTag)
+	}
+	// consume `=`
+	s.pos++
+	attr.valPos = s.pos
+
+	val, err := s.value()
+	if err != nil {
+		return attr, false, err
+	}
+	attr.val = val
+
+	if len(attr.key) < 1 || len(attr.val) < 1 {
+		return attr, false, wrapErrAt(s.input, attr.pos, fmt.Sprintf("key '%s' and value '%s'", attr.key, attr.val), ErrZeroLengthKeyOrValue)
+	}
+	return attr, false, nil
+}
+
+func (s *attributeScanner) value() (string, error) {
+	if s.eof() {
+		return "", nil
+	}
+	switch quote := s.input[s.pos]; quote {
+	case '"', '\'':
+		return s.quoted(quote)
+	case '[':
+		return s.list()
+	default:
+		start := s.pos
+		for !s.eof() && !isWhitespace(s.input[s.pos]) {
+			s.pos++
+		}
+		return s.input[start:s.pos], nil
+	}
+}
+
+// quoted reads until the matching unescaped closing quote
+func (s *attributeScanner) quoted(quote byte) (string, error) {
+	start := s.pos
+	// consume opening quote
+	s.pos++
+	val := strings.Builder{}
+	for !s.eof() {
+		ch := s.input[s.pos]
+		switch ch {
+		case quote:
+			// consume closing quote
+			s.pos++
+			return val.String(), nil
+		case '\\':
+			if s.pos+1 >= len(s.input) {
+				return "", wrapErrAt(s.input, start, s.input[start:], ErrUnterminatedQuote)
+			}
+			escaped, ok := escapes[s.input[s.pos+1]]
+			if !ok {
+				return "", wrapErrAt(s.input, s.pos, s.input[s.pos:s.pos+2], ErrUnknownEscape)
+			}
+			val.WriteByte(escaped)
+			s.pos += 2
+		default:
+			val.WriteByte(ch)
+			s.pos++
+		}
+	}
+	return "", wrapErrAt(s.input, start, s.input[start:], ErrUnterminatedQuote)
+}
+
+// list reads an array like value until the closing bracket, whitespace is allowed inside
+func (s *attributeScanner) list() (string, error) {
+	start := s.pos
+	end := strings.IndexByte(s.input[start:], ']')
+	if end < 0 {
+		return "", wrapErrAt(s.input, start, s.input[start:], ErrUnterminatedList)
+	}
+	s.pos = start + end + 1
+	return s.input[start:s.pos], nil
+}
+
+var escapes = map[byte]byte{
+	'"':  '"',
+	'\'': '\'',
+	'\\': '\\',
+	'n':  '\n',
+	't':  '\t',
+}
+
+func isWhitespace(ch byte) bool {
+	return ch == ' ' || ch == '\t' || ch == '\n' || ch == '\r'
+}
@@ -5,8 +5,10 @@
 package gendoc
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
+	"strconv"
 	"strings"
 
 	"github.com/dnitsch/async-api-generator/internal/token"
@@ -78,92 +80,211 @@ var categoryTypeEnum = map[string]CategoryType{
 type GenDoc struct {
 	raw             string
 	log             log.Loggeriface
+	strict          bool
 	CategoryType    CategoryType `json:"category" yaml:"category"`
 	ContentType     ContentType  `json:"type" yaml:"type"`
 	Name            string       `json:"name" yaml:"name"`
 	Id              string       `json:"id" yaml:"id"`
-	ServiceId       string       `json:"serviceId" yaml:"serviceId"` // for cases when children of services i.e. channels or servers are defined outside of a repo. This property can be in form of an array like string.
-	ChannelId       string       `json:"channelId" yaml:"channelId"` // for cases when children of channels i.e. operations are defined outside of a repo. This property can be in form of an array like string.
-	Parent          string       `json:"parent" yaml:"parent"`
+	ServiceId       IdList       `json:"serviceId" yaml:"serviceId"` // for cases when children of services i.e. channels or servers are defined outside of a repo. This property can be in form of an array like string, e.g. serviceId=[foo,bar].
+	ChannelId       IdList       `json:"channelId" yaml:"channelId"` // for cases when children of channels i.e. operations are defined outside of a repo. This property can be in form of an array like string, e.g. channelId=[foo,bar].
+	Parent          IdList       `json:"parent" yaml:"parent"`       // the block is attached under every listed parent, e.g. parent=[foo,bar].
 	ServiceURN      string       `json:"serviceURN" yaml:"serviceURN"`
 	ServiceRepoUrl  string       `json:"serviceRepoUrl" yaml:"serviceRepoUrl"`
 	ServiceRepoLang string       `json:"serviceRepoLang" yaml:"serviceRepoLang"`
+	Title           string       `json:"title,omitempty" yaml:"title,omitempty"` // short inline metadata which can be set directly on the annotation, e.g. title="Order cancelled event"
+	Summary         string       `json:"summary,omitempty" yaml:"summary,omitempty"`
+	Description     string       `json:"description,omitempty" yaml:"description,omitempty"`
+	Ref             string       `json:"ref,omitempty" yaml:"ref,omitempty"`       // path to an external file holding the content of the block, e.g. ref=./schemas/order.v2.json. Relative paths are resolved against the annotated file.
+	Expand          *bool        `json:"expand,omitempty" yaml:"expand,omitempty"` // whether environment variables in the content are expanded, see ShouldExpand
+	Shared          bool         `json:"shared,omitempty" yaml:"shared,omitempty"` // the channel is the same broker entity for every service documenting it, e.g. shared=true. Channels are otherwise scoped to their owning service.
 }
 
-func NewFromToken(token token.Token, log log.Loggeriface) (GenDoc, error) {
+// ShouldExpand reports whether environment variables in the content are expanded
+//
+// Content of every type is expanded unless the annotation opts out with expand=false,
+// e.g. a payload containing `$schema` or `$ref`.
+func (g GenDoc) ShouldExpand() bool {
+	if g.Expand != nil {
+		return *g.Expand
+	}
+	return true
+}
+
+// IdList holds one or more ids
+//
+// In an annotation it can be specified either as a single value `parent=foo`
+// or as an array like string `parent=[foo,bar]`.
+type IdList []string
+
+// NewIdList parses a single id or an array like string into an IdList
+func NewIdList(val string) IdList {
+	if !strings.HasPrefix(val, "[") || !strings.HasSuffix(val, "]") {
+		return IdList{val}
+	}
+	ids := IdList{}
+	for _, id := range strings.Split(strings.TrimSuffix(strings.TrimPrefix(val, "["), "]"), ",") {
+		if id = strings.TrimSpace(id); id != "" {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// String returns a comma separated list of ids
+func (ids IdList) String() string {
+	return strings.Join(ids, ",")
+}
+
+// Contains reports whether the id is in the list
+func (ids IdList) Contains(id string) bool {
+	for _, i := range ids {
+		if i == id {
+			return true
+		}
+	}
+	return false
+}
+
+// UnmarshalJSON accepts both a JSON array and a single string.
+//
+// Interim states emitted before ids could be lists store a plain string.
+func (ids *IdList) UnmarshalJSON(b []byte) error {
+	single := ""
+	if err := json.Unmarshal(b, &single); err == nil {
+		*ids = nil
+		if single != "" {
+			*ids = IdList{single}
+		}
+		return nil
+	}
+	list := []string{}
+	if err := json.Unmarshal(b, &list); err != nil {
+		return err
+	}
+	*ids = list
+	return nil
+}
+
+// Option configures how the annotation is unmarshalled
+type Option func(*GenDoc)
+
+// WithStrict makes unknown annotation keys an error instead of being skipped
+func WithStrict() Option {
+	return func(g *GenDoc) {
+		g.strict = true
+	}
+}
+
+func NewFromToken(token token.Token, log log.Loggeriface, opts ...Option) (GenDoc, error) {
 	g := &GenDoc{raw: token.MetaAnnotation, log: log}
-	return g.new()
+	return g.new(opts...)
 }
 
 // New returns the GenDoc value
 //
 // It should ONLY be extended by caller.
-func New(annotation string, log log.Loggeriface) (GenDoc, error) {
+func New(annotation string, log log.Loggeriface, opts ...Option) (GenDoc, error) {
 	l := &log
 	g := &GenDoc{raw: annotation, log: *l}
-	return g.new()
+	return g.new(opts...)
 }
 
-func (g *GenDoc) new() (GenDoc, error) {
+func (g *GenDoc) new(opts ...Option) (GenDoc, error) {
+	for _, opt := range opts {
+		opt(g)
+	}
 	if err := g.unmarshal(); err != nil {
 		return *g, err
 	}
 	return *g, nil
 }
 
-func wrapErr(msg string, etyp error) error {
-	return fmt.Errorf("%s\n%w", msg, etyp)
-}
-
 var (
 	// ErrUnparseableTag indicates that the string extracted as a possible key/value cannot be parsed as such.
 	ErrUnparseableTag = errors.New("string field cannot be split into a key=value")
 	// ErrZeroLengthKeyOrValue means that either the key or the value has 0 length.
 	ErrZeroLengthKeyOrValue = errors.New("both key and value must be a non-zero length string")
 	// ErrIncorrectCategory indicates that an unknown category has been chosen.
-	ErrIncorrectCategory = errors.New("category type incorrect should be one of ['server','info','channel','operation','message','root']")
+	ErrIncorrectCategory = errors.New("category type incorrect should be one of ['server','info','channel','operation','subOperation','pubOperation','message','root']")
 	// ErrIncorrectType means that wrong type has been specified.
-	ErrIncorrectType = errors.New("content type incorrect should be one of ['json_schema','example','mdescription','title','nameId']")
+	ErrIncorrectType = errors.New("content type incorrect should be one of ['json_schema','example','description','title','summary','nameId']")
+	// ErrIncorrectExpand means that expand is not a boolean.
+	ErrIncorrectExpand = errors.New("expand incorrect should be one of ['true','false']")
+	// ErrIncorrectShared means that shared is not a boolean.
+	ErrIncorrectShared = errors.New("shared incorrect should be one of ['true','false']")
+	// ErrUnknownKey means that the key is not a known annotation key, only returned in strict mode.
+	ErrUnknownKey = errors.New("annotation key is not known")
 )
 
+// annotationKeys are all the keys, including aliases, recognised in an annotation
+var annotationKeys = []string{
+	"id", "parent", "p", "serviceId", "service_id", "channelId", "channel_id",
+	"title", "summary", "description", "ref", "expand", "shared", "type", "category", "cat", "c",
+}
+
+// enumKeys returns the keys of an enum map to suggest from
+func enumKeys[T any](enum map[string]T) []string {
+	keys := make([]string, 0, len(enum))
+	for k := range enum {
+		keys = append(keys, k)
+	}
+	return keys
+}
+
 func (g *GenDoc) unmarshal() error {
-	fields := strings.Fields(string(g.raw))
-	for _, keyvalpair := range fields {
-		if ignore(keyvalpair) {
-			continue
-		}
-		splitv := strings.Split(keyvalpair, "=")
-		if len(splitv) != 2 {
-			g.log.Debugf("value in gendoc tag: %s, cannot be split into a key=value", keyvalpair)
-			return wrapErr(keyvalpair, ErrUnparseableTag)
-		}
-		key, val := splitv[0], splitv[1]
-		if len(key) < 1 || len(val) < 1 {
-			return wrapErr(fmt.Sprintf("key '%s' and value '%s'", key, val), ErrZeroLengthKeyOrValue)
-		}
+	attrs, err := scanAttributes(g.raw)
+	if err != nil {
+		g.log.Debugf("gendoc tag: %s, cannot be split into key=value pairs", g.raw)
+		return err
+	}
+	for _, attr := range attrs {
+		key, val := attr.key, attr.val
 		switch key {
 		case "id":
 			g.Id = val
 		case "parent", "p":
-			g.Parent = val
-		case "serviceId":
-			g.ServiceId = val
-		case "channelId":
-			g.ChannelId = val
+			g.Parent = NewIdList(val)
+		case "serviceId", "service_id":
+			g.ServiceId = NewIdList(val)
+		case "channelId", "channel_id":
+			g.ChannelId = NewIdList(val)
+		case "title":
+			g.Title = val
+		case "summary":
+			g.Summary = val
+		case "description":
+			g.Description = val
+		case "ref":
+			g.Ref = val
+		case "expand":
+			expand, err := strconv.ParseBool(val)
+			if err != nil {
+				return wrapErrAt(g.raw, attr.valPos, fmt.Sprintf("expand: '%s'", val), ErrIncorrectExpand)
+			}
+			g.Expand = &expand
+		case "shared":
+			shared, err := strconv.ParseBool(val)
+			if err != nil {
+				return wrapErrAt(g.raw, attr.valPos, fmt.Sprintf("shared: '%s'", val), ErrIncorrectShared)
+			}
+			g.Shared = shared
 		case "type":
 			found, ok := contentTypeEnum[val]
 			if !ok {
-				return wrapErr(fmt.Sprintf("type: '%s'", val), ErrIncorrectType)
+				return wrapErrAt(g.raw, attr.valPos, fmt.Sprintf("type: '%s'%s", val, DidYouMean(val, enumKeys(contentTypeEnum))), ErrIncorrectType)
 			}
 			g.ContentType = found
 		case "category", "cat", "c":
 			found, ok := categoryTypeEnum[val]
 			if !ok {
-				return wrapErr(fmt.Sprintf("category: '%s'", val), ErrIncorrectCategory)
+				return wrapErrAt(g.raw, attr.valPos, fmt.Sprintf("category: '%s'%s", val, DidYouMean(val, enumKeys(categoryTypeEnum))), ErrIncorrectCategory)
 			}
 			g.CategoryType = found
 		default:
-			g.log.Debugf("the tag key=value pair '%s' is in correct format, unable to match the key '%s' to an existing case", keyvalpair, key)
+			if g.strict {
+				return wrapErrAt(g.raw, attr.pos, fmt.Sprintf("key: '%s'%s", key, DidYouMean(key, annotationKeys)), ErrUnknownKey)
+			}
+			g.log.Debugf("the tag key=value pair '%s=%s' is in correct format, unable to match the key '%s' to an existing case%s", key, val, key, DidYouMean(key, annotationKeys))
 			g.log.Debug("skipping...")
 		}
 	}
@@ -172,6 +293,7 @@ func (g *GenDoc) unmarshal() error {
 
 var commentBlock = map[string]bool{
 	"-->": true,
+	"*/":  true,
 	"#":   true,
 	"##":  true,
 }
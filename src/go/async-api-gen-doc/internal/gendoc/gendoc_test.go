@@ -2,8 +2,10 @@ package gendoc_test
 
 import (
 	"bytes"
+	"encoding/json"
 	"errors"
 	"reflect"
+	"strings"
 	"testing"
 
 	"github.com/dnitsch/async-api-generator/internal/gendoc"
@@ -18,39 +20,105 @@ func Test_GenDoc_marshalled_successfully_from_string(t *testing.T) {
 	}{
 		"when using full property names": {
 			`parent=domain-foo~bar-assigned id=BizContextAreaEvent category=message type=example subscribers=bazquxoperation,bazquxfoo,bazquxbar`,
-			gendoc.GenDoc{Id: "BizContextAreaEvent", Parent: "domain-foo~bar-assigned", CategoryType: gendoc.MessageBlock, ContentType: gendoc.Example},
+			gendoc.GenDoc{Id: "BizContextAreaEvent", Parent: gendoc.IdList{"domain-foo~bar-assigned"}, CategoryType: gendoc.MessageBlock, ContentType: gendoc.Example},
 		},
 		"when using  shorthand property names": {
 			`parent=domain-foo~bar-assigned id=BizContextAreaEvent c=message type=example sbs=bazquxoperation,bazquxfoo,bazquxbar`,
-			gendoc.GenDoc{Id: "BizContextAreaEvent", Parent: "domain-foo~bar-assigned", CategoryType: gendoc.MessageBlock, ContentType: gendoc.Example},
+			gendoc.GenDoc{Id: "BizContextAreaEvent", Parent: gendoc.IdList{"domain-foo~bar-assigned"}, CategoryType: gendoc.MessageBlock, ContentType: gendoc.Example},
 		},
 		"when setting serviceId": {
 			`parent=domain-foo~bar-assigned id=BizContextAreaEvent serviceId=bazquxsample c=message type=example sbs=bazquxoperation,bazquxfoo,bazquxbar producers=bazquxsample`,
 			gendoc.GenDoc{Id: "BizContextAreaEvent",
-				Parent:       "domain-foo~bar-assigned",
+				Parent:       gendoc.IdList{"domain-foo~bar-assigned"},
 				CategoryType: gendoc.MessageBlock,
 				ContentType:  gendoc.Example,
-				ServiceId:    "bazquxsample",
+				ServiceId:    gendoc.IdList{"bazquxsample"},
 			},
 		},
 		"when setting channelId": {
 			`parent=domain-foo~bar-assigned id=BizContextAreaEvent serviceId=bazquxsample channelId=bazquxsample c=message type=example sbs=bazquxoperation,bazquxfoo,bazquxbar producers=bazquxsample`,
 			gendoc.GenDoc{Id: "BizContextAreaEvent",
-				Parent:       "domain-foo~bar-assigned",
+				Parent:       gendoc.IdList{"domain-foo~bar-assigned"},
 				CategoryType: gendoc.MessageBlock,
 				ContentType:  gendoc.Example,
-				ChannelId:    "bazquxsample",
-				ServiceId:    "bazquxsample",
+				ChannelId:    gendoc.IdList{"bazquxsample"},
+				ServiceId:    gendoc.IdList{"bazquxsample"},
 			},
 		},
 		"when including closing comments": {
 			`parent=domain-foo~bar-assigned id=BizContextAreaEvent serviceId=bazquxsample channelId=bazquxsample c=message type=example sbs=bazquxoperation,bazquxfoo,bazquxbar producers=bazquxsample -->`,
 			gendoc.GenDoc{Id: "BizContextAreaEvent",
-				Parent:       "domain-foo~bar-assigned",
+				Parent:       gendoc.IdList{"domain-foo~bar-assigned"},
 				CategoryType: gendoc.MessageBlock,
 				ContentType:  gendoc.Example,
-				ChannelId:    "bazquxsample",
-				ServiceId:    "bazquxsample",
+				ChannelId:    gendoc.IdList{"bazquxsample"},
+				ServiceId:    gendoc.IdList{"bazquxsample"},
+			},
+		},
+		"when using double quoted values with spaces": {
+			`id=OrderCancelled c=message type=description title="Order cancelled event" summary="emitted once an order is cancelled"`,
+			gendoc.GenDoc{Id: "OrderCancelled",
+				CategoryType: gendoc.MessageBlock,
+				ContentType:  gendoc.Description,
+				Title:        "Order cancelled event",
+				Summary:      "emitted once an order is cancelled",
+			},
+		},
+		"when using single quoted values with escapes and equals": {
+			`id=OrderCancelled c=message type=description title='Order \'cancelled\' event' description="see https://foo.bar/docs?a=b&c=d"`,
+			gendoc.GenDoc{Id: "OrderCancelled",
+				CategoryType: gendoc.MessageBlock,
+				ContentType:  gendoc.Description,
+				Title:        "Order 'cancelled' event",
+				Description:  "see https://foo.bar/docs?a=b&c=d",
+			},
+		},
+		"when using array like parent": {
+			`parent=[domain-foo, domain-bar] id=BizContextAreaEvent c=message type=example`,
+			gendoc.GenDoc{Id: "BizContextAreaEvent",
+				Parent:       gendoc.IdList{"domain-foo", "domain-bar"},
+				CategoryType: gendoc.MessageBlock,
+				ContentType:  gendoc.Example,
+			},
+		},
+		"when using snake case aliases with array like values": {
+			`id=bazquxoperation c=operation type=description service_id=[foo,bar] channel_id=[baz]`,
+			gendoc.GenDoc{Id: "bazquxoperation",
+				CategoryType: gendoc.OperationBlock,
+				ContentType:  gendoc.Description,
+				ServiceId:    gendoc.IdList{"foo", "bar"},
+				ChannelId:    gendoc.IdList{"baz"},
+			},
+		},
+		"when referencing an external file": {
+			`id=OrderCancelled c=message type=json_schema ref=./schemas/order.v2.json`,
+			gendoc.GenDoc{Id: "OrderCancelled",
+				CategoryType: gendoc.MessageBlock,
+				ContentType:  gendoc.JSONSchema,
+				Ref:          "./schemas/order.v2.json",
+			},
+		},
+		"when turning off expansion": {
+			`id=OrderCancelled c=message type=description expand=false`,
+			gendoc.GenDoc{Id: "OrderCancelled",
+				CategoryType: gendoc.MessageBlock,
+				ContentType:  gendoc.Description,
+				Expand:       new(bool),
+			},
+		},
+		"when sharing a channel": {
+			`id=orders c=channel type=description shared=true`,
+			gendoc.GenDoc{Id: "orders",
+				CategoryType: gendoc.ChannelBlock,
+				ContentType:  gendoc.Description,
+				Shared:       true,
+			},
+		},
+		"when using unquoted values with equals": {
+			`id=a=b c=message type=description`,
+			gendoc.GenDoc{Id: "a=b",
+				CategoryType: gendoc.MessageBlock,
+				ContentType:  gendoc.Description,
 			},
 		},
 	}
@@ -75,11 +143,11 @@ func Test_Unmarshal_from_token_should_succeed(t *testing.T) {
 		"when using correct annotation": {
 			token.Token{MetaAnnotation: `parent=domain-foo~bar-assigned id=BizContextAreaEvent serviceId=bazquxsample channelId=bazquxsample c=message type=example sbs=bazquxoperation,bazquxfoo,bazquxbar producers=bazquxsample`},
 			gendoc.GenDoc{Id: "BizContextAreaEvent",
-				Parent:       "domain-foo~bar-assigned",
+				Parent:       gendoc.IdList{"domain-foo~bar-assigned"},
 				CategoryType: gendoc.MessageBlock,
 				ContentType:  gendoc.Example,
-				ChannelId:    "bazquxsample",
-				ServiceId:    "bazquxsample",
+				ChannelId:    gendoc.IdList{"bazquxsample"},
+				ServiceId:    gendoc.IdList{"bazquxsample"},
 			},
 		},
 	}
@@ -100,22 +168,40 @@ func testGenDoc(t *testing.T, got gendoc.GenDoc, expect gendoc.GenDoc) {
 
 	// should fail when fields are extended or changed
 	val := reflect.ValueOf(got)
-	if val.NumField() != 12 {
+	if val.NumField() != 19 {
 		t.Fatalf("field was added to the GenDoc struct but tests were not updated, got number of fields: %d", val.NumField())
 	}
 
 	if got.Id != expect.Id {
 		t.Errorf("Id error - got: %v, expected: %v", got.Id, expect.Id)
 	}
-	if got.Parent != expect.Parent {
+	if got.Parent.String() != expect.Parent.String() {
 		t.Errorf("Parent error - got: %v, expected: %v", got.Parent, expect.Parent)
 	}
-	if got.ServiceId != expect.ServiceId {
+	if got.ServiceId.String() != expect.ServiceId.String() {
 		t.Errorf("ServiceId error - got: %v, expected: %v", got.ServiceId, expect.ServiceId)
 	}
-	if got.ChannelId != expect.ChannelId {
+	if got.ChannelId.String() != expect.ChannelId.String() {
 		t.Errorf("ChannelId error - got: %v, expected: %v", got.ChannelId, expect.ChannelId)
 	}
+	if got.Title != expect.Title {
+		t.Errorf("Title error - got: %v, expected: %v", got.Title, expect.Title)
+	}
+	if got.Summary != expect.Summary {
+		t.Errorf("Summary error - got: %v, expected: %v", got.Summary, expect.Summary)
+	}
+	if got.Description != expect.Description {
+		t.Errorf("Description error - got: %v, expected: %v", got.Description, expect.Description)
+	}
+	if got.ShouldExpand() != expect.ShouldExpand() {
+		t.Errorf("ShouldExpand error - got: %v, expected: %v", got.ShouldExpand(), expect.ShouldExpand())
+	}
+	if got.Ref != expect.Ref {
+		t.Errorf("Ref error - got: %v, expected: %v", got.Ref, expect.Ref)
+	}
+	if got.Shared != expect.Shared {
+		t.Errorf("Shared error - got: %v, expected: %v", got.Shared, expect.Shared)
+	}
 }
 
 func Test_Unmarshal_failure(t *testing.T) {
@@ -127,6 +213,13 @@ func Test_Unmarshal_failure(t *testing.T) {
 		"invalid key/pair no value":       {"notvalidKeyPair=", gendoc.ErrZeroLengthKeyOrValue},
 		"invalid category specified":      {"ignored=val id=bar category=nonexistant", gendoc.ErrIncorrectCategory},
 		"invalid type specified":          {"parent=foo ignored=val type=nonexistant", gendoc.ErrIncorrectType},
+		"unterminated quote":              {`id=foo title="not closed`, gendoc.ErrUnterminatedQuote},
+		"unterminated quote on escape":    {`id=foo title="not closed\`, gendoc.ErrUnterminatedQuote},
+		"unknown escape sequence":         {`id=foo title="bad \x escape"`, gendoc.ErrUnknownEscape},
+		"empty quoted value":              {`id=foo title=""`, gendoc.ErrZeroLengthKeyOrValue},
+		"expand not a boolean":            {`id=foo expand=maybe`, gendoc.ErrIncorrectExpand},
+		"shared not a boolean":            {`id=foo shared=yes`, gendoc.ErrIncorrectShared},
+		"unterminated list":               {`id=foo parent=[bar, baz`, gendoc.ErrUnterminatedList},
 	}
 
 	for name, tt := range ttests {
@@ -141,3 +234,83 @@ func Test_Unmarshal_failure(t *testing.T) {
 		})
 	}
 }
+
+func Test_Unmarshal_suggests_nearest(t *testing.T) {
+	ttests := map[string]struct {
+		input   string
+		opts    []gendoc.Option
+		want    error
+		suggest string
+	}{
+		"category typo":          {"id=foo category=chanel", nil, gendoc.ErrIncorrectCategory, "did you mean 'channel'?"},
+		"type typo":              {"id=foo type=descripton", nil, gendoc.ErrIncorrectType, "did you mean 'description'?"},
+		"unknown key in strict":  {"id=foo prent=bar", []gendoc.Option{gendoc.WithStrict()}, gendoc.ErrUnknownKey, "did you mean 'parent'?"},
+		"no suggestion too far":  {"id=foo category=nonexistant", nil, gendoc.ErrIncorrectCategory, ""},
+		"unknown key not strict": {"id=foo prent=bar", nil, nil, ""},
+	}
+	for name, tt := range ttests {
+		t.Run(name, func(t *testing.T) {
+			_, err := gendoc.New(tt.input, log.New(&bytes.Buffer{}, log.DebugLvl), tt.opts...)
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("got: %v, wanted: %v", err, tt.want)
+			}
+			if err == nil {
+				return
+			}
+			if tt.suggest == "" && strings.Contains(err.Error(), "did you mean") {
+				t.Errorf("unexpected suggestion in: %s", err)
+			}
+			if !strings.Contains(err.Error(), tt.suggest) {
+				t.Errorf("got: %s, wanted suggestion: %s", err, tt.suggest)
+			}
+		})
+	}
+}
+
+func Test_Unmarshal_failure_reports_position(t *testing.T) {
+	ttests := map[string]struct {
+		input   string
+		wantPos int
+	}{
+		"bare word":            {"id=foo bar", 7},
+		"unknown category":     {"id=foo category=nonexistant", 16},
+		"unterminated quote":   {`id=foo title="not closed`, 13},
+		"unknown escape":       {`id=foo title="a\x"`, 15},
+		"missing value at end": {"id=foo title=", 7},
+		"after multi-byte":     {`title="Überblick" category=nonexistant`, 27},
+	}
+	for name, tt := range ttests {
+		t.Run(name, func(t *testing.T) {
+			_, err := gendoc.New(tt.input, log.New(&bytes.Buffer{}, log.DebugLvl))
+			annErr := &gendoc.AnnotationError{}
+			if !errors.As(err, &annErr) {
+				t.Fatalf("expected an AnnotationError, got: %v", err)
+			}
+			if annErr.Pos != tt.wantPos {
+				t.Errorf("position got: %d, wanted: %d", annErr.Pos, tt.wantPos)
+			}
+		})
+	}
+}
+
+func Test_IdList_UnmarshalJSON(t *testing.T) {
+	ttests := map[string]struct {
+		input  string
+		expect gendoc.IdList
+	}{
+		"single string":   {`"foo"`, gendoc.IdList{"foo"}},
+		"empty string":    {`""`, nil},
+		"array of string": {`["foo","bar"]`, gendoc.IdList{"foo", "bar"}},
+	}
+	for name, tt := range ttests {
+		t.Run(name, func(t *testing.T) {
+			got := gendoc.IdList{}
+			if err := json.Unmarshal([]byte(tt.input), &got); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.expect) {
+				t.Errorf("got: %v, wanted: %v", got, tt.expect)
+			}
+		})
+	}
+}
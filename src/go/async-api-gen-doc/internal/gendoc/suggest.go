@@ -0,0 +1,83 @@
+package gendoc
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Suggest returns the candidate nearest to the value by edit distance, ignoring case
+//
+// Returns false when none of the candidates is close enough to be a likely typo,
+// i.e. more than a third of the value would have to change.
+func Suggest(val string, candidates []string) (string, bool) {
+	length := len([]rune(val))
+	nearest := Nearest(val, candidates, 1, min(length-1, max(1, length/3)))
+	if len(nearest) == 0 {
+		return "", false
+	}
+	return nearest[0], true
+}
+
+// Nearest returns up to n candidates ordered by edit distance to the value, ignoring case
+//
+// Candidates further than maxDistance and exact matches are left out,
+// candidates at the same distance are ordered alphabetically.
+func Nearest(val string, candidates []string, n, maxDistance int) []string {
+	type scored struct {
+		candidate string
+		distance  int
+	}
+	scores := []scored{}
+	seen := map[string]bool{}
+	for _, candidate := range candidates {
+		if candidate == val || seen[candidate] {
+			continue
+		}
+		seen[candidate] = true
+		if d := editDistance(strings.ToLower(val), strings.ToLower(candidate)); d <= maxDistance {
+			scores = append(scores, scored{candidate, d})
+		}
+	}
+	sort.Slice(scores, func(i, j int) bool {
+		if scores[i].distance != scores[j].distance {
+			return scores[i].distance < scores[j].distance
+		}
+		return scores[i].candidate < scores[j].candidate
+	})
+	nearest := []string{}
+	for i := 0; i < len(scores) && i < n; i++ {
+		nearest = append(nearest, scores[i].candidate)
+	}
+	return nearest
+}
+
+// DidYouMean returns `, did you mean 'x'?` for the nearest candidate or an empty string
+func DidYouMean(val string, candidates []string) string {
+	if suggestion, ok := Suggest(val, candidates); ok {
+		return fmt.Sprintf(", did you mean '%s'?", suggestion)
+	}
+	return ""
+}
+
+// editDistance is the Levenshtein distance between a and b
+func editDistance(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	curr := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		curr[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(rb)]
+}
@@ -0,0 +1,57 @@
+package gendoc_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/dnitsch/async-api-generator/internal/gendoc"
+)
+
+func Test_Suggest(t *testing.T) {
+	candidates := []string{"id", "parent", "p", "category", "description", "channelId", "channel_id"}
+	ttests := map[string]struct {
+		input  string
+		want   string
+		wantOk bool
+	}{
+		"missing letter":       {"prent", "parent", true},
+		"extra letter":         {"mdescription", "description", true},
+		"transposed letters":   {"categroy", "category", true},
+		"case insensitive":     {"channelid", "channelId", true},
+		"too far off":          {"foo", "", false},
+		"single letter":        {"x", "", false},
+		"exact match skipped":  {"parent", "", false},
+		"nearest of two close": {"chanelId", "channelId", true},
+	}
+	for name, tt := range ttests {
+		t.Run(name, func(t *testing.T) {
+			got, ok := gendoc.Suggest(tt.input, candidates)
+			if ok != tt.wantOk || got != tt.want {
+				t.Errorf("got %q %v, wanted %q %v", got, ok, tt.want, tt.wantOk)
+			}
+		})
+	}
+}
+
+func Test_Nearest(t *testing.T) {
+	candidates := []string{"orders", "orders-v2", "order", "refunds", "orders"}
+	ttests := map[string]struct {
+		input       string
+		n           int
+		maxDistance int
+		want        []string
+	}{
+		"ordered by distance":     {"orderz", 3, 4, []string{"order", "orders", "orders-v2"}},
+		"limited to n":            {"orderz", 1, 3, []string{"order"}},
+		"exact match left out":    {"orders", 3, 3, []string{"order", "orders-v2"}},
+		"none within maxDistance": {"payments", 3, 2, []string{}},
+	}
+	for name, tt := range ttests {
+		t.Run(name, func(t *testing.T) {
+			got := gendoc.Nearest(tt.input, candidates, tt.n, tt.maxDistance)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, wanted %v", got, tt.want)
+			}
+		})
+	}
+}
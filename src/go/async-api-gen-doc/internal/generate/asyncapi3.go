@@ -0,0 +1,134 @@
+package generate
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+var ErrUnknownAsyncAPIVersion = errors.New("asyncapi version must be one of 2.6 or 3.0")
+
+// AsyncAPIVersion is the major.minor version of the emitted AsyncAPI documents
+type AsyncAPIVersion string
+
+const (
+	AsyncAPI2 AsyncAPIVersion = "2.6"
+	AsyncAPI3 AsyncAPIVersion = "3.0"
+)
+
+// ParseAsyncAPIVersion returns the version by name, an empty name is AsyncAPI2
+func ParseAsyncAPIVersion(name string) (AsyncAPIVersion, error) {
+	switch v := AsyncAPIVersion(name); v {
+	case "":
+		return AsyncAPI2, nil
+	case AsyncAPI2, AsyncAPI3:
+		return v, nil
+	}
+	return "", fmt.Errorf("asyncapi version '%s': %w", name, ErrUnknownAsyncAPIVersion)
+}
+
+// v3Actions are the AsyncAPI 3 actions of the operations,
+// a pubOperation is sent by the service and a subOperation received
+var v3Actions = map[string]string{ActionPublish: "send", ActionSubscribe: "receive"}
+
+// ToV3 returns the service in the AsyncAPI 3.0 shape
+//
+// Every channel lists the messages of its operations, the operations reference them via their channel.
+// An operation on several channels is suffixed with the channel id, e.g. created-orders.
+func (a *AsyncAPIRoot) ToV3() *AsyncAPIRootV3 {
+	v3, _ := a.toV3()
+	return v3
+}
+
+// toV3 returns the service in the AsyncAPI 3.0 shape
+// and the operationId each operation of the 3.0 document was converted from by its id
+func (a *AsyncAPIRoot) toV3() (*AsyncAPIRootV3, map[string]string) {
+	v3 := &AsyncAPIRootV3{
+		AsyncAPI:           "3.0.0",
+		ID:                 a.ID,
+		DefaultContentType: a.DefaultContentType,
+		Info:               InfoV3{Title: a.Info.Title, Version: a.Info.Version, Description: a.Info.Description, Tags: a.Tags},
+		Channels:           map[string]ChannelV3{},
+		Operations:         map[string]OperationV3{},
+		Components:         &ComponentsV3{Messages: map[string]MessageV3{}},
+		Sources:            a.Sources,
+	}
+	if a.Components != nil {
+		for id, msg := range a.Components.Messages {
+			v3.Components.Messages[id] = messageV3(msg)
+		}
+	}
+	operationIds := map[string]string{}
+	chIds := make([]string, 0, len(a.Channels))
+	for id := range a.Channels {
+		chIds = append(chIds, id)
+	}
+	sort.Strings(chIds)
+	for _, chId := range chIds {
+		ch := a.Channels[chId]
+		channel := ChannelV3{Address: chId, Description: ch.Description, Messages: map[string]Reference{}}
+		for _, msg := range ch.Messages {
+			msgId := messageRefId(msg.Ref)
+			channel.Messages[msgId] = Reference{msg.Ref}
+		}
+		for _, op := range ch.Operations {
+			action, ok := v3Actions[op.Action]
+			if !ok {
+				continue
+			}
+			operation := OperationV3{Action: action, Channel: Reference{jsonPointer("channels", chId)}, Summary: op.Summary, Description: op.Description}
+			for _, msg := range a.operationRefs(op) {
+				msgId := messageRefId(msg.Ref)
+				channel.Messages[msgId] = Reference{msg.Ref}
+				operation.Messages = append(operation.Messages, Reference{jsonPointer("channels", chId, "messages", msgId)})
+			}
+			id := op.OperationId
+			if _, taken := v3.Operations[id]; taken {
+				id = op.OperationId + "-" + chId
+			}
+			v3.Operations[id] = operation
+			operationIds[id] = op.OperationId
+		}
+		v3.Channels[chId] = channel
+	}
+	return v3, operationIds
+}
+
+// operationRefs returns the references to the messages of the operation
+func (a *AsyncAPIRoot) operationRefs(op *Operation) []*Message {
+	if op.Message == nil {
+		return nil
+	}
+	if len(op.Message.OneOf) > 0 {
+		return op.Message.OneOf
+	}
+	return []*Message{op.Message}
+}
+
+func messageV3(msg Message) MessageV3 {
+	return MessageV3{
+		Name:        msg.MessageId,
+		Title:       msg.Title,
+		Summary:     msg.Summary,
+		Description: msg.Description,
+		ContentType: "application/json",
+		Payload:     msg.Payload,
+		Examples:    msg.Examples,
+	}
+}
+
+// jsonPointer returns the local reference to the path, escaping each segment
+func jsonPointer(segments ...string) string {
+	escaped := make([]string, len(segments))
+	for i, s := range segments {
+		escaped[i] = strings.NewReplacer("~", "~0", "/", "~1").Replace(s)
+	}
+	return "#/" + strings.Join(escaped, "/")
+}
+
+// messageRefId returns the id of the message in the components the reference points to
+func messageRefId(ref string) string {
+	id := strings.TrimPrefix(ref, componentMessagesRef)
+	return strings.NewReplacer("~1", "/", "~0", "~").Replace(id)
+}
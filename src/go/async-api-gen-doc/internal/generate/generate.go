@@ -16,14 +16,17 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
+	"slices"
 	"sort"
 	"strings"
 	"sync"
 
 	log "github.com/dnitsch/simplelog"
 
+	"github.com/dnitsch/async-api-generator/internal/diag"
 	"github.com/dnitsch/async-api-generator/internal/fshelper"
 	"github.com/dnitsch/async-api-generator/internal/gendoc"
 	"github.com/dnitsch/async-api-generator/internal/lexer"
@@ -39,6 +42,14 @@ type Generate struct {
 	inputs    []Input
 	processed *Processed
 	tree      *parser.GenDocTree
+	conflicts diag.Diagnostics
+	// combined are the operations combined into another on a channel of an AsyncAPI 2.6 document
+	combined diag.Diagnostics
+	// shared are the ids of the channels shared across services
+	shared map[string]bool
+	// partial are the leaves attached under only some of their listed parents,
+	// the others are looked up again on each orphan pass
+	partial []*parser.GenDocNode
 }
 
 // Config holds the parser config
@@ -46,7 +57,15 @@ type Config struct {
 	InterimOutputDir string // temp interim dir for storage of interim or processed files
 	DownloadDir      string // temp dir for any remote downloads
 	SearchDirName    string
+	Mode             parser.AnalysisMode // in Validate mode the AsyncAPI is rendered in memory only
+	MergePolicy      MergePolicy         // how conflicting values for the same field are merged, defaults to MergeLastWins
+	AsyncAPIVersion  AsyncAPIVersion     // the version of the emitted AsyncAPI documents, defaults to AsyncAPI2
+	Format           Format              // the serialisation of the emitted AsyncAPI documents, defaults to FormatYAML
+	TemplateDir      string              // templates overriding or added to the embedded ones, the documents are rendered with templates when this or Template is set
+	Template         string              // the template the documents are rendered with, defaults to the embedded template of the AsyncAPIVersion
 	ParserConfig     parser.Config
+	LexerConfig      *lexer.Config // nillable, the built-in marker keyword and comment syntaxes are used when not set
+	Environ          []string      // variables available for expansion in the content, in the form of os.Environ. Defaults to the process environment when nil
 	Output           *storage.Conf // nillable for now to optionally write to remote
 	// Note: other properties can go here
 	// perhaps better to use the options pattern
@@ -63,10 +82,11 @@ type SampleContent struct {
 
 // Input contains additional info about the content to be lexed => parsed
 // Such as the FileName, TODO: add more
+//
+// The content is read from FullPath only when the input is processed.
 type Input struct {
 	FileName      string
 	FullPath      string
-	Content       string
 	SchemaContent *SchemaContent
 	SampleContent *SampleContent
 }
@@ -88,8 +108,7 @@ func New(config *Config, log log.Loggeriface) *Generate {
 func (g *Generate) LoadInputsFromFiles(inputs []*fshelper.FileList) {
 
 	for _, input := range inputs {
-		b, _ := os.ReadFile(input.Path)
-		i := Input{Content: string(b), FileName: input.Name, FullPath: input.Path}
+		i := Input{FileName: input.Name, FullPath: input.Path}
 		// crude condition to ensure we capture the contents of schema files if not defined inline
 		// TODO: add schema files to orphaned >> schemas >> event_name
 		if strings.Contains(input.Path, ".schema.json") {
@@ -109,8 +128,22 @@ func (p Processed) Len() int      { return len(p) }
 func (p Processed) Swap(i, j int) { p[i], p[j] = p[j], p[i] }
 
 // Less is a specific sorter func for Processed
-// NodeCategory holds the key to precedence
-func (p Processed) Less(i, j int) bool { return p[i].NodeCategory < p[j].NodeCategory }
+// NodeCategory holds the key to precedence,
+// blocks of the same category are ordered by source path and position
+// so that the tree is always built in the same order.
+func (p Processed) Less(i, j int) bool {
+	a, b := p[i], p[j]
+	if a.NodeCategory != b.NodeCategory {
+		return a.NodeCategory < b.NodeCategory
+	}
+	if a.Token.Source.Path != b.Token.Source.Path {
+		return a.Token.Source.Path < b.Token.Source.Path
+	}
+	if a.Token.Line != b.Token.Line {
+		return a.Token.Line < b.Token.Line
+	}
+	return a.Token.Column < b.Token.Column
+}
 
 // Processed returns Processed items
 func (g *Generate) Processed() *Processed {
@@ -133,10 +166,15 @@ var ErrGenDocBlox = errors.New("GenDocBlox failed to parse all documents")
 func (g *Generate) GenDocBlox() error {
 	prcsd := Processed{}
 	parserConfig := g.config.ParserConfig
-	errored := ""
+	lexerConfig := g.config.LexerConfig
+	if lexerConfig == nil {
+		lexerConfig = lexer.DefaultConfig()
+	}
+	diags := diag.Diagnostics{}
 	// parserChan used to hold result across goroutines
 	// it can be encapsulated within this func
 	type parserChan struct {
+		idx       int
 		err       error
 		generated []parser.GenDocBlock
 	}
@@ -156,63 +194,10 @@ func (g *Generate) GenDocBlox() error {
 		semaphoreChannel <- struct{}{}
 		go func(input Input, wg *sync.WaitGroup, idx int, sem chan struct{}) {
 			defer wg.Done()
-			if input.SchemaContent != nil {
-				schemaBlock := []parser.GenDocBlock{
-					{
-						Token:        token.Token{Type: token.MESSAGE, Source: token.Source{File: input.FileName, Path: input.FullPath}, Literal: "", Line: 0, Column: 0},
-						Value:        input.Content,
-						NodeCategory: parser.MessageNode,
-						Annotation: gendoc.GenDoc{
-							Id: input.SchemaContent.EventId,
-							// TODO: perhaps strip the version suffix from the message schema name
-							// so that an operation parent can be found.
-							// OR maybe we want to version the operations also
-							// Parent:      input.SchemaContent.EventId,
-							ContentType: gendoc.JSONSchema, CategoryType: gendoc.MessageBlock},
-					},
-				}
-				// read from semaphore in case of schema file
-				<-semaphoreChannel
-				genCh <- parserChan{generated: schemaBlock}
-				return
-			}
-
-			if input.SampleContent != nil {
-				sampleBlock := []parser.GenDocBlock{
-					{
-						Token:        token.Token{Type: token.MESSAGE, Source: token.Source{File: input.FileName, Path: input.FullPath}, Literal: "", Line: 0, Column: 0},
-						Value:        input.Content,
-						NodeCategory: parser.MessageNode,
-						Annotation: gendoc.GenDoc{
-							Id: input.SampleContent.EventId,
-							// TODO: perhaps strip the version suffix from the message schema name
-							// so that an operation parent can be found.
-							// OR maybe we want to version the operations also
-							// Parent:      input.SchemaContent.EventId,
-							ContentType: gendoc.Example, CategoryType: gendoc.MessageBlock},
-					},
-				}
-				// read from semaphore in case of schema file
-				<-semaphoreChannel
-				genCh <- parserChan{generated: sampleBlock}
-				return
-			}
-
-			l := lexer.New(lexer.Source{Input: input.Content, FileName: input.FileName, FullPath: input.FullPath})
-			// pass in global config into the parser
-			// with additional file/content info
-			// as well as env info - e.g. name of service
-			p := parser.New(l, &parserConfig).WithLogger(g.log)
-			parsed, errs := p.InitialParse()
-			if len(errs) > 0 {
-				// read from semaphore in case of error
-				<-semaphoreChannel
-				genCh <- parserChan{err: fmt.Errorf("%v", errs)}
-				return // trigger deffered
-			}
+			generated, err := parseInput(input, lexerConfig, parserConfig, g.config.Environ, g.log)
 			// read from semaphore
 			<-sem
-			genCh <- parserChan{generated: parsed}
+			genCh <- parserChan{idx: idx, err: err, generated: generated}
 		}(input, &wg, idx, semaphoreChannel)
 	}
 
@@ -224,25 +209,102 @@ func (g *Generate) GenDocBlox() error {
 	}()
 
 	// range over a unbuffered channel
-	// will contain [][]Generated{}
+	// results are kept by input index as goroutines complete in any order
+	results := make([]parserChan, len(g.inputs))
 	for gc := range genCh {
+		results[gc.idx] = gc
+	}
+	for _, gc := range results {
 		if gc.err != nil {
-			errored += gc.err.Error() + "\n"
+			diags = append(diags, diag.Collect(gc.err)...)
 		}
 		// append slice to existing slice
 		prcsd = append(prcsd, gc.generated...)
 	}
 
-	if len(errored) > 0 {
-		return fmt.Errorf("\n%s%w", errored, ErrGenDocBlox)
+	if diags.HasErrors() {
+		return fmt.Errorf("\n%w%w", diags, ErrGenDocBlox)
 	}
 
-	sort.Sort(prcsd)
+	sort.Stable(prcsd)
 	g.processed = &prcsd
 
 	return nil
 }
 
+// parseInput generates the GenDocBlocks from a single input
+//
+// Schema and sample files are taken as a whole.
+// Any other file is first scanned for gendoc markers and
+// only streamed through the lexer => parser when at least one is found.
+func parseInput(input Input, lexerConfig *lexer.Config, parserConfig parser.Config, environ []string, log log.Loggeriface) ([]parser.GenDocBlock, error) {
+	if input.SchemaContent != nil || input.SampleContent != nil {
+		b, err := os.ReadFile(input.FullPath)
+		if err != nil {
+			return nil, inputErr(input, err)
+		}
+		block := wholeFileBlock(input, string(b))
+		block.Origin = parserConfig.ServiceId
+		return []parser.GenDocBlock{block}, nil
+	}
+
+	f, err := os.Open(input.FullPath)
+	if err != nil {
+		return nil, inputErr(input, err)
+	}
+	defer f.Close()
+
+	found, err := lexerConfig.ContainsMarker(f)
+	if err != nil {
+		return nil, inputErr(input, err)
+	}
+	if !found {
+		log.Debugf("skipping %s, no gendoc markers found", input.FullPath)
+		return nil, nil
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return nil, inputErr(input, err)
+	}
+
+	l := lexer.New(lexer.Source{Input: f, FileName: input.FileName, FullPath: input.FullPath}).WithConfig(lexerConfig)
+	// pass in global config into the parser
+	// with additional file/content info
+	// as well as env info - e.g. name of service
+	p := parser.New(l, &parserConfig).WithLogger(log)
+	if environ != nil {
+		p = p.WithEnvironment(environ)
+	}
+	parsed, errs := p.InitialParse()
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	return parsed, nil
+}
+
+// inputErr positions an error which is not tied to a line, e.g. a failed read, at the input file
+func inputErr(input Input, err error) error {
+	return &diag.Diagnostic{File: input.FileName, Path: input.FullPath, Severity: diag.SeverityError, Err: err}
+}
+
+// wholeFileBlock creates a message block from a schema or sample file
+func wholeFileBlock(input Input, content string) parser.GenDocBlock {
+	block := parser.GenDocBlock{
+		Token:        token.Token{Type: token.MESSAGE, Source: token.Source{File: input.FileName, Path: input.FullPath}, Literal: "", Line: 0, Column: 0},
+		Value:        content,
+		NodeCategory: parser.MessageNode,
+	}
+	// TODO: perhaps strip the version suffix from the message schema name
+	// so that an operation parent can be found.
+	// OR maybe we want to version the operations also
+	// Parent:      input.SchemaContent.EventId,
+	if input.SchemaContent != nil {
+		block.Annotation = gendoc.GenDoc{Id: input.SchemaContent.EventId, ContentType: gendoc.JSONSchema, CategoryType: gendoc.MessageBlock}
+		return block
+	}
+	block.Annotation = gendoc.GenDoc{Id: input.SampleContent.EventId, ContentType: gendoc.Example, CategoryType: gendoc.MessageBlock}
+	return block
+}
+
 func (g *Generate) Tree() *parser.GenDocTree {
 	return g.tree
 }
@@ -251,6 +313,8 @@ func (g *Generate) Tree() *parser.GenDocTree {
 func (g *Generate) BuildContextTree() error {
 	ntrie := parser.NewGenDocTree()
 	g.tree = ntrie
+	g.shared = sharedChannels(g.processed)
+	g.partial = nil
 	g.buildTree()
 
 	g.secondPassExhaustive()
@@ -267,13 +331,13 @@ func (g *Generate) buildTree() {
 		case parser.ServiceNode:
 			assignServiceNode(g.tree, v)
 		case parser.ChannelNode:
-			assingParentedNode(g.tree, v, parser.ChannelNode)
+			g.assingParentedNode(v, parser.ChannelNode)
 		case parser.OperationNode:
-			assingParentedNode(g.tree, v, parser.OperationNode)
+			g.assingParentedNode(v, parser.OperationNode)
 		case parser.MessageNode:
 			// TODO: message is a special case where a parent can also be looked up by channel
 			// potential unparented messages canb belong to a channel
-			assingParentedNode(g.tree, v, parser.MessageNode)
+			g.assingParentedNode(v, parser.MessageNode)
 		}
 	}
 }
@@ -283,7 +347,7 @@ func (g *Generate) buildTree() {
 // or we create a new branch
 func assignServiceNode(tree *parser.GenDocTree, v parser.GenDocBlock) {
 	key := parser.NewGenDocNodeKey(parser.ServiceNode, v.Annotation.Id)
-	leaf := parser.NewGenDocNode(&v).WithKey(parser.PreMergeKeyValSuffix(key))
+	leaf := parser.NewGenDocNode(&v).WithKey(leafKey(tree, key, &v))
 	leaf.IsLeaf = true
 
 	node := tree.FindNode(key)
@@ -301,33 +365,60 @@ func assignServiceNode(tree *parser.GenDocTree, v parser.GenDocBlock) {
 	}
 }
 
-func assingParentedNode(tree *parser.GenDocTree, v parser.GenDocBlock, cat parser.NodeCategory) {
+func (g *Generate) assingParentedNode(v parser.GenDocBlock, cat parser.NodeCategory) {
 	key := parser.NewGenDocNodeKey(cat, v.Annotation.Id)
 
-	// conceptual parent - e.g. a specific channel specified on a operation annotation
-	parent := tree.FindNode(parser.NewGenDocNodeKey(key.Typ-1, v.Annotation.Parent))
-
 	// create a leaf for later merging
-	leaf := parser.NewGenDocNode(&v).WithKey(parser.PreMergeKeyValSuffix(key))
+	leaf := parser.NewGenDocNode(&v).WithKey(leafKey(g.tree, key, &v))
 	leaf.IsLeaf = true
-	if parent != nil {
-		// parent is found
-		cn := tree.FindNode(key)
-		if cn != nil {
-			// node already exists
-			// add only leaf to sort out later via possible merging
-			tree.AddNode(leaf, cn)
-		} else {
+
+	// conceptual parents - e.g. a specific channel specified on a operation annotation
+	// the block is attached under every listed parent
+	parents, unresolved := g.findParents(&v, cat)
+	if len(parents) == 0 {
+		orpahnedBranch := g.tree.OrhpanedBranch()
+		g.tree.AddNode(leaf, orpahnedBranch)
+		return
+	}
+	g.attachUnderParents(leaf, cat, parents)
+	if len(unresolved) > 0 {
+		g.partial = append(g.partial, leaf)
+	}
+}
+
+// leafKey returns the pre merge key of the block
+//
+// Identical blocks at the same position, e.g. the same file in the interim states of two repos,
+// are numbered in processing order so that neither overwrites the other in the index.
+func leafKey(tree *parser.GenDocTree, key *parser.GenDocNodeKey, block *parser.GenDocBlock) *parser.GenDocNodeKey {
+	leaf := parser.PreMergeKeyValSuffix(key, block)
+	unique := *leaf
+	for i := 1; tree.FindNode(&unique) != nil; i++ {
+		unique.Val = fmt.Sprintf("%s-%d", leaf.Val, i)
+	}
+	return &unique
+}
+
+// attachUnderParents adds the leaf to its owning node under each of the parents.
+//
+// The owning node is created if it does not exist yet
+// and it is linked under each of the parents it is not already under.
+// Parents in different namespaces each get their own owning node.
+func (g *Generate) attachUnderParents(leaf *parser.GenDocNode, cat parser.NodeCategory, parents []*parser.GenDocNode) {
+	for _, parent := range parents {
+		key := g.ownerKey(leaf.Value, cat, parent)
+		cn := g.tree.FindNode(key)
+		if cn == nil {
 			// node does not exists
-			// add only leaf to sort out later via possible merging
-			new := parser.NewGenDocNode(&v).WithKey(key)
-			tree.AddNode(new, parent)
-			// add child to appropriate  parent
-			tree.AddNode(leaf, new)
+			cn = parser.NewGenDocNode(leaf.Value).WithKey(key)
+		}
+		if !parent.HasChild(key) {
+			g.tree.AddNode(cn, parent)
+		}
+		// add only leaf to sort out later via possible merging
+		if !cn.HasChild(&leaf.Index) {
+			g.tree.AddNode(leaf, cn)
 		}
-	} else {
-		orpahnedBranch := tree.OrhpanedBranch()
-		tree.AddNode(leaf, orpahnedBranch)
 	}
 }
 
@@ -335,49 +426,65 @@ func assingParentedNode(tree *parser.GenDocTree, v parser.GenDocBlock, cat parse
 func (g *Generate) findOrphansNonLeafOwner() {
 	// looking for parents for orphans
 	// which may not have been assigned the first time around
-	if len(g.tree.OrhpanedBranch().Children) > 0 {
-		for _, orphanNode := range g.tree.OrhpanedBranch().Children {
-			// assign to owner if exists
-			nonLeafIndexVal := strings.Split(orphanNode.Index.Val, parser.LEAF_SUFFIX)
-			nonleafOwner := g.tree.FindNode(parser.NewGenDocNodeKey(orphanNode.Index.Typ, nonLeafIndexVal[0]))
-			if nonleafOwner != nil {
-				node := parser.NewGenDocNode(orphanNode.Value).WithKey(&orphanNode.Index)
-				g.tree.AddNode(node, nonleafOwner)
-				// delete from orphaned branch tree
-				g.tree.DeleteNode(&orphanNode.Index)
+	//
+	// iterating over a copy as the orphaned branch is modified in the loop
+	for _, orphanNode := range slices.Clone(g.tree.OrhpanedBranch().Children) {
+		// assign to owner if exists
+		nonLeafIndexVal := strings.Split(orphanNode.Index.Val, parser.LEAF_SUFFIX)
+		owners, _ := g.resolve(orphanNode.Value, orphanNode.Index.Typ, nonLeafIndexVal[0])
+		for i, owner := range owners {
+			if i == 0 {
+				// move from orphaned branch tree
+				g.tree.MoveNode(orphanNode, owner)
+				continue
 			}
+			g.tree.AddNode(orphanNode, owner)
 		}
 	}
 }
 
 func (g *Generate) findOrphansParents() {
-	if len(g.tree.OrhpanedBranch().Children) > 0 {
-		for _, orphanNode := range g.tree.OrhpanedBranch().Children {
-			parent := g.tree.FindNode(parser.NewGenDocNodeKey(orphanNode.Index.Typ-1, orphanNode.Value.Annotation.Parent))
-			if parent != nil {
-				node := parser.NewGenDocNode(orphanNode.Value)
-				g.tree.AddNode(node, parent)
-				// delete from orphaned branch tree
-				g.tree.DeleteNode(&orphanNode.Index)
+	for _, orphanNode := range slices.Clone(g.tree.OrhpanedBranch().Children) {
+		parents, unresolved := g.findParents(orphanNode.Value, orphanNode.Index.Typ)
+		if len(parents) > 0 {
+			// delete from orphaned branch tree
+			g.tree.DeleteNode(&orphanNode.Index)
+			g.attachUnderParents(orphanNode, orphanNode.Index.Typ, parents)
+			if len(unresolved) > 0 {
+				g.partial = append(g.partial, orphanNode)
 			}
 		}
 	}
 }
 
+// findPartialParents attaches the leaves attached under only some of their parents
+// under those of the other parents which are in the tree by now
+func (g *Generate) findPartialParents() {
+	partial := []*parser.GenDocNode{}
+	for _, leaf := range g.partial {
+		parents, unresolved := g.findParents(leaf.Value, leaf.Index.Typ)
+		g.attachUnderParents(leaf, leaf.Index.Typ, parents)
+		if len(unresolved) > 0 {
+			partial = append(partial, leaf)
+		}
+	}
+	g.partial = partial
+}
+
 // secondPassExhaustive performs an exhaustive recursion
 // going over orphans/and findparents _until_ there are
-// no changes to the number of orphans in the tree
+// no changes to the number of orphans and partially attached leaves in the tree
 //
 // There is _nothing_ wrong with orphans in the tree.
 // Commonly caused by generated schemas/samples
 func (g *Generate) secondPassExhaustive() {
 
 	// if no orphans then we return straight away
-	current, last, pass := len(g.tree.OrhpanedBranch().Children), 0, 0
+	current, last, pass := g.unattached(), 0, 0
 
 	for current != last {
 		pass += 1
-		last = len(g.tree.OrhpanedBranch().Children)
+		last = current
 		// Looking for NonLeafOwners
 		// i.e. a summary or description or payload of an
 		// operation/message/channel
@@ -388,66 +495,165 @@ func (g *Generate) secondPassExhaustive() {
 		// look for new parents
 		// Note: maybe this goes before owner siblings
 		g.findOrphansParents()
-		current = len(g.tree.OrhpanedBranch().Children)
-		g.log.Debugf("PASS: %d, found: %d orphans", pass, current)
+		g.findPartialParents()
+		current = g.unattached()
+		g.log.Debugf("PASS: %d, found: %d orphans and %d partially attached", pass, len(g.tree.OrhpanedBranch().Children), len(g.partial))
 	}
 	g.log.Debugf("Exit after: %d passes", pass)
 }
 
+// unattached returns the number of orphans and of leaves attached under only some of their parents
+func (g *Generate) unattached() int {
+	return len(g.tree.OrhpanedBranch().Children) + len(g.partial)
+}
+
 // TODO: message nodes should maybe go into a special pool...
 
 // ConvertProcessed
 func (g *Generate) ConvertProcessed() error {
 	sortedProcessed := Processed{}
 	for _, v := range g.inputs {
-		gendocblox := new([]parser.GenDocBlock)
-		if err := json.Unmarshal([]byte(v.Content), gendocblox); err != nil {
+		gendocblox, err := decodeInterimState(v.FullPath)
+		if err != nil {
 			return err
 		}
-		sortedProcessed = append(sortedProcessed, *gendocblox...)
+		sortedProcessed = append(sortedProcessed, gendocblox...)
 	}
-	sort.Sort(sortedProcessed)
+	sort.Stable(sortedProcessed)
 	g.processed = &sortedProcessed
 	return nil
 }
 
-func (g *Generate) AsyncAPIFromProcessedTree() error {
-	orphans := g.Tree().OrhpanedBranch().Children
-	if len(orphans) > 0 {
-		for orphan := 0; orphan < len(orphans); orphan++ {
-			g.log.Infof("_ORPHAN_ IdxType:%v IdxVal: %v", orphans[orphan].Index.Typ, orphans[orphan].Index.Val)
-		}
+// decodeInterimState streams the GenDocBlocks from an interim state file
+func decodeInterimState(path string) ([]parser.GenDocBlock, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	gendocblox := []parser.GenDocBlock{}
+	if err := json.NewDecoder(f).Decode(&gendocblox); err != nil {
+		return nil, err
 	}
-	serviceRoots := []*AsyncAPIRoot{}
+	return gendocblox, nil
+}
+
+// Service pairs a service node of the context tree with the AsyncAPI constructed from it
+type Service struct {
+	Node     *parser.GenDocNode
+	AsyncAPI *AsyncAPIRoot
+	// Conflicts are the fields of the service documented with conflicting values
+	Conflicts []Conflict
+}
+
+// Services constructs the AsyncAPI of every service in the parented tree
+func (g *Generate) Services() ([]Service, error) {
+	services := []Service{}
 	for _, node := range g.Tree().ParentedBranch().Children {
 		cn := node
-		asyncRoot, err := ConstructService(g.config, cn)
+		asyncRoot, conflicts, err := constructService(g.config, cn)
 		if err != nil {
-			return err
+			return nil, err
 		}
-		serviceRoots = append(serviceRoots, asyncRoot)
+		services = append(services, Service{Node: cn, AsyncAPI: asyncRoot, Conflicts: conflicts})
 	}
+	return services, nil
+}
 
-	tp, err := NewTemplateProcessor()
+// Conflicts returns the fields documented with conflicting values by AsyncAPIFromProcessedTree
+//
+// A node linked under several services is only reported once.
+func (g *Generate) Conflicts() diag.Diagnostics {
+	return g.conflicts
+}
 
+// CombinedOperations returns the operations combined into another of the same action on their channel
+// by AsyncAPIFromProcessedTree, none when emitting AsyncAPI 3.0 which keeps each operation
+//
+// An operation linked under several services is only reported once.
+func (g *Generate) CombinedOperations() diag.Diagnostics {
+	return g.combined
+}
+
+func (g *Generate) AsyncAPIFromProcessedTree() error {
+	orphans := g.Tree().OrhpanedBranch().Children
+	if len(orphans) > 0 {
+		for orphan := 0; orphan < len(orphans); orphan++ {
+			g.log.Infof("_ORPHAN_ IdxType:%v IdxVal: %v", orphans[orphan].Index.Typ, orphans[orphan].Index.Val)
+		}
+	}
+	services, err := g.Services()
 	if err != nil {
 		return err
 	}
-	return g.templateRoots(tp, serviceRoots)
+	g.conflicts, g.combined = diag.Diagnostics{}, diag.Diagnostics{}
+	reported := map[string]bool{}
+	for _, srv := range services {
+		for _, c := range srv.Conflicts {
+			if d := c.Diagnostic(); !reported[d.Error()] {
+				reported[d.Error()] = true
+				g.conflicts = append(g.conflicts, d)
+			}
+		}
+		if g.config.AsyncAPIVersion == AsyncAPI3 {
+			continue
+		}
+		for _, d := range combinedOperations(srv) {
+			if !reported[d.Error()] {
+				reported[d.Error()] = true
+				g.combined = append(g.combined, d)
+			}
+		}
+	}
+
+	return g.renderServices(services)
 }
 
-func (g *Generate) templateRoots(tp TemplateProcessor, serviceRoots []*AsyncAPIRoot) error {
-	for _, srvRoot := range serviceRoots {
-		srv := srvRoot
-		// generate new writer
-		out := filepath.Join(g.config.InterimOutputDir, fmt.Sprintf("%s.yml", srv.ID))
-		g.log.Debugf("writing file to: %s", out)
-		f, err := os.Create(out)
+// renderServices writes the document of each service,
+// marshalled in the format or rendered with the templates when a template dir or entry template is set
+//
+// Fails under ErrInvalidDocument when a document does not match the AsyncAPI schema of its version.
+func (g *Generate) renderServices(services []Service) error {
+	render := func(w io.Writer, srv Service) error {
+		return Render(w, srv.AsyncAPI, g.config.AsyncAPIVersion, g.config.Format)
+	}
+	ext := g.config.Format.Ext()
+	if g.config.TemplateDir != "" || g.config.Template != "" {
+		tp, err := NewTemplateProcessorFromDir(g.config.TemplateDir, g.config.Template)
 		if err != nil {
 			return err
 		}
-
-		if err := tp.GenerateFromRoot(f, *srv); err != nil {
+		render = func(w io.Writer, srv Service) error {
+			return tp.GenerateService(w, srv, g.config.AsyncAPIVersion)
+		}
+		ext = filepath.Ext(tp.Entry(g.config.AsyncAPIVersion))
+	}
+	// every document is validated before any is written, an invalid document fails the run
+	docs := make([][]byte, len(services))
+	diags := diag.Diagnostics{}
+	for i, srv := range services {
+		buf := &bytes.Buffer{}
+		if err := render(buf, srv); err != nil {
+			return err
+		}
+		invalid, err := g.validateDocument(srv, buf.Bytes(), ext)
+		if err != nil {
+			return err
+		}
+		diags = append(diags, invalid...)
+		docs[i] = buf.Bytes()
+	}
+	if len(diags) > 0 {
+		return fmt.Errorf("\n%w%w", diags, ErrInvalidDocument)
+	}
+	// in Validate mode the documents are rendered only to surface any errors
+	if g.config.Mode == parser.Validate {
+		return nil
+	}
+	for i, srv := range services {
+		out := filepath.Join(g.config.InterimOutputDir, srv.AsyncAPI.ID+ext)
+		g.log.Debugf("writing file to: %s", out)
+		if err := os.WriteFile(out, docs[i], 0o644); err != nil {
 			return err
 		}
 	}
@@ -2,11 +2,21 @@ package generate_test
 
 import (
 	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
 	"testing"
 
+	"github.com/dnitsch/async-api-generator/internal/diag"
 	"github.com/dnitsch/async-api-generator/internal/fshelper"
+	"github.com/dnitsch/async-api-generator/internal/gendoc"
 	"github.com/dnitsch/async-api-generator/internal/generate"
 	"github.com/dnitsch/async-api-generator/internal/parser"
+	"github.com/dnitsch/async-api-generator/internal/token"
 	log "github.com/dnitsch/simplelog"
 )
 
@@ -41,3 +51,263 @@ func Test_SAMPLE_Error_in_single_file_should_fail_all(t *testing.T) {
 		t.Fatalf("got: %v, wanted: <nil>", g.Processed())
 	}
 }
+
+func Test_BuildContextTree_attaches_block_under_every_parent(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"svc_a.yml": "#+gendoc category=info type=description id=svc-a\n# service a\n#-gendoc\n",
+		"svc_b.yml": "#+gendoc category=info type=description id=svc-b\n# service b\n#-gendoc\n",
+		"topic.tf": `#+gendoc category=channel type=description id=shared-topic parent=[svc-a, svc-b]
+# shared topic
+#-gendoc
+#+gendoc category=operation type=description id=shared-topic channelId=shared-topic
+# operation on shared topic
+#-gendoc
+`,
+	}
+	inputs := []*fshelper.FileList{}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		inputs = append(inputs, &fshelper.FileList{Name: name, Path: path})
+	}
+
+	g := generate.New(&generate.Config{ParserConfig: parser.Config{ServiceId: "svc-a"}}, log.New(&bytes.Buffer{}, log.ErrorLvl))
+	g.LoadInputsFromFiles(inputs)
+	if err := g.GenDocBlox(); err != nil {
+		t.Fatal(err)
+	}
+	if err := g.BuildContextTree(); err != nil {
+		t.Fatal(err)
+	}
+
+	channelKey := parser.NewGenDocNodeKey(parser.ChannelNode, "shared-topic")
+	for _, srv := range []string{"svc-a", "svc-b"} {
+		srvNode := g.Tree().FindNode(parser.NewGenDocNodeKey(parser.ServiceNode, srv))
+		if srvNode == nil {
+			t.Fatalf("service node %s not found", srv)
+		}
+		if !srvNode.HasChild(channelKey) {
+			t.Errorf("service %s is missing the shared channel", srv)
+		}
+	}
+	if len(g.Tree().OrhpanedBranch().Children) != 0 {
+		t.Errorf("got %d orphans, wanted none", len(g.Tree().OrhpanedBranch().Children))
+	}
+}
+
+func Test_BuildContextTree_attaches_block_under_parents_processed_after_it(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"svc.yml": "#+gendoc category=info type=description id=svc\n# service\n#-gendoc\n",
+		"topic.tf": `#+gendoc category=channel type=description id=orders
+# orders
+#-gendoc
+#+gendoc category=pubOperation type=description id=placed channelId=orders
+# placed
+#-gendoc
+#+gendoc category=pubOperation type=description id=amended channelId=orders
+# amended
+#-gendoc
+#+gendoc category=message type=description id=order parent=[placed, amended]
+# order
+#-gendoc
+`,
+	}
+	inputs := []*fshelper.FileList{}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		inputs = append(inputs, &fshelper.FileList{Name: name, Path: path})
+	}
+
+	g := generate.New(&generate.Config{ParserConfig: parser.Config{ServiceId: "svc"}}, log.New(&bytes.Buffer{}, log.ErrorLvl))
+	g.LoadInputsFromFiles(inputs)
+	if err := g.GenDocBlox(); err != nil {
+		t.Fatal(err)
+	}
+	// the amended operation is processed after the message listing it,
+	// i.e. when the message is attached only its placed parent is in the tree
+	processed := *g.Processed()
+	i := slices.IndexFunc(processed, func(b parser.GenDocBlock) bool { return b.Annotation.Id == "amended" })
+	*g.Processed() = append(append(slices.Clone(processed[:i]), processed[i+1:]...), processed[i])
+	if err := g.BuildContextTree(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, op := range []string{"placed", "amended"} {
+		nodes := g.Tree().FindNodesById(parser.OperationNode, op)
+		if len(nodes) != 1 {
+			t.Fatalf("got %d %s operations, wanted 1", len(nodes), op)
+		}
+		if !slices.ContainsFunc(nodes[0].Children, func(n *parser.GenDocNode) bool {
+			return n.Index.Typ == parser.MessageNode && !n.IsLeaf
+		}) {
+			t.Errorf("operation %s is missing the message", op)
+		}
+	}
+	if len(g.Tree().OrhpanedBranch().Children) != 0 {
+		t.Errorf("got %d orphans, wanted none", len(g.Tree().OrhpanedBranch().Children))
+	}
+}
+
+func Test_GenDocBlox_skips_files_without_markers(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string][]byte{
+		"service.md": []byte("<!--+gendoc category=info type=description id=svc -->\nservice\n<!---gendoc -->\n"),
+		"blob.bin":   {0x00, 0x01, 0x02, 0xff},
+		"yarn.lock":  []byte("# no markers here\n"),
+	}
+	inputs := []*fshelper.FileList{}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, content, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		inputs = append(inputs, &fshelper.FileList{Name: name, Path: path})
+	}
+
+	g := generate.New(&generate.Config{ParserConfig: parser.Config{ServiceId: "svc"}}, log.New(&bytes.Buffer{}, log.ErrorLvl))
+	g.LoadInputsFromFiles(inputs)
+	if err := g.GenDocBlox(); err != nil {
+		t.Fatal(err)
+	}
+	if len(*g.Processed()) != 1 {
+		t.Fatalf("got length: %d, wanted 1", len(*g.Processed()))
+	}
+}
+
+func Test_GenDocBlox_collects_diagnostics_from_every_file(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"a.cs": "//+gendoc category=bar id=a\n//-gendoc\n//+gendoc category=message id=b\n",
+		"b.tf": "#+gendoc category=baz id=c\n#-gendoc\n",
+	}
+	inputs := []*fshelper.FileList{}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		inputs = append(inputs, &fshelper.FileList{Name: name, Path: path})
+	}
+
+	g := generate.New(&generate.Config{}, log.New(&bytes.Buffer{}, log.ErrorLvl))
+	g.LoadInputsFromFiles(inputs)
+	err := g.GenDocBlox()
+	if !errors.Is(err, generate.ErrGenDocBlox) {
+		t.Fatalf("got: %v, wanted: %v", err, generate.ErrGenDocBlox)
+	}
+	diags := diag.Diagnostics{}
+	if !errors.As(err, &diags) {
+		t.Fatalf("expected diagnostics, got: %v", err)
+	}
+	if len(diags) != 3 {
+		t.Errorf("got %d diagnostics, wanted 3\n%s", len(diags), diags)
+	}
+}
+
+func Test_Generate_output_is_reproducible(t *testing.T) {
+	inputs, _ := fshelper.ListFiles(fshelper.DebugDirHelper(t, baseDir, "internal/generate", "../../"))
+	generateOnce := func() (interim []byte, asyncapi map[string][]byte) {
+		out := t.TempDir()
+		g := generate.New(&generate.Config{InterimOutputDir: out, ParserConfig: parser.Config{ServiceId: "bazquxsample", ServiceRepoUrl: "https://github.com/asynapi-gen"}}, log.New(&bytes.Buffer{}, log.ErrorLvl))
+		g.LoadInputsFromFiles(inputs)
+		if err := g.GenDocBlox(); err != nil {
+			t.Fatal(err)
+		}
+		if err := g.BuildContextTree(); err != nil {
+			t.Fatal(err)
+		}
+		if err := g.AsyncAPIFromProcessedTree(); err != nil {
+			t.Fatal(err)
+		}
+		interim, err := json.Marshal(g.Processed())
+		if err != nil {
+			t.Fatal(err)
+		}
+		files, _ := fshelper.ListFiles(out)
+		asyncapi = map[string][]byte{}
+		for _, f := range files {
+			b, err := os.ReadFile(f.Path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			asyncapi[f.Name] = b
+		}
+		return interim, asyncapi
+	}
+
+	chunkSize := generate.ChunkSize
+	t.Cleanup(func() { generate.ChunkSize = chunkSize })
+
+	wantInterim, wantAsyncAPI := generateOnce()
+	if len(wantAsyncAPI) == 0 {
+		t.Fatal("no AsyncAPI generated")
+	}
+	// vary the concurrency to vary the order the goroutines complete in
+	for _, size := range []int{1, 2, 5, 20, 1, 20} {
+		generate.ChunkSize = size
+		gotInterim, gotAsyncAPI := generateOnce()
+		if !bytes.Equal(gotInterim, wantInterim) {
+			t.Fatalf("chunk size %d: interim state differs", size)
+		}
+		if !reflect.DeepEqual(gotAsyncAPI, wantAsyncAPI) {
+			t.Fatalf("chunk size %d: AsyncAPI differs", size)
+		}
+	}
+}
+
+// Benchmark_BuildContextTree builds a synthetic global context of 100k blocks,
+// every message has a schema without a parent to exercise the passes over the orphans
+func Benchmark_BuildContextTree(b *testing.B) {
+	const services, channels = 100, 25_000
+	blocks := []parser.GenDocBlock{}
+	block := func(cat parser.NodeCategory, ct gendoc.CategoryType, id string, parent string) parser.GenDocBlock {
+		a := gendoc.GenDoc{CategoryType: ct, ContentType: gendoc.Description, Id: id}
+		if parent != "" {
+			a.Parent = gendoc.IdList{parent}
+		}
+		return parser.GenDocBlock{Token: token.Token{Source: token.Source{Path: fmt.Sprintf("%s/%s.cs", ct, id)}, Line: 1}, Annotation: a, NodeCategory: cat, Value: id}
+	}
+	for i := 0; i < services; i++ {
+		blocks = append(blocks, block(parser.ServiceNode, gendoc.InfoBlock, fmt.Sprintf("svc-%d", i), ""))
+	}
+	for i := 0; i < channels; i++ {
+		ch, op := fmt.Sprintf("ch-%d", i), fmt.Sprintf("op-%d", i)
+		blocks = append(blocks,
+			block(parser.ChannelNode, gendoc.ChannelBlock, ch, fmt.Sprintf("svc-%d", i%services)),
+			block(parser.OperationNode, gendoc.PubOperationBlock, op, ch),
+			block(parser.MessageNode, gendoc.MessageBlock, op, op),
+			block(parser.MessageNode, gendoc.MessageBlock, op, ""),
+		)
+	}
+	dir := b.TempDir()
+	path := filepath.Join(dir, "interim.json")
+	raw, err := json.Marshal(blocks)
+	if err != nil {
+		b.Fatal(err)
+	}
+	if err := os.WriteFile(path, raw, 0o644); err != nil {
+		b.Fatal(err)
+	}
+	g := generate.New(&generate.Config{}, log.New(&bytes.Buffer{}, log.ErrorLvl))
+	g.LoadInputsFromFiles([]*fshelper.FileList{{Name: "interim.json", Path: path}})
+	if err := g.ConvertProcessed(); err != nil {
+		b.Fatal(err)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := g.BuildContextTree(); err != nil {
+			b.Fatal(err)
+		}
+	}
+	b.StopTimer()
+	if orphans := len(g.Tree().OrhpanedBranch().Children); orphans != 0 {
+		b.Fatalf("got %d orphans, wanted 0", orphans)
+	}
+}
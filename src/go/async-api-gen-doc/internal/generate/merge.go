@@ -0,0 +1,223 @@
+package generate
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/dnitsch/async-api-generator/internal/diag"
+	"github.com/dnitsch/async-api-generator/internal/parser"
+)
+
+var (
+	ErrUnknownMergePolicy = errors.New("merge policy must be one of error, first-wins, last-wins, concatenate or prefer-owner")
+	ErrMergeConflict      = errors.New("conflicting values")
+)
+
+const codeMergeConflict = "GD035"
+
+// MergePolicy decides which value is kept when several blocks document the same field of a node
+// with different values, e.g. two repos describing the same channel
+type MergePolicy string
+
+const (
+	MergeError       MergePolicy = "error"
+	MergeFirstWins   MergePolicy = "first-wins"
+	MergeLastWins    MergePolicy = "last-wins"
+	MergeConcatenate MergePolicy = "concatenate"
+	// MergePreferOwner keeps the value documented in the repo of the service being generated,
+	// falling back to last-wins when the service repo does not document the field
+	MergePreferOwner MergePolicy = "prefer-owner"
+)
+
+// ParseMergePolicy returns the policy by name, an empty name is MergeLastWins
+func ParseMergePolicy(name string) (MergePolicy, error) {
+	switch p := MergePolicy(name); p {
+	case "":
+		return MergeLastWins, nil
+	case MergeError, MergeFirstWins, MergeLastWins, MergeConcatenate, MergePreferOwner:
+		return p, nil
+	}
+	return "", fmt.Errorf("merge policy '%s': %w", name, ErrUnknownMergePolicy)
+}
+
+// concatenated are the fields joined by MergeConcatenate,
+// any other field, e.g. a title or a payload, keeps the last value
+var concatenated = map[string]bool{"description": true, "summary": true}
+
+// MergedSource records the blocks a conflicting field was taken from
+type MergedSource struct {
+	Field   string   `json:"field" yaml:"field"`
+	Policy  string   `json:"policy" yaml:"policy"`
+	Sources []string `json:"sources" yaml:"sources"`
+}
+
+// Conflict is a field documented with different values
+type Conflict struct {
+	// Field is the path of the field in the AsyncAPI, e.g. channels.orders.description
+	Field   string
+	Policy  MergePolicy
+	Winners []*parser.GenDocBlock
+	Losers  []*parser.GenDocBlock
+}
+
+// Diagnostic returns the conflict positioned at the first kept block,
+// an error under MergeError and a warning otherwise
+//
+//	channels.orders.description has 2 conflicting values, kept a.md:1 (last-wins), dropped b.md:4
+func (c Conflict) Diagnostic() *diag.Diagnostic {
+	severity := diag.SeverityWarning
+	if c.Policy == MergeError {
+		severity = diag.SeverityError
+	}
+	err := fmt.Errorf("%s has %d %w", c.Field, len(c.Winners)+len(c.Losers), ErrMergeConflict)
+	if len(c.Winners) > 0 {
+		err = fmt.Errorf("%w, kept %s (%s)", err, blockSources(c.Winners), c.Policy)
+	}
+	if len(c.Losers) > 0 {
+		err = fmt.Errorf("%w, dropped %s", err, blockSources(c.Losers))
+	}
+	blocks := append(append([]*parser.GenDocBlock{}, c.Winners...), c.Losers...)
+	return blockDiagnostic(blocks[0], severity, codeMergeConflict, err)
+}
+
+func blockSources(blocks []*parser.GenDocBlock) string {
+	sources := make([]string, len(blocks))
+	for i, block := range blocks {
+		sources[i] = blockSource(block)
+	}
+	return strings.Join(sources, ", ")
+}
+
+// blockSource is the `path:line` of the block
+func blockSource(block *parser.GenDocBlock) string {
+	return fmt.Sprintf("%s:%d", block.Token.Source.Path, block.Token.Line)
+}
+
+// fieldMerger collects the values documented for the fields of a single node
+// and resolves them with the merge policy once all the leaves are seen
+type fieldMerger struct {
+	policy MergePolicy
+	// owner is the id of the service being generated
+	owner string
+	// path is the path of the node in the AsyncAPI, e.g. channels.orders
+	path   string
+	fields []*mergeField
+	// conflicts and sources are set by merge
+	conflicts []Conflict
+	sources   []MergedSource
+}
+
+type mergeField struct {
+	name       string
+	target     *string
+	candidates []mergeCandidate
+}
+
+type mergeCandidate struct {
+	val   string
+	block *parser.GenDocBlock
+}
+
+func newFieldMerger(conf *Config, owner, path string) *fieldMerger {
+	policy := MergeLastWins
+	if conf != nil && conf.MergePolicy != "" {
+		policy = conf.MergePolicy
+	}
+	return &fieldMerger{policy: policy, owner: owner, path: path}
+}
+
+// set records the value of the field documented in the block, empty values are skipped
+//
+// A later value from the same block replaces the earlier one,
+// e.g. the content of a description block over its description attribute.
+func (m *fieldMerger) set(target *string, name, val string, block *parser.GenDocBlock) {
+	if val == "" {
+		return
+	}
+	for _, f := range m.fields {
+		if f.target != target {
+			continue
+		}
+		if last := &f.candidates[len(f.candidates)-1]; last.block == block {
+			last.val = val
+			return
+		}
+		f.candidates = append(f.candidates, mergeCandidate{val, block})
+		return
+	}
+	m.fields = append(m.fields, &mergeField{name: name, target: target, candidates: []mergeCandidate{{val, block}}})
+}
+
+// merge writes the resolved value of each field to its target
+// and records the fields documented with conflicting values
+//
+// Blocks documenting the same value do not conflict.
+func (m *fieldMerger) merge() {
+	for _, f := range m.fields {
+		// blocks attached in a later pass over the orphans are not appended in source order
+		sort.SliceStable(f.candidates, func(i, j int) bool {
+			a, b := f.candidates[i].block.Token, f.candidates[j].block.Token
+			if a.Source.Path != b.Source.Path {
+				return a.Source.Path < b.Source.Path
+			}
+			return a.Line < b.Line
+		})
+		distinct := []mergeCandidate{}
+		seen := map[string]bool{}
+		for _, c := range f.candidates {
+			if !seen[c.val] {
+				seen[c.val] = true
+				distinct = append(distinct, c)
+			}
+		}
+		if len(distinct) == 1 {
+			*f.target = distinct[0].val
+			continue
+		}
+		winners, losers := m.resolve(f, distinct)
+		vals := []string{}
+		for _, w := range winners {
+			vals = append(vals, w.val)
+		}
+		*f.target = strings.Join(vals, "\n\n")
+
+		c := Conflict{Field: m.path + "." + f.name, Policy: m.policy}
+		source := MergedSource{Field: c.Field, Policy: string(m.policy)}
+		for _, w := range winners {
+			c.Winners = append(c.Winners, w.block)
+			source.Sources = append(source.Sources, blockSource(w.block))
+		}
+		for _, l := range losers {
+			c.Losers = append(c.Losers, l.block)
+		}
+		m.conflicts = append(m.conflicts, c)
+		m.sources = append(m.sources, source)
+	}
+}
+
+// resolve splits the distinct values of a field into the kept and the dropped ones
+func (m *fieldMerger) resolve(f *mergeField, distinct []mergeCandidate) (winners, losers []mergeCandidate) {
+	if m.policy == MergeConcatenate && concatenated[f.name] {
+		return distinct, nil
+	}
+	keep := f.candidates[len(f.candidates)-1]
+	switch m.policy {
+	case MergeFirstWins:
+		keep = f.candidates[0]
+	case MergePreferOwner:
+		for i := len(f.candidates) - 1; i >= 0; i-- {
+			if m.owner != "" && f.candidates[i].block.Origin == m.owner {
+				keep = f.candidates[i]
+				break
+			}
+		}
+	}
+	for _, c := range distinct {
+		if c.val != keep.val {
+			losers = append(losers, c)
+		}
+	}
+	return []mergeCandidate{keep}, losers
+}
@@ -0,0 +1,140 @@
+package generate_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/dnitsch/async-api-generator/internal/diag"
+	"github.com/dnitsch/async-api-generator/internal/fshelper"
+	"github.com/dnitsch/async-api-generator/internal/gendoc"
+	"github.com/dnitsch/async-api-generator/internal/generate"
+	"github.com/dnitsch/async-api-generator/internal/parser"
+	"github.com/dnitsch/async-api-generator/internal/token"
+	log "github.com/dnitsch/simplelog"
+)
+
+// interimServices builds the services from interim states, one per repo
+func interimServices(t *testing.T, policy generate.MergePolicy, repos map[string][]parser.GenDocBlock) ([]generate.Service, error) {
+	t.Helper()
+	dir := t.TempDir()
+	inputs := []*fshelper.FileList{}
+	for repo, blocks := range repos {
+		b, err := json.Marshal(blocks)
+		if err != nil {
+			t.Fatal(err)
+		}
+		path := filepath.Join(dir, repo+".json")
+		if err := os.WriteFile(path, b, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		inputs = append(inputs, &fshelper.FileList{Name: repo + ".json", Path: path})
+	}
+	g := generate.New(&generate.Config{MergePolicy: policy}, log.New(&bytes.Buffer{}, log.ErrorLvl))
+	g.LoadInputsFromFiles(inputs)
+	if err := g.ConvertProcessed(); err != nil {
+		t.Fatal(err)
+	}
+	if err := g.BuildContextTree(); err != nil {
+		t.Fatal(err)
+	}
+	return g.Services()
+}
+
+func channelBlock(origin, path, description string) parser.GenDocBlock {
+	return parser.GenDocBlock{
+		Token:        token.Token{Source: token.Source{File: filepath.Base(path), Path: path}, Line: 1, Column: 1},
+		Annotation:   gendoc.GenDoc{CategoryType: gendoc.ChannelBlock, ContentType: gendoc.Description, Id: "orders", Parent: gendoc.IdList{"svc"}},
+		NodeCategory: parser.ChannelNode,
+		Value:        description,
+		Origin:       origin,
+	}
+}
+
+func Test_Services_merge_policies(t *testing.T) {
+	repos := map[string][]parser.GenDocBlock{
+		"svc": {
+			{
+				Token:        token.Token{Source: token.Source{File: "index.md", Path: "a-svc/index.md"}, Line: 1, Column: 1},
+				Annotation:   gendoc.GenDoc{CategoryType: gendoc.InfoBlock, ContentType: gendoc.Description, Id: "svc"},
+				NodeCategory: parser.ServiceNode,
+				Value:        "service",
+				Origin:       "svc",
+			},
+			channelBlock("svc", "a-svc/ch.tf", "owned"),
+		},
+		"other": {
+			channelBlock("other", "b-other/ch.tf", "borrowed"),
+			// the same value documented again does not conflict
+			channelBlock("other", "c-other/ch.tf", "borrowed"),
+		},
+	}
+	ttests := map[string]struct {
+		policy  generate.MergePolicy
+		want    string
+		sources []string
+	}{
+		"last wins by default": {"", "borrowed", []string{"c-other/ch.tf:1"}},
+		"first wins":           {generate.MergeFirstWins, "owned", []string{"a-svc/ch.tf:1"}},
+		"prefer owner":         {generate.MergePreferOwner, "owned", []string{"a-svc/ch.tf:1"}},
+		"concatenate":          {generate.MergeConcatenate, "owned\n\nborrowed", []string{"a-svc/ch.tf:1", "b-other/ch.tf:1"}},
+	}
+	for name, tt := range ttests {
+		t.Run(name, func(t *testing.T) {
+			services, err := interimServices(t, tt.policy, repos)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(services) != 1 {
+				t.Fatalf("got %d services, wanted 1", len(services))
+			}
+			svc := services[0]
+			if got := svc.AsyncAPI.Channels["orders"].Description; got != tt.want {
+				t.Errorf("got description %q, wanted %q", got, tt.want)
+			}
+			if len(svc.Conflicts) != 1 || svc.Conflicts[0].Field != "channels.orders.description" {
+				t.Fatalf("got conflicts %+v, wanted channels.orders.description", svc.Conflicts)
+			}
+			if d := svc.Conflicts[0].Diagnostic(); d.Severity != diag.SeverityWarning || !errors.Is(d, generate.ErrMergeConflict) {
+				t.Errorf("got %s %v, wanted a merge conflict warning", d.Severity, d)
+			}
+			if len(svc.AsyncAPI.Sources) != 1 || !equalStrings(svc.AsyncAPI.Sources[0].Sources, tt.sources) {
+				t.Errorf("got sources %+v, wanted %v", svc.AsyncAPI.Sources, tt.sources)
+			}
+		})
+	}
+
+	t.Run("error", func(t *testing.T) {
+		_, err := interimServices(t, generate.MergeError, repos)
+		if !errors.Is(err, generate.ErrMergeConflict) {
+			t.Fatalf("got %v, wanted %v", err, generate.ErrMergeConflict)
+		}
+		if diags := diag.Collect(err); !diags.HasErrors() || diags[0].Code != "GD035" {
+			t.Errorf("got %s, wanted a GD035 error", diags)
+		}
+	})
+}
+
+func Test_ParseMergePolicy(t *testing.T) {
+	if got, err := generate.ParseMergePolicy(""); err != nil || got != generate.MergeLastWins {
+		t.Errorf("got %s %v, wanted the %s default", got, err, generate.MergeLastWins)
+	}
+	if _, err := generate.ParseMergePolicy("newest"); !errors.Is(err, generate.ErrUnknownMergePolicy) {
+		t.Errorf("got %v, wanted %v", err, generate.ErrUnknownMergePolicy)
+	}
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
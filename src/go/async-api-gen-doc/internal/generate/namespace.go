@@ -0,0 +1,132 @@
+package generate
+
+import (
+	"errors"
+
+	"github.com/dnitsch/async-api-generator/internal/gendoc"
+	"github.com/dnitsch/async-api-generator/internal/parser"
+)
+
+var ErrAmbiguousParent = errors.New("parent is documented by several services, list the owning service with service_id")
+
+// Node identity is namespaced by the owning service,
+// two services documenting a channel with the same id get a node each,
+// as do the operations and messages below them.
+//
+// A channel is shared, i.e. a single node linked under every service documenting it,
+// when any of its blocks is marked shared=true or lists several services as parents.
+
+// sharedChannels returns the ids of the channels shared across services
+func sharedChannels(processed *Processed) map[string]bool {
+	shared := map[string]bool{}
+	if processed == nil {
+		return shared
+	}
+	for _, block := range *processed {
+		if block.NodeCategory == parser.ChannelNode && (block.Annotation.Shared || len(block.Annotation.Parent) > 1) {
+			shared[block.Annotation.Id] = true
+		}
+	}
+	return shared
+}
+
+// serviceNamespace is the namespace of the nodes owned by the service,
+// the URN of the service or its id when the URN is not known
+func serviceNamespace(tree *parser.GenDocTree, id string) string {
+	if node := tree.FindNode(parser.NewGenDocNodeKey(parser.ServiceNode, id)); node != nil && node.Value.Annotation.ServiceURN != "" {
+		return node.Value.Annotation.ServiceURN
+	}
+	return id
+}
+
+// ownerKey returns the key of the node owning the block under the parent
+//
+// Channels take the namespace of their service unless shared,
+// operations and messages the namespace of their parent.
+func (g *Generate) ownerKey(block *parser.GenDocBlock, cat parser.NodeCategory, parent *parser.GenDocNode) *parser.GenDocNodeKey {
+	namespace := parent.Index.Namespace
+	if cat == parser.ChannelNode {
+		namespace = ""
+		if !g.shared[block.Annotation.Id] {
+			namespace = serviceNamespace(g.tree, parent.Index.Val)
+		}
+	}
+	return parser.NewScopedGenDocNodeKey(cat, namespace, block.Annotation.Id)
+}
+
+// parentRef are the ids of the parents of a category listed on a block
+type parentRef struct {
+	cat parser.NodeCategory
+	ids gendoc.IdList
+}
+
+// parentRefs returns the parents listed on the block of the category
+//
+// A parent is of the category above the block,
+// messages can additionally be attached directly to the channels listed via channelId.
+func parentRefs(block *parser.GenDocBlock, cat parser.NodeCategory) []parentRef {
+	refs := []parentRef{}
+	if len(block.Annotation.Parent) > 0 {
+		refs = append(refs, parentRef{cat - 1, block.Annotation.Parent})
+	}
+	if cat == parser.MessageNode && len(block.Annotation.ChannelId) > 0 {
+		refs = append(refs, parentRef{parser.ChannelNode, block.Annotation.ChannelId})
+	}
+	return refs
+}
+
+// findParents returns the nodes of every listed parent of the block which exists in the tree
+//
+// An id documented in several namespaces resolves to the services listed in service_id,
+// or else to the service repo the block is documented in.
+// The ids not in the tree yet, or which still resolve to several or no namespace, are returned as unresolved.
+func (g *Generate) findParents(block *parser.GenDocBlock, cat parser.NodeCategory) (parents []*parser.GenDocNode, unresolved []string) {
+	parents = []*parser.GenDocNode{}
+	for _, ref := range parentRefs(block, cat) {
+		for _, id := range ref.ids {
+			found, _ := g.resolve(block, ref.cat, id)
+			if len(found) == 0 {
+				unresolved = append(unresolved, id)
+			}
+			parents = append(parents, found...)
+		}
+	}
+	return parents, unresolved
+}
+
+// resolve returns the nodes of the category with the id the block belongs to,
+// false when the id is documented in several namespaces none of which is picked by the block
+func (g *Generate) resolve(block *parser.GenDocBlock, cat parser.NodeCategory, id string) ([]*parser.GenDocNode, bool) {
+	nodes := g.tree.FindNodesById(cat, id)
+	// services are never namespaced
+	if cat == parser.ServiceNode {
+		return nodes, true
+	}
+	var namespaces []string
+	switch {
+	case len(block.Annotation.ServiceId) > 0 && block.NodeCategory != parser.ChannelNode:
+		for _, svc := range block.Annotation.ServiceId {
+			namespaces = append(namespaces, serviceNamespace(g.tree, svc))
+		}
+	case len(nodes) > 1 && block.Origin != "":
+		namespaces = []string{serviceNamespace(g.tree, block.Origin)}
+	case len(nodes) > 1:
+		return nil, false
+	default:
+		return nodes, true
+	}
+	picked := []*parser.GenDocNode{}
+	for _, node := range nodes {
+		for _, namespace := range namespaces {
+			// shared channels, and the nodes below them, belong to every service
+			if node.Index.Namespace == namespace || node.Index.Namespace == "" {
+				picked = append(picked, node)
+				break
+			}
+		}
+	}
+	if len(picked) == 0 && len(nodes) > 1 {
+		return nil, false
+	}
+	return picked, true
+}
@@ -0,0 +1,136 @@
+package generate_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/dnitsch/async-api-generator/internal/fshelper"
+	"github.com/dnitsch/async-api-generator/internal/generate"
+	"github.com/dnitsch/async-api-generator/internal/parser"
+	log "github.com/dnitsch/simplelog"
+)
+
+// interimState parses the files as the repo of the service and writes its interim state
+func interimState(t *testing.T, dir, serviceId string, files map[string]string) *fshelper.FileList {
+	t.Helper()
+	src := filepath.Join(dir, serviceId)
+	if err := os.MkdirAll(src, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	inputs := []*fshelper.FileList{}
+	for name, content := range files {
+		path := filepath.Join(src, name)
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		inputs = append(inputs, &fshelper.FileList{Name: name, Path: path})
+	}
+	g := generate.New(&generate.Config{ParserConfig: parser.Config{ServiceId: serviceId}}, log.New(&bytes.Buffer{}, log.ErrorLvl))
+	g.LoadInputsFromFiles(inputs)
+	if err := g.GenDocBlox(); err != nil {
+		t.Fatal(err)
+	}
+	b, err := json.Marshal(g.Processed())
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, serviceId+".json")
+	if err := os.WriteFile(path, b, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return &fshelper.FileList{Name: serviceId + ".json", Path: path}
+}
+
+func serviceRepo(serviceId, channelAttrs, description string) map[string]string {
+	return map[string]string{
+		"svc.md": "<!--+gendoc category=info type=description -->\n" + serviceId + "\n<!---gendoc -->\n",
+		"ch.tf": "#+gendoc category=channel type=description id=events " + channelAttrs + "\n# " + description + "\n#-gendoc\n" +
+			"#+gendoc category=pubOperation type=description id=created channelId=events\n# created\n#-gendoc\n" +
+			"#+gendoc category=message type=description id=created\n# created\n#-gendoc\n",
+	}
+}
+
+func Test_BuildContextTree_scopes_nodes_by_service(t *testing.T) {
+	ttests := map[string]struct {
+		channelAttrs string
+		consumer     string
+		channels     int
+		conflicts    bool
+		orphan       error
+	}{
+		"same id in two services": {
+			channelAttrs: "",
+			consumer:     "channelId=events service_id=orders",
+			channels:     2,
+		},
+		"shared channel": {
+			channelAttrs: "shared=true",
+			consumer:     "channelId=events",
+			channels:     1,
+			conflicts:    true,
+		},
+		"ambiguous parent": {
+			channelAttrs: "",
+			consumer:     "channelId=events",
+			channels:     2,
+			orphan:       generate.ErrAmbiguousParent,
+		},
+	}
+	for name, tt := range ttests {
+		t.Run(name, func(t *testing.T) {
+			dir := t.TempDir()
+			inputs := []*fshelper.FileList{
+				interimState(t, dir, "orders", serviceRepo("orders", tt.channelAttrs, "orders events")),
+				interimState(t, dir, "billing", serviceRepo("billing", tt.channelAttrs, "billing events")),
+				interimState(t, dir, "audit", map[string]string{
+					"svc.md": "<!--+gendoc category=info type=description -->\naudit\n<!---gendoc -->\n",
+					"op.cs":  "//+gendoc category=subOperation type=description id=audited " + tt.consumer + "\n// audited\n//-gendoc\n",
+				}),
+			}
+			g := generate.New(&generate.Config{ParserConfig: parser.Config{}}, log.New(&bytes.Buffer{}, log.ErrorLvl))
+			g.LoadInputsFromFiles(inputs)
+			if err := g.ConvertProcessed(); err != nil {
+				t.Fatal(err)
+			}
+			if err := g.BuildContextTree(); err != nil {
+				t.Fatal(err)
+			}
+
+			if got := len(g.Tree().FindNodesById(parser.ChannelNode, "events")); got != tt.channels {
+				t.Errorf("got %d channel nodes, wanted %d", got, tt.channels)
+			}
+			if got := len(g.Tree().FindNodesById(parser.OperationNode, "created")); got != tt.channels {
+				t.Errorf("got %d operation nodes, wanted %d", got, tt.channels)
+			}
+			orphans := g.Orphans()
+			if tt.orphan == nil && len(orphans) > 0 {
+				t.Errorf("got orphans %v, wanted none", orphans[0].Diagnostic())
+			}
+			if tt.orphan != nil && (len(orphans) != 1 || !errors.Is(orphans[0].Reason, tt.orphan)) {
+				t.Fatalf("got %v orphans, wanted one with %v", orphans, tt.orphan)
+			}
+
+			services, err := g.Services()
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, svc := range services {
+				if svc.Node.Index.Val == "audit" {
+					continue
+				}
+				if conflicts := len(svc.Conflicts) > 0; conflicts != tt.conflicts {
+					t.Errorf("service %s got conflicts %v, wanted %v", svc.Node.Index.Val, svc.Conflicts, tt.conflicts)
+				}
+				if ch, ok := svc.AsyncAPI.Channels["events"]; !ok {
+					t.Errorf("service %s is missing the channel", svc.Node.Index.Val)
+				} else if !tt.conflicts && ch.Description != svc.Node.Index.Val+" events" {
+					t.Errorf("service %s got description %q", svc.Node.Index.Val, ch.Description)
+				}
+			}
+		})
+	}
+}
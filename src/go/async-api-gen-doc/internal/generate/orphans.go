@@ -0,0 +1,92 @@
+package generate
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/dnitsch/async-api-generator/internal/diag"
+	"github.com/dnitsch/async-api-generator/internal/gendoc"
+	"github.com/dnitsch/async-api-generator/internal/parser"
+)
+
+var ErrParentOrphaned = errors.New("parent is documented but is itself orphaned")
+
+// maxCandidates is the number of closest ids listed for an orphan
+const maxCandidates = 3
+
+// Orphan explains why a block did not attach to the context tree
+type Orphan struct {
+	Block *parser.GenDocBlock
+	// ParentCategory is the category of the parent the block was looking for
+	ParentCategory parser.NodeCategory
+	// ParentIds are the listed parents or the id of the block itself when none are listed,
+	// e.g. a schema file is looking for an operation with the same id.
+	// A message listing both operations and channels is explained by its operations.
+	ParentIds gendoc.IdList
+	// Reason is either ErrMissingParent, ErrParentOrphaned or ErrAmbiguousParent
+	Reason error
+	// Candidates are the closest existing ids of the ParentCategory in the tree
+	Candidates []string
+}
+
+// Orphans analyses every block left on the orphaned branch of the tree
+//
+// Orphans are ordered by file and line. Must be called after BuildContextTree.
+func (g *Generate) Orphans() []Orphan {
+	attached := map[parser.NodeCategory][]string{}
+	for _, node := range g.tree.Index {
+		if !node.IsLeaf && node.Index.Typ != 0 {
+			attached[node.Index.Typ] = append(attached[node.Index.Typ], node.Index.Val)
+		}
+	}
+	orphaned := map[parser.GenDocNodeKey]bool{}
+	for _, node := range g.tree.OrhpanedBranch().Children {
+		orphaned[*parser.NewGenDocNodeKey(node.Index.Typ, node.Value.Annotation.Id)] = true
+	}
+
+	orphans := []Orphan{}
+	for _, node := range g.tree.OrhpanedBranch().Children {
+		block := node.Value
+		o := Orphan{Block: block, ParentCategory: block.NodeCategory - 1, ParentIds: gendoc.IdList{block.Annotation.Id}, Reason: ErrMissingParent}
+		if refs := parentRefs(block, block.NodeCategory); len(refs) > 0 {
+			o.ParentCategory, o.ParentIds = refs[0].cat, refs[0].ids
+		}
+		for _, id := range o.ParentIds {
+			if orphaned[*parser.NewGenDocNodeKey(o.ParentCategory, id)] {
+				o.Reason = ErrParentOrphaned
+			}
+			if _, ok := g.resolve(block, o.ParentCategory, id); !ok {
+				o.Reason = ErrAmbiguousParent
+			}
+			for _, candidate := range gendoc.Nearest(id, attached[o.ParentCategory], maxCandidates, max(2, len(id)/2)) {
+				if !slices.Contains(o.Candidates, candidate) && len(o.Candidates) < maxCandidates {
+					o.Candidates = append(o.Candidates, candidate)
+				}
+			}
+		}
+		orphans = append(orphans, o)
+	}
+	sort.SliceStable(orphans, func(i, j int) bool {
+		a, b := orphans[i].Block.Token, orphans[j].Block.Token
+		if a.Source.Path != b.Source.Path {
+			return a.Source.Path < b.Source.Path
+		}
+		return a.Line < b.Line
+	})
+	return orphans
+}
+
+// Diagnostic returns the orphan as a warning positioned at the block
+//
+//	pubOperation 'created' is orphaned, looking for channel 'orders': parent is not documented
+//	closest: order, orders-v2
+func (o Orphan) Diagnostic() *diag.Diagnostic {
+	err := fmt.Errorf("%s '%s' %w, looking for %s '%s': %w", o.Block.Annotation.CategoryType, o.Block.Annotation.Id, ErrOrphan, o.ParentCategory, o.ParentIds, o.Reason)
+	if len(o.Candidates) > 0 {
+		err = fmt.Errorf("%w\nclosest: %s", err, strings.Join(o.Candidates, ", "))
+	}
+	return blockDiagnostic(o.Block, diag.SeverityWarning, codeOrphan, err)
+}
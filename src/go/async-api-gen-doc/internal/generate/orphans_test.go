@@ -0,0 +1,87 @@
+package generate_test
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/dnitsch/async-api-generator/internal/fshelper"
+	"github.com/dnitsch/async-api-generator/internal/gendoc"
+	"github.com/dnitsch/async-api-generator/internal/generate"
+	"github.com/dnitsch/async-api-generator/internal/parser"
+	log "github.com/dnitsch/simplelog"
+)
+
+func Test_Orphans_explains_each_orphan(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"svc.md": "<!--+gendoc category=info type=description -->\nservice\n<!---gendoc -->\n",
+		"ch.tf": `#+gendoc category=channel type=description id=orders-created
+# orders
+#-gendoc
+#+gendoc category=channel type=description id=refunds parent=payments
+# refunds
+#-gendoc
+#+gendoc category=pubOperation type=description id=refunded channelId=refunds
+# refunded
+#-gendoc
+`,
+		"orders-create.schema.json": `{"type": "object"}`,
+	}
+	inputs := []*fshelper.FileList{}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		inputs = append(inputs, &fshelper.FileList{Name: name, Path: path})
+	}
+	g := generate.New(&generate.Config{ParserConfig: parser.Config{ServiceId: "svc"}}, log.New(&bytes.Buffer{}, log.ErrorLvl))
+	g.LoadInputsFromFiles(inputs)
+	if err := g.GenDocBlox(); err != nil {
+		t.Fatal(err)
+	}
+	if err := g.BuildContextTree(); err != nil {
+		t.Fatal(err)
+	}
+
+	got := g.Orphans()
+	want := []struct {
+		id         string
+		category   parser.NodeCategory
+		parents    gendoc.IdList
+		reason     error
+		candidates []string
+	}{
+		{"refunds", parser.ServiceNode, gendoc.IdList{"payments"}, generate.ErrMissingParent, nil},
+		{"refunded", parser.ChannelNode, gendoc.IdList{"refunds"}, generate.ErrParentOrphaned, nil},
+		// schema files look for an operation by their own id
+		{"orders-create", parser.OperationNode, gendoc.IdList{"orders-create"}, generate.ErrMissingParent, nil},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %d orphans, wanted %d: %+v", len(got), len(want), got)
+	}
+	byId := map[string]generate.Orphan{}
+	for _, o := range got {
+		byId[o.Block.Annotation.Id] = o
+	}
+	for _, w := range want {
+		o, ok := byId[w.id]
+		if !ok {
+			t.Errorf("orphan %s not found", w.id)
+			continue
+		}
+		if o.ParentCategory != w.category || !reflect.DeepEqual(o.ParentIds, w.parents) || !errors.Is(o.Reason, w.reason) {
+			t.Errorf("%s got %s %v %v, wanted %s %v %v", w.id, o.ParentCategory, o.ParentIds, o.Reason, w.category, w.parents, w.reason)
+		}
+		if len(o.Candidates) != len(w.candidates) {
+			t.Errorf("%s got candidates %v, wanted %v", w.id, o.Candidates, w.candidates)
+		}
+		if d := o.Diagnostic(); !errors.Is(d, generate.ErrOrphan) || d.Line == 0 && o.Block.Token.Line != 0 {
+			t.Errorf("%s diagnostic not positioned at the block: %v", w.id, d)
+		}
+	}
+}
@@ -0,0 +1,134 @@
+package generate
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+var ErrUnknownFormat = errors.New("format must be one of yaml or json")
+
+// Format is the serialisation of the emitted AsyncAPI documents
+type Format string
+
+const (
+	FormatYAML Format = "yaml"
+	FormatJSON Format = "json"
+)
+
+// ParseFormat returns the format by name, an empty name is FormatYAML
+func ParseFormat(name string) (Format, error) {
+	switch f := Format(name); f {
+	case "":
+		return FormatYAML, nil
+	case FormatYAML, FormatJSON:
+		return f, nil
+	}
+	return "", fmt.Errorf("format '%s': %w", name, ErrUnknownFormat)
+}
+
+// Ext returns the file extension of the documents in the format
+func (f Format) Ext() string {
+	if f == FormatJSON {
+		return ".json"
+	}
+	return ".yml"
+}
+
+// the examples of a message are not part of the AsyncAPI document,
+// they are carried as comments read by the EventCatalog plugin
+const (
+	examplesBeginMarker = "###BEGIN_EVENTCATALOG_EXAMPLES###"
+	examplesEndMarker   = "###END_EVENTCATALOG_EXAMPLES###"
+	exampleMarker       = "#->"
+)
+
+// Render marshals the service as the AsyncAPI version in the format
+//
+// YAML documents list the examples of each message as base64 encoded JSON
+// between the EventCatalog markers, JSON documents cannot carry comments and so have no examples.
+func Render(w io.Writer, input *AsyncAPIRoot, version AsyncAPIVersion, format Format) error {
+	var doc any = input
+	if version == AsyncAPI3 {
+		doc = input.ToV3()
+	}
+	if format == FormatJSON {
+		enc := json.NewEncoder(w)
+		enc.SetEscapeHTML(false)
+		enc.SetIndent("", "  ")
+		return enc.Encode(doc)
+	}
+	node := &yaml.Node{}
+	if err := node.Encode(doc); err != nil {
+		return err
+	}
+	if input.Components != nil {
+		if err := exampleComments(node, input.Components.Messages); err != nil {
+			return err
+		}
+	}
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	if err := enc.Encode(node); err != nil {
+		return err
+	}
+	return enc.Close()
+}
+
+// exampleComments adds the examples of each message in the components as a comment above its fields,
+// the message ids are the same in either version
+func exampleComments(doc *yaml.Node, messages map[string]Message) error {
+	msgNodes := mappingValue(mappingValue(doc, "components"), "messages")
+	if msgNodes == nil {
+		return nil
+	}
+	for i := 0; i+1 < len(msgNodes.Content); i += 2 {
+		msg, ok := messages[msgNodes.Content[i].Value]
+		body := msgNodes.Content[i+1]
+		if !ok || len(msg.Examples) == 0 || len(body.Content) == 0 {
+			continue
+		}
+		lines := []string{examplesBeginMarker}
+		for _, example := range msg.Examples {
+			b, err := json.Marshal(example)
+			if err != nil {
+				return err
+			}
+			lines = append(lines, exampleMarker+base64.StdEncoding.EncodeToString(b))
+		}
+		lines = append(lines, examplesEndMarker)
+		body.Content[0].HeadComment = strings.Join(lines, "\n")
+	}
+	return nil
+}
+
+// mappingValue returns the value of the key in the mapping node, nil when not found
+func mappingValue(node *yaml.Node, key string) *yaml.Node {
+	if node == nil || node.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i+1]
+		}
+	}
+	return nil
+}
+
+// parsePayload returns the JSON schema of a message as a structured object,
+// the schema is kept as is when it is neither JSON nor YAML
+func parsePayload(payload string) any {
+	var schema any
+	if err := json.Unmarshal([]byte(payload), &schema); err == nil {
+		return schema
+	}
+	if err := yaml.Unmarshal([]byte(payload), &schema); err == nil && schema != nil {
+		return schema
+	}
+	return payload
+}
@@ -0,0 +1,90 @@
+package generate_test
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"regexp"
+	"testing"
+
+	"github.com/dnitsch/async-api-generator/internal/generate"
+	"gopkg.in/yaml.v3"
+)
+
+func Test_Render_parses_in_each_format(t *testing.T) {
+	services := servicesFromFiles(t, map[string]string{
+		"svc.md": "<!--+gendoc category=info type=description -->\nkeys: values\n  # not a comment\n<!---gendoc -->\n",
+		"ch.tf": `#+gendoc category=channel type=description id=orders
+# orders: placed, "amended"
+#-gendoc
+#+gendoc category=pubOperation type=summary id=placed channelId=orders
+# places: orders
+#-gendoc
+#+gendoc category=message type=json_schema id=created parent=placed
+# {
+#     "type": "object",
+#   "properties": {"id": {"type": "string"}}
+# }
+#-gendoc
+#+gendoc category=message type=example id=created parent=placed
+# {"id": "abc"}
+#-gendoc
+`,
+	})
+	a := services[0].AsyncAPI
+	examples := regexp.MustCompile(`(?m)#->(.*$)`)
+
+	ttests := map[string]struct {
+		version  generate.AsyncAPIVersion
+		format   generate.Format
+		examples int
+	}{
+		"2.6 yaml": {generate.AsyncAPI2, generate.FormatYAML, 1},
+		"2.6 json": {generate.AsyncAPI2, generate.FormatJSON, 0},
+		"3.0 yaml": {generate.AsyncAPI3, generate.FormatYAML, 1},
+		"3.0 json": {generate.AsyncAPI3, generate.FormatJSON, 0},
+	}
+	for name, tt := range ttests {
+		t.Run(name, func(t *testing.T) {
+			w := &bytes.Buffer{}
+			if err := generate.Render(w, a, tt.version, tt.format); err != nil {
+				t.Fatal(err)
+			}
+			doc := map[string]any{}
+			unmarshal := yaml.Unmarshal
+			if tt.format == generate.FormatJSON {
+				unmarshal = json.Unmarshal
+			}
+			if err := unmarshal(w.Bytes(), &doc); err != nil {
+				t.Fatalf("rendered document does not parse: %v\n%s", err, w.String())
+			}
+			info := doc["info"].(map[string]any)
+			if info["description"] != a.Info.Description {
+				t.Errorf("got description %q, wanted %q", info["description"], a.Info.Description)
+			}
+			msg := doc["components"].(map[string]any)["messages"].(map[string]any)["created"].(map[string]any)
+			payload, ok := msg["payload"].(map[string]any)
+			if !ok || payload["type"] != "object" {
+				t.Errorf("got payload %v, wanted the parsed schema", msg["payload"])
+			}
+
+			found := examples.FindAllStringSubmatch(w.String(), -1)
+			if len(found) != tt.examples {
+				t.Fatalf("got %d examples, wanted %d", len(found), tt.examples)
+			}
+			for _, match := range found {
+				b, err := base64.StdEncoding.DecodeString(match[1])
+				if err != nil {
+					t.Fatal(err)
+				}
+				example := generate.MessageBodyShared{}
+				if err := json.Unmarshal(b, &example); err != nil {
+					t.Fatal(err)
+				}
+				if example.Name != "created" || example.Payload != `{"id": "abc"}` {
+					t.Errorf("got example %v", example)
+				}
+			}
+		})
+	}
+}
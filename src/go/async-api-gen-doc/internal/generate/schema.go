@@ -0,0 +1,243 @@
+package generate
+
+import (
+	"bytes"
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/dnitsch/async-api-generator/internal/diag"
+	"github.com/dnitsch/async-api-generator/internal/parser"
+	"github.com/santhosh-tekuri/jsonschema/v5"
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	// the official AsyncAPI JSON Schemas bundled with their definitions, named asyncapi-<version>.json
+	//go:embed schemas/*.json
+	schemaFiles embed.FS
+)
+
+const schemasDir = "schemas"
+
+var (
+	ErrInvalidDocument  = errors.New("document does not match the AsyncAPI schema")
+	ErrNoDocumentSchema = errors.New("no AsyncAPI schema is embedded for the version")
+)
+
+const codeInvalidDocument = "GD036"
+
+// documentSchemas are the embedded schemas by the asyncapi version they validate, e.g. 2.6.0,
+// compiled once on first use
+var documentSchemas = sync.OnceValues(func() (map[string]*jsonschema.Schema, error) {
+	files, err := fs.ReadDir(schemaFiles, schemasDir)
+	if err != nil {
+		return nil, err
+	}
+	schemas := map[string]*jsonschema.Schema{}
+	for _, f := range files {
+		b, err := schemaFiles.ReadFile(path.Join(schemasDir, f.Name()))
+		if err != nil {
+			return nil, err
+		}
+		c := jsonschema.NewCompiler()
+		c.Draft = jsonschema.Draft7
+		if err := c.AddResource(f.Name(), bytes.NewReader(b)); err != nil {
+			return nil, err
+		}
+		schema, err := c.Compile(f.Name())
+		if err != nil {
+			return nil, err
+		}
+		schemas[strings.TrimSuffix(strings.TrimPrefix(f.Name(), "asyncapi-"), ".json")] = schema
+	}
+	return schemas, nil
+})
+
+// documentExts are the extensions of the documents which must parse,
+// the output of a custom template of any other extension, e.g. markdown, is not validated
+var documentExts = map[string]bool{".yml": true, ".yaml": true, ".json": true}
+
+// validateDocument validates the rendered document of the service against the schema of its asyncapi version
+//
+// Each value not matching the schema is reported at the source of the channel, operation or message it was converted from,
+// see documentNode. A document without an asyncapi version is not validated,
+// one of a version without an embedded schema fails with ErrNoDocumentSchema.
+func (g *Generate) validateDocument(srv Service, doc []byte, ext string) (diag.Diagnostics, error) {
+	var raw any
+	if err := yaml.Unmarshal(doc, &raw); err != nil {
+		if !documentExts[ext] {
+			return nil, nil
+		}
+		return diag.Diagnostics{schemaDiagnostic(srv, "", err.Error())}, nil
+	}
+	version, _ := mappingField(raw, "asyncapi")
+	if version == "" {
+		return nil, nil
+	}
+	schemas, err := documentSchemas()
+	if err != nil {
+		return nil, err
+	}
+	schema, ok := schemas[version]
+	if !ok {
+		return nil, fmt.Errorf("%s asyncapi %s: %w", srv.AsyncAPI.ID, version, ErrNoDocumentSchema)
+	}
+	// the schema validates the JSON data model, e.g. no integer keys or YAML timestamps
+	b, err := json.Marshal(raw)
+	if err != nil {
+		return diag.Diagnostics{schemaDiagnostic(srv, "", err.Error())}, nil
+	}
+	var instance any
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	if err := dec.Decode(&instance); err != nil {
+		return nil, err
+	}
+	verr := &jsonschema.ValidationError{}
+	if err := schema.Validate(instance); !errors.As(err, &verr) {
+		return nil, err
+	}
+	diags := diag.Diagnostics{}
+	for _, v := range schemaViolations(verr) {
+		diags = append(diags, schemaDiagnostic(srv, v.InstanceLocation, v.Message))
+	}
+	return diags, nil
+}
+
+// mappingField returns the string field of a decoded mapping
+func mappingField(raw any, key string) (string, bool) {
+	m, ok := raw.(map[string]any)
+	if !ok {
+		return "", false
+	}
+	val, ok := m[key].(string)
+	return val, ok
+}
+
+// schemaViolations returns the innermost errors of the validation, the first for each value of the document
+//
+// The outer errors only say that a value matches none of the alternatives of e.g. a oneOf,
+// as does an error of an alternative not matching at all, e.g. missing a $ref, alongside an error below the value.
+// Only the errors of the values deepest in the document are returned,
+// preferring an error of the object a value describes over the error of it not being a $ref.
+func schemaViolations(verr *jsonschema.ValidationError) []*jsonschema.ValidationError {
+	leaves := []*jsonschema.ValidationError{}
+	var collect func(ve *jsonschema.ValidationError)
+	collect = func(ve *jsonschema.ValidationError) {
+		if len(ve.Causes) == 0 {
+			leaves = append(leaves, ve)
+		}
+		for _, cause := range ve.Causes {
+			collect(cause)
+		}
+	}
+	collect(verr)
+	sort.SliceStable(leaves, func(i, j int) bool { return !isReferenceError(leaves[i]) && isReferenceError(leaves[j]) })
+	seen := map[string]bool{}
+	violations := []*jsonschema.ValidationError{}
+	for _, leaf := range leaves {
+		below := slices.ContainsFunc(leaves, func(other *jsonschema.ValidationError) bool {
+			return strings.HasPrefix(other.InstanceLocation, leaf.InstanceLocation+"/")
+		})
+		if !below && !seen[leaf.InstanceLocation] {
+			seen[leaf.InstanceLocation] = true
+			violations = append(violations, leaf)
+		}
+	}
+	sort.SliceStable(violations, func(i, j int) bool { return violations[i].InstanceLocation < violations[j].InstanceLocation })
+	return violations
+}
+
+// isReferenceError reports whether the error is of the Reference alternative of a value, i.e. it has no $ref
+func isReferenceError(ve *jsonschema.ValidationError) bool {
+	return strings.Contains(ve.AbsoluteKeywordLocation, "Reference.json/")
+}
+
+// schemaDiagnostic positions the violation at the value of the document at the first block of the node it was converted from
+func schemaDiagnostic(srv Service, pointer, message string) *diag.Diagnostic {
+	if pointer == "" {
+		pointer = "/"
+	}
+	err := fmt.Errorf("%s at %s: %s: %w", srv.AsyncAPI.ID, pointer, message, ErrInvalidDocument)
+	node := documentNode(srv, pointer)
+	if node == nil || node.Value == nil {
+		return &diag.Diagnostic{Severity: diag.SeverityError, Code: codeInvalidDocument, Err: err}
+	}
+	block := node.Value
+	if leaves := leafBlocks(node); len(leaves) > 0 {
+		block = leaves[0]
+	}
+	return blockDiagnostic(block, diag.SeverityError, codeInvalidDocument, err)
+}
+
+// documentNode returns the node of the service the value at the JSON pointer was converted from
+//
+// Values below a channel, operation or message are traced back to its node in either version,
+// any other value to the service node. The operations of a 3.0 document are looked up by the operationId
+// they were converted from, see toV3.
+func documentNode(srv Service, pointer string) *parser.GenDocNode {
+	segments := strings.Split(strings.TrimPrefix(pointer, "/"), "/")
+	for i, s := range segments {
+		segments[i] = strings.NewReplacer("~1", "/", "~0", "~").Replace(s)
+	}
+	node := srv.Node
+	lookup := func(category, id string) {
+		if found := findNode(srv.Node, category, id); found != nil {
+			node = found
+		}
+	}
+	at := func(i int) string {
+		if i < len(segments) {
+			return segments[i]
+		}
+		return ""
+	}
+	switch at(0) {
+	case "channels":
+		lookup(parser.ChannelNode.String(), at(1))
+		channel := srv.AsyncAPI.Channels[at(1)]
+		switch at(2) {
+		case "publish", "subscribe":
+			op := channel.Publish
+			if at(2) == "subscribe" {
+				op = channel.Subscribe
+			}
+			if op != nil {
+				lookup(parser.OperationNode.String(), op.OperationId)
+			}
+		case "messages":
+			lookup(parser.MessageNode.String(), componentMessageId(srv.AsyncAPI, at(3)))
+		}
+	case "operations":
+		_, operationIds := srv.AsyncAPI.toV3()
+		id, ok := operationIds[at(1)]
+		if !ok {
+			id = at(1)
+		}
+		lookup(parser.OperationNode.String(), id)
+	case "components":
+		if at(1) == "messages" {
+			lookup(parser.MessageNode.String(), componentMessageId(srv.AsyncAPI, at(2)))
+		}
+	}
+	return node
+}
+
+// componentMessageId returns the id of the message node converted into the components under the id
+func componentMessageId(a *AsyncAPIRoot, id string) string {
+	if a.Components == nil {
+		return id
+	}
+	if msg, ok := a.Components.Messages[id]; ok && msg.MessageId != "" {
+		return msg.MessageId
+	}
+	return id
+}
@@ -0,0 +1,139 @@
+package generate_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/dnitsch/async-api-generator/internal/diag"
+	"github.com/dnitsch/async-api-generator/internal/fshelper"
+	"github.com/dnitsch/async-api-generator/internal/generate"
+)
+
+func Test_AsyncAPIFromProcessedTree_validates_documents(t *testing.T) {
+	schema := `{"type": "object", "properties": {"id": {"type": "string"}}}`
+	ttests := map[string]struct {
+		version   generate.AsyncAPIVersion
+		schema    string
+		templates map[string]string
+		entry     string
+		// the file, line and JSON pointer of the violation, empty when valid
+		file    string
+		line    int
+		pointer string
+		written int
+	}{
+		"valid document": {
+			schema:  schema,
+			written: 1,
+		},
+		"invalid payload schema": {
+			schema:  `{"type": 5}`,
+			file:    "msg.cs",
+			line:    1,
+			pointer: "/components/messages/created/payload/type",
+		},
+		"invalid template": {
+			schema:    schema,
+			templates: map[string]string{generate.AsyncAPIRootCompleteTpl: "asyncapi: 2.6.0\ninfo:\n  title: {{ .Info.Title }}\nchannels: {}\n"},
+			file:      "svc.md",
+			line:      1,
+			pointer:   "/info",
+		},
+		"custom template of another format": {
+			schema:    schema,
+			templates: map[string]string{"summary.md": "# {{ .Info.Title }}\n- not: [yaml"},
+			entry:     "summary.md",
+			written:   1,
+		},
+		"3.0 valid document": {
+			version: generate.AsyncAPI3,
+			schema:  schema,
+			written: 1,
+		},
+		"3.0 invalid payload schema": {
+			version: generate.AsyncAPI3,
+			schema:  `{"type": 5}`,
+			file:    "msg.cs",
+			line:    1,
+			pointer: "/components/messages/created/payload/type",
+		},
+		"3.0 invalid operation on its second channel": {
+			version: generate.AsyncAPI3,
+			schema:  schema,
+			templates: map[string]string{generate.AsyncAPIRootV3Tpl: `asyncapi: {{ .AsyncAPI }}
+info: {{ .Info | toJson }}
+channels: {{ .Channels | toJson }}
+operations:
+{{- range $id, $op := .Operations }}
+  {{ $id }}:
+    action: {{ $op.Action }}
+    channel: {{ $op.Channel | toJson }}
+    queue: {{ $id }}
+{{- end }}
+`},
+			file:    "ch.tf",
+			line:    7,
+			pointer: "/operations/placed-orders",
+		},
+		"3.0 version without a schema": {
+			version:   generate.AsyncAPI3,
+			schema:    schema,
+			templates: map[string]string{generate.AsyncAPIRootV3Tpl: "asyncapi: 3.1.0\ninfo: {{ .Info | toJson }}\n"},
+		},
+	}
+	for name, tt := range ttests {
+		t.Run(name, func(t *testing.T) {
+			out, tplDir := t.TempDir(), ""
+			if tt.templates != nil {
+				tplDir = t.TempDir()
+				for name, content := range tt.templates {
+					if err := os.WriteFile(filepath.Join(tplDir, name), []byte(content), 0o644); err != nil {
+						t.Fatal(err)
+					}
+				}
+			}
+			g := generatorFromFiles(t, &generate.Config{InterimOutputDir: out, AsyncAPIVersion: tt.version, TemplateDir: tplDir, Template: tt.entry}, map[string]string{
+				"svc.md": "<!--+gendoc category=info type=description -->\nservice\n<!---gendoc -->\n",
+				"ch.tf":  "#+gendoc category=channel type=description id=audit\n# audit\n#-gendoc\n#+gendoc category=channel type=description id=orders\n# orders\n#-gendoc\n#+gendoc category=pubOperation type=summary id=placed channelId=[audit, orders]\n# places orders\n#-gendoc\n",
+				"msg.cs": "//+gendoc category=message type=json_schema id=created parent=placed\n// " + tt.schema + "\n//-gendoc\n",
+			})
+
+			err := g.AsyncAPIFromProcessedTree()
+			written, _ := fshelper.ListFiles(out)
+			if len(written) != tt.written {
+				t.Errorf("got %d documents written, wanted %d", len(written), tt.written)
+			}
+			if tt.written > 0 {
+				if err != nil {
+					t.Fatalf("got %v, wanted a valid document", err)
+				}
+				return
+			}
+			if tt.pointer == "" {
+				if !errors.Is(err, generate.ErrNoDocumentSchema) {
+					t.Fatalf("got %v, wanted %v", err, generate.ErrNoDocumentSchema)
+				}
+				return
+			}
+			if !errors.Is(err, generate.ErrInvalidDocument) {
+				t.Fatalf("got %v, wanted %v", err, generate.ErrInvalidDocument)
+			}
+			found := false
+			for _, d := range diag.Collect(err) {
+				if d.Code != "GD036" {
+					continue
+				}
+				if d.File != tt.file || d.Line != tt.line {
+					t.Errorf("got %s, wanted a GD036 error in %s:%d", d, tt.file, tt.line)
+				}
+				found = found || strings.Contains(d.Message(), "svc at "+tt.pointer+":")
+			}
+			if !found {
+				t.Errorf("got %s, wanted a violation at %s", err, tt.pointer)
+			}
+		})
+	}
+}
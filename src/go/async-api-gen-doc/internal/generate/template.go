@@ -2,12 +2,19 @@ package generate
 
 import (
 	"embed"
+	"errors"
 	"fmt"
 	"io"
 	"io/fs"
+	"os"
+	"path"
+	"slices"
+	"sort"
+	"strings"
 	"text/template"
 
 	sprig "github.com/Masterminds/sprig/v3"
+	"github.com/dnitsch/async-api-generator/internal/diag"
 	"github.com/dnitsch/async-api-generator/internal/gendoc"
 	"github.com/dnitsch/async-api-generator/internal/parser"
 )
@@ -16,6 +23,7 @@ import (
 const (
 	templatesDir            = "templates"
 	AsyncAPIRootCompleteTpl = "async-api-root-complete.yml"
+	AsyncAPIRootV3Tpl       = "async-api-3-root.yml"
 )
 
 var (
@@ -23,53 +31,166 @@ var (
 	templatefiles embed.FS
 )
 
+var ErrTemplateNotFound = errors.New("not found the template specified")
+
 type TemplateProcessor struct {
 	templates map[string]*template.Template
+	// entry is the template the documents are rendered with,
+	// the template of the AsyncAPI version when empty
+	entry string
 }
 
+// NewTemplateProcessor loads the embedded templates
 func NewTemplateProcessor() (TemplateProcessor, error) {
+	return NewTemplateProcessorFromDir("", "")
+}
+
+// NewTemplateProcessorFromDir loads the embedded templates, overridden by or added to the templates in dir
+//
+// Every file in dir is a template by its name, a template of the same name as an embedded one replaces it.
+// Files prefixed with an underscore, e.g. _helpers.tpl, are not templates of their own
+// but are parsed into each template of dir so that they can share definitions.
+// The entry is the template the documents are rendered with, it fails with ErrTemplateNotFound when not loaded.
+func NewTemplateProcessorFromDir(dir, entry string) (TemplateProcessor, error) {
 	d := TemplateProcessor{
 		templates: make(map[string]*template.Template),
+		entry:     entry,
 	}
 
-	tmplFiles, err := fs.ReadDir(templatefiles, templatesDir)
-	if err != nil {
+	if err := d.load(templatefiles, templatesDir, nil); err != nil {
 		return d, err
 	}
 
+	if dir != "" {
+		userFiles := os.DirFS(dir)
+		tmplFiles, err := fs.ReadDir(userFiles, ".")
+		if err != nil {
+			return d, err
+		}
+		partials := []string{}
+		for _, tmpl := range tmplFiles {
+			if !tmpl.IsDir() && strings.HasPrefix(tmpl.Name(), "_") {
+				partials = append(partials, tmpl.Name())
+			}
+		}
+		if err := d.load(userFiles, ".", partials); err != nil {
+			return d, err
+		}
+	}
+
+	if _, ok := d.templates[entry]; entry != "" && !ok {
+		return d, fmt.Errorf("template '%s': %w", entry, ErrTemplateNotFound)
+	}
+	return d, nil
+}
+
+// load parses every file in the dir of fsys along with the partials into a template by its name
+func (d TemplateProcessor) load(fsys fs.FS, dir string, partials []string) error {
+	tmplFiles, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return err
+	}
+
 	for _, tmpl := range tmplFiles {
-		if tmpl.IsDir() {
+		if tmpl.IsDir() || strings.HasPrefix(tmpl.Name(), "_") || strings.HasPrefix(tmpl.Name(), ".") {
 			continue
 		}
-		t := template.New(tmpl.Name()).Funcs(sprig.FuncMap())
-		pt, err := t.ParseFS(templatefiles, templatesDir+"/"+tmpl.Name())
+		t := template.New(tmpl.Name()).Funcs(sprig.FuncMap()).Funcs(nodeFuncs(nil))
+		t.Funcs(template.FuncMap{"include": include(t)})
+		patterns := []string{path.Join(dir, tmpl.Name())}
+		for _, partial := range partials {
+			patterns = append(patterns, path.Join(dir, partial))
+		}
+		pt, err := t.ParseFS(fsys, patterns...)
 		if err != nil {
-			return d, err
+			return err
 		}
 		d.templates[tmpl.Name()] = pt
 	}
-	return d, nil
+	return nil
+}
+
+// include executes the named template of t and returns its output,
+// so that it can be piped into e.g. nindent at any depth
+func include(t *template.Template) func(name string, data any) (string, error) {
+	return func(name string, data any) (string, error) {
+		buf := &strings.Builder{}
+		err := t.ExecuteTemplate(buf, name, data)
+		return buf.String(), err
+	}
 }
 
 func (t TemplateProcessor) GenerateFromRoot(w io.Writer, input AsyncAPIRoot) error {
 
 	foundTpl, ok := t.templates[AsyncAPIRootCompleteTpl]
 	if !ok {
-		return fmt.Errorf("not found the template specified")
+		return ErrTemplateNotFound
 	}
 
 	return executeTemplate(w, foundTpl, input)
 }
 
+// GenerateFromRootV3 renders the service in the AsyncAPI 3.0 shape
+func (t TemplateProcessor) GenerateFromRootV3(w io.Writer, input AsyncAPIRootV3) error {
+	foundTpl, ok := t.templates[AsyncAPIRootV3Tpl]
+	if !ok {
+		return ErrTemplateNotFound
+	}
+
+	return executeTemplate(w, foundTpl, input)
+}
+
+// Entry returns the name of the template the documents of the AsyncAPI version are rendered with
+func (t TemplateProcessor) Entry(version AsyncAPIVersion) string {
+	switch {
+	case t.entry != "":
+		return t.entry
+	case version == AsyncAPI3:
+		return AsyncAPIRootV3Tpl
+	}
+	return AsyncAPIRootCompleteTpl
+}
+
+// Generate renders the service as the AsyncAPI version
+func (t TemplateProcessor) Generate(w io.Writer, input *AsyncAPIRoot, version AsyncAPIVersion) error {
+	return t.GenerateService(w, Service{AsyncAPI: input}, version)
+}
+
+// GenerateService renders the service as the AsyncAPI version with the entry template,
+// the node functions of the templates look up the nodes of the service
+//
+// NOTE: the functions are bound to the templates, services are not rendered concurrently
+func (t TemplateProcessor) GenerateService(w io.Writer, svc Service, version AsyncAPIVersion) error {
+	foundTpl, ok := t.templates[t.Entry(version)]
+	if !ok {
+		return fmt.Errorf("template '%s': %w", t.Entry(version), ErrTemplateNotFound)
+	}
+	foundTpl.Funcs(nodeFuncs(svc.Node))
+	if version == AsyncAPI3 {
+		return executeTemplate(w, foundTpl, *svc.AsyncAPI.ToV3())
+	}
+	return executeTemplate(w, foundTpl, *svc.AsyncAPI)
+}
+
 type docType interface {
-	Operation | Server | Info | Channel | AsyncAPIRoot
+	Operation | Server | Info | Channel | AsyncAPIRoot | AsyncAPIRootV3
 }
 
 func executeTemplate[T docType](w io.Writer, t *template.Template, data T) error {
 	return t.Execute(w, data)
 }
 
+// ConstructService builds the AsyncAPI of the service node
+//
+// Fails under MergeError when a field is documented with conflicting values.
 func ConstructService(conf *Config, srvNode *parser.GenDocNode) (*AsyncAPIRoot, error) {
+	a, _, err := constructService(conf, srvNode)
+	return a, err
+}
+
+// constructService builds the AsyncAPI of the service node
+// and returns the fields documented with conflicting values
+func constructService(conf *Config, srvNode *parser.GenDocNode) (*AsyncAPIRoot, []Conflict, error) {
 	// first level services
 	a := &AsyncAPIRoot{}
 	a.AsyncAPI = "2.6.0" // include this value in the config
@@ -78,109 +199,320 @@ func ConstructService(conf *Config, srvNode *parser.GenDocNode) (*AsyncAPIRoot,
 	a.ID = srvNode.Value.Annotation.ServiceURN
 	// set the title to be the ID - can be overwritten if title specifically set
 	a.Info.Title = srvNode.Value.Annotation.Id
+	a.Info.Version = "0.0.1"
 	a.Tags = append(a.Tags, []Tag{{Name: "repoUrl", Description: srvNode.Value.Annotation.ServiceRepoUrl}, {Name: "repoLang", Description: srvNode.Value.Annotation.ServiceRepoLang}}...)
+
+	owner := srvNode.Index.Val
+	conflicts := []Conflict{}
+	// collect the conflicts once the converter merged the fields of the node
+	collect := func(m *fieldMerger) {
+		conflicts = append(conflicts, m.conflicts...)
+		a.Sources = append(a.Sources, m.sources...)
+	}
+
 	// get childleaf nodes
 	srvMeta, channels := srvNode.SortLeafNodes()
-	serviceConverter(srvMeta, a)
+	srvMerger := newFieldMerger(conf, owner, "info")
+	serviceConverter(srvMeta, a, srvMerger)
+	collect(srvMerger)
 	a.Channels = map[string]Channel{}
-ServiceLoop:
+	a.Components = &Components{Messages: map[string]Message{}}
+	components := &messageComponents{conf: conf, owner: owner, root: a, ids: map[*parser.GenDocNode]string{}, collect: collect}
 	for _, ch := range channels {
 		chNode := ch
-		chMeta, operations := chNode.SortLeafNodes()
+		chMeta, children := chNode.SortLeafNodes()
+		operations, chMessages := splitByCategory(children, parser.OperationNode)
 		chann := &Channel{}
-		channelConverter(chMeta, chann)
-		currCh := chann
-		oprtn := &Operation{}
-		if len(operations) <= 0 {
-			// assign known values to channel and continue to next channel
-			a.Channels[chNode.Index.Val] = *currCh
-			continue ServiceLoop
-		}
-		oprtn.OperationId = operations[0].Index.Val
-		// there will only ever be a 1-2-1 mapping between operation -> messassage
+		chPath := "channels." + chNode.Index.Val
+		chMerger := newFieldMerger(conf, owner, chPath)
+		channelConverter(chMeta, chann, chMerger)
+		collect(chMerger)
+		// each operation is converted on its own in id order,
+		// so that the first operation of a kind does not depend on the order of the children
+		sort.SliceStable(operations, func(i, j int) bool { return operations[i].Index.Val < operations[j].Index.Val })
 		for _, op := range operations {
 			opNode := op
 			opMeta, messages := opNode.SortLeafNodes()
-			operationConverter(opMeta, oprtn)
+			oprtn := &Operation{OperationId: opNode.Index.Val}
 			// operation is either pub or sub
 			switch opNode.Value.Annotation.CategoryType {
 			case gendoc.PubOperationBlock:
-				currCh.Publish = oprtn
+				oprtn.Action = ActionPublish
 			case gendoc.SubOperationBlock:
-				currCh.Subscribe = oprtn
+				oprtn.Action = ActionSubscribe
 			}
+			opMerger := newFieldMerger(conf, owner, chPath+".operations."+opNode.Index.Val)
+			operationConverter(opMeta, oprtn, opMerger)
+			collect(opMerger)
 
+			// messages attached to the channel are sent by each operation without its own
 			if len(messages) == 0 {
-				oprtn.Message = nil
-				// Do not add any message properties to this channel
-				// if operation has no message Nodes
-				//
-				// This can be configurable and either skip adding the channel
-				// completely or store incomplete on the service.
-				// @david/@sree/@vincent one for the backlog
-				// `Config` struct is already passed in so can be extended to dictate this behaviour
-				a.Channels[chNode.Index.Val] = *currCh
-				continue ServiceLoop
+				messages = chMessages
 			}
-			msgTop := &Message{}
-			msgTop.MessageId = messages[0].Index.Val
-			for _, msg := range messages {
-				msg := msg
-				// messages should only have leaf nodes
-				msgMeta, _ := msg.SortLeafNodes()
-				messageConverter(msgMeta, msgTop)
+			// an operation without message nodes is added without a message
+			//
+			// This can be configurable and either skip adding the channel
+			// completely or store incomplete on the service.
+			// `Config` struct is already passed in so can be extended to dictate this behaviour
+			if len(messages) > 0 {
+				oprtn.Message = components.ref(messages)
 			}
-			oprtn.Message = msgTop
+			chann.Operations = append(chann.Operations, oprtn)
 		}
-		a.Channels[chNode.Index.Val] = *currCh
+		for _, msg := range chMessages {
+			chann.Messages = append(chann.Messages, &Message{Ref: jsonPointer("components", "messages", components.add(msg))})
+		}
+		chann.Publish = combineOperations(chann.Operations, ActionPublish)
+		chann.Subscribe = combineOperations(chann.Operations, ActionSubscribe)
+		a.Channels[chNode.Index.Val] = *chann
 	}
 
-	return a, nil
+	if conf != nil && conf.MergePolicy == MergeError && len(conflicts) > 0 {
+		diags := diag.Diagnostics{}
+		for _, c := range conflicts {
+			diags = append(diags, c.Diagnostic())
+		}
+		return a, conflicts, fmt.Errorf("\n%w%w", diags, ErrMergeConflict)
+	}
+	return a, conflicts, nil
 }
 
-func serviceConverter(nodes []*parser.GenDocNode, a *AsyncAPIRoot) {
+// operation actions, an operation documented via the generic `operation` category has none
+const (
+	ActionPublish   = "publish"
+	ActionSubscribe = "subscribe"
+)
+
+// combineOperations returns the operation of the action for the channel,
+// a channel has at most one publish and one subscribe operation in AsyncAPI 2.
+//
+// Several operations of the same action are combined into the first by id,
+// the messages of all of them are listed as oneOf.
+func combineOperations(operations []*Operation, action string) *Operation {
+	matched := []*Operation{}
+	for _, op := range operations {
+		if op.Action == action {
+			matched = append(matched, op)
+		}
+	}
+	switch len(matched) {
+	case 0:
+		return nil
+	case 1:
+		return matched[0]
+	}
+	refs := []*Message{}
+	for _, op := range matched {
+		if op.Message == nil {
+			continue
+		}
+		for _, ref := range append([]*Message{op.Message}, op.Message.OneOf...) {
+			if ref.Ref != "" && !slices.ContainsFunc(refs, func(m *Message) bool { return m.Ref == ref.Ref }) {
+				refs = append(refs, &Message{Ref: ref.Ref})
+			}
+		}
+	}
+	// copy so that the first operation keeps its own message
+	combined := *matched[0]
+	switch {
+	case len(refs) == 1:
+		combined.Message = refs[0]
+	case len(refs) > 1:
+		combined.Message = &Message{OneOf: refs}
+	}
+	return &combined
+}
+
+var ErrCombinedOperations = errors.New("operations of the same action on a channel are combined in AsyncAPI 2.6, emit AsyncAPI 3.0 with --asyncapi-version 3.0 to keep each")
+
+const codeCombinedOperations = "GD037"
+
+// combinedOperations reports every operation combined into another one of the same action on a channel of the service,
+// only its messages are in the AsyncAPI 2.6 document, see combineOperations.
+//
+//	channels.orders.publish combines amended into placed, dropping its operationId, summary, description and bindings
+func combinedOperations(srv Service) diag.Diagnostics {
+	diags := diag.Diagnostics{}
+	chIds := make([]string, 0, len(srv.AsyncAPI.Channels))
+	for id := range srv.AsyncAPI.Channels {
+		chIds = append(chIds, id)
+	}
+	sort.Strings(chIds)
+	for _, chId := range chIds {
+		ch := srv.AsyncAPI.Channels[chId]
+		for _, kept := range []*Operation{ch.Publish, ch.Subscribe} {
+			if kept == nil {
+				continue
+			}
+			for _, op := range ch.Operations {
+				if op.Action != kept.Action || op.OperationId == kept.OperationId {
+					continue
+				}
+				err := fmt.Errorf("channels.%s.%s combines %s into %s, dropping its operationId, summary, description and bindings: %w",
+					chId, op.Action, op.OperationId, kept.OperationId, ErrCombinedOperations)
+				node := findNode(srv.Node, parser.OperationNode.String(), op.OperationId)
+				if leaves := leafBlocks(node); len(leaves) > 0 {
+					diags = append(diags, blockDiagnostic(leaves[0], diag.SeverityWarning, codeCombinedOperations, err))
+					continue
+				}
+				diags = append(diags, &diag.Diagnostic{Severity: diag.SeverityWarning, Code: codeCombinedOperations, Err: err})
+			}
+		}
+	}
+	return diags
+}
+
+// Operation returns the operation of the channel with the id, nil when not found
+func (c Channel) Operation(id string) *Operation {
+	for _, op := range c.Operations {
+		if op.OperationId == id {
+			return op
+		}
+	}
+	return nil
+}
+
+// splitByCategory splits the nodes into those of the category and the rest
+func splitByCategory(nodes []*parser.GenDocNode, cat parser.NodeCategory) (matched, rest []*parser.GenDocNode) {
+	for _, node := range nodes {
+		if node.Index.Typ == cat {
+			matched = append(matched, node)
+		} else {
+			rest = append(rest, node)
+		}
+	}
+	return matched, rest
+}
+
+// messageComponents converts each message node of the service once into the components,
+// operations reference the messages they send or receive
+type messageComponents struct {
+	conf    *Config
+	owner   string
+	root    *AsyncAPIRoot
+	ids     map[*parser.GenDocNode]string
+	collect func(m *fieldMerger)
+}
+
+const componentMessagesRef = "#/components/messages/"
+
+// add converts the message node unless already converted and returns its id in the components
+//
+// Messages with the same id from different services are numbered, e.g. created-2.
+func (c *messageComponents) add(node *parser.GenDocNode) string {
+	if id, ok := c.ids[node]; ok {
+		return id
+	}
+	id := node.Index.Val
+	for i := 2; ; i++ {
+		if _, taken := c.root.Components.Messages[id]; !taken {
+			break
+		}
+		id = fmt.Sprintf("%s-%d", node.Index.Val, i)
+	}
+	msg := Message{MessageId: node.Index.Val, Name: node.Index.Val}
+	// messages should only have leaf nodes
+	msgMeta, _ := node.SortLeafNodes()
+	m := newFieldMerger(c.conf, c.owner, "components.messages."+id)
+	messageConverter(msgMeta, &msg, m)
+	c.collect(m)
+	c.root.Components.Messages[id] = msg
+	c.ids[node] = id
+	return id
+}
+
+// ref returns the message of an operation referencing the message nodes in the components,
+// several messages are listed as oneOf
+func (c *messageComponents) ref(nodes []*parser.GenDocNode) *Message {
+	nodes = slices.Clone(nodes)
+	sort.SliceStable(nodes, func(i, j int) bool { return nodes[i].Index.Val < nodes[j].Index.Val })
+	refs := []*Message{}
+	for _, node := range nodes {
+		refs = append(refs, &Message{Ref: jsonPointer("components", "messages", c.add(node))})
+	}
+	if len(refs) == 1 {
+		return refs[0]
+	}
+	return &Message{OneOf: refs}
+}
+
+// OperationMessages returns the messages of the operation with the references resolved from the components
+func (a *AsyncAPIRoot) OperationMessages(op *Operation) []*Message {
+	if op == nil || op.Message == nil {
+		return nil
+	}
+	messages := []*Message{}
+	for _, ref := range a.operationRefs(op) {
+		if ref.Ref == "" {
+			messages = append(messages, ref)
+			continue
+		}
+		if a.Components == nil {
+			continue
+		}
+		if msg, ok := a.Components.Messages[messageRefId(ref.Ref)]; ok {
+			messages = append(messages, &msg)
+		}
+	}
+	return messages
+}
+
+func serviceConverter(nodes []*parser.GenDocNode, a *AsyncAPIRoot, m *fieldMerger) {
 	for _, srv := range nodes {
+		// inline metadata set on the annotation itself
+		m.set(&a.Info.Title, "title", srv.Value.Annotation.Title, srv.Value)
+		m.set(&a.Info.Description, "description", srv.Value.Annotation.Description, srv.Value)
 		switch srv.Value.Annotation.ContentType {
 		case gendoc.Description:
-			a.Info.Description = srv.Value.Value
+			m.set(&a.Info.Description, "description", srv.Value.Value, srv.Value)
 		case gendoc.Title:
 			// overwrite title if specifically set
-			a.Info.Title = srv.Value.Value
+			m.set(&a.Info.Title, "title", srv.Value.Value, srv.Value)
 		}
 	}
+	m.merge()
 }
 
-func channelConverter(nodes []*parser.GenDocNode, ch *Channel) {
+func channelConverter(nodes []*parser.GenDocNode, ch *Channel, m *fieldMerger) {
 	for _, node := range nodes {
+		m.set(&ch.Description, "description", node.Value.Annotation.Description, node.Value)
 		switch node.Value.Annotation.ContentType {
 		case gendoc.Description:
-			ch.Description = node.Value.Value
+			m.set(&ch.Description, "description", node.Value.Value, node.Value)
 		}
 	}
+	m.merge()
 }
 
-func operationConverter(nodes []*parser.GenDocNode, op *Operation) {
+func operationConverter(nodes []*parser.GenDocNode, op *Operation, m *fieldMerger) {
 	for _, node := range nodes {
+		m.set(&op.Summary, "summary", node.Value.Annotation.Summary, node.Value)
+		m.set(&op.Description, "description", node.Value.Annotation.Description, node.Value)
 		switch node.Value.Annotation.ContentType {
 		case gendoc.Summary:
-			op.Summary = node.Value.Value
+			m.set(&op.Summary, "summary", node.Value.Value, node.Value)
 		case gendoc.Description:
-			op.Description = node.Value.Value
+			m.set(&op.Description, "description", node.Value.Value, node.Value)
 		}
 	}
+	m.merge()
 }
 
-func messageConverter(nodes []*parser.GenDocNode, msg *Message) {
+func messageConverter(nodes []*parser.GenDocNode, msg *Message, m *fieldMerger) {
+	payload := ""
 	for _, node := range nodes {
+		m.set(&msg.Title, "title", node.Value.Annotation.Title, node.Value)
+		m.set(&msg.Summary, "summary", node.Value.Annotation.Summary, node.Value)
+		m.set(&msg.Description, "description", node.Value.Annotation.Description, node.Value)
 		switch node.Value.Annotation.ContentType {
 		case gendoc.Summary:
-			msg.Summary = node.Value.Value
+			m.set(&msg.Summary, "summary", node.Value.Value, node.Value)
 		case gendoc.Description:
-			msg.Description = node.Value.Value
+			m.set(&msg.Description, "description", node.Value.Value, node.Value)
 		case gendoc.Title:
-			msg.Title = node.Value.Value
+			m.set(&msg.Title, "title", node.Value.Value, node.Value)
 		case gendoc.JSONSchema:
-			msg.Payload = node.Value.Value
+			m.set(&payload, "payload", node.Value.Value, node.Value)
 		case gendoc.Example:
 			msg.Examples = append(msg.Examples, MessageBodyShared{
 				// Name is set at a parsing level so will always be available here
@@ -194,6 +526,10 @@ func messageConverter(nodes []*parser.GenDocNode, msg *Message) {
 			})
 		}
 	}
+	m.merge()
+	if payload != "" {
+		msg.Payload = parsePayload(payload)
+	}
 }
 
 // TODO: explore generics approach for this
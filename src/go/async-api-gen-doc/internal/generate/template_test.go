@@ -3,13 +3,16 @@ package generate_test
 import (
 	"bytes"
 	"encoding/json"
-	"fmt"
+	"errors"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
 	"testing"
 
+	"github.com/dnitsch/async-api-generator/internal/diag"
 	"github.com/dnitsch/async-api-generator/internal/fshelper"
+	"github.com/dnitsch/async-api-generator/internal/gendoc"
 	"github.com/dnitsch/async-api-generator/internal/generate"
 	"github.com/dnitsch/async-api-generator/internal/parser"
 	"github.com/dnitsch/async-api-generator/internal/storage"
@@ -54,19 +57,14 @@ var setupAsyncApiRoot = generate.AsyncAPIRoot{
 					Name:    "message",
 					Summary: "m summary",
 					Headers: []map[string]generate.Schema{},
-					Payload: `{"properties":{
-												"foo":{
-													"default": "bar",
-													"type":"string"
-											}
-											},
-											"type": "object"
-						}`,
-					Title:        "mtitle",
-					Description:  "m desc",
-					MessageId:    "msg_id",
-					Tags:         []generate.Tag{{Name: "version", Description: "0.0.1"}},
-					ExternalDocs: generate.ExternalDocumentation{},
+					Payload: generate.Schema{
+						"properties": map[string]any{"foo": map[string]any{"default": "bar", "type": "string"}},
+						"type":       "object",
+					},
+					Title:       "mtitle",
+					Description: "m desc",
+					MessageId:   "msg_id",
+					Tags:        []generate.Tag{{Name: "version", Description: "0.0.1"}},
 				},
 				Bindings: []interface{}{},
 			},
@@ -111,7 +109,8 @@ failed: %v`, got, err)
 		},
 		"payloads match": {
 			func() string {
-				return strings.Join(strings.Fields(fmt.Sprintf("%s", setupAsyncApiRoot.Channels["test_topic_publish_channel"].Publish.Message.Payload)), "")
+				b, _ := json.Marshal(setupAsyncApiRoot.Channels["test_topic_publish_channel"].Publish.Message.Payload)
+				return string(b)
 			},
 			func() string {
 				// expecting a valid schema to have been unmarshalled
@@ -131,51 +130,450 @@ failed: %v`, got, err)
 }
 
 func Test_BuildAsyncAPIRoot_from_tree(t *testing.T) {
-	testDir := filepath.Join(os.TempDir(), "throw-away")
-	err := os.MkdirAll(testDir, 0o777)
-	if err != nil {
-		t.Fatal(err)
+	ttests := map[string]struct {
+		version  generate.AsyncAPIVersion
+		format   generate.Format
+		asyncapi string
+		// the top level keys of the version
+		keys []string
+	}{
+		"2.6":      {generate.AsyncAPI2, generate.FormatYAML, "2.6.0", []string{"channels", "components"}},
+		"3.0":      {generate.AsyncAPI3, generate.FormatYAML, "3.0.0", []string{"channels", "operations", "components"}},
+		"3.0 json": {generate.AsyncAPI3, generate.FormatJSON, "3.0.0", []string{"channels", "operations", "components"}},
 	}
+	for name, tt := range ttests {
+		t.Run(name, func(t *testing.T) {
+			testDir := t.TempDir()
 
-	defer os.RemoveAll(testDir)
+			baseDir := "test/interim-generated"
 
-	baseDir := "test/interim-generated"
+			input, _ := fshelper.ListFiles(fshelper.DebugDirHelper(t, baseDir, "internal/generate", "../../"))
 
-	input, _ := fshelper.ListFiles(fshelper.DebugDirHelper(t, baseDir, "internal/generate", "../../"))
+			globalConf := &generate.Config{ParserConfig: parser.Config{},
+				InterimOutputDir: testDir,
+				AsyncAPIVersion:  tt.version,
+				Format:           tt.format,
+				SearchDirName:    fshelper.DebugDirHelper(t, baseDir, "internal/generate", "../../"),
+				Output: &storage.Conf{
+					Destination:    testDir,
+					Typ:            storage.Local,
+					TopLevelFolder: "",
+				},
+			}
 
-	globalConf := &generate.Config{ParserConfig: parser.Config{},
-		InterimOutputDir: testDir,
-		SearchDirName:    fshelper.DebugDirHelper(t, baseDir, "internal/generate", "../../"),
-		Output: &storage.Conf{
-			Destination:    testDir,
-			Typ:            storage.Local,
-			TopLevelFolder: "",
-		},
+			g := generate.New(globalConf, log.New(&bytes.Buffer{}, log.DebugLvl))
+			g.LoadInputsFromFiles(input)
+
+			if err := g.ConvertProcessed(); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := g.BuildContextTree(); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := g.AsyncAPIFromProcessedTree(); err != nil {
+				t.Fatal(err)
+			}
+
+			got, _ := fshelper.ListFiles(testDir)
+
+			if len(got) != 2 {
+				t.Errorf("got (%v) wanted 2 services written out", len(got))
+			}
+
+			for _, file := range got {
+				if filepath.Ext(file.Name) != tt.format.Ext() {
+					t.Errorf("%s is not named by its format %s", file.Name, tt.format)
+				}
+				b, _ := os.ReadFile(file.Path)
+				doc := map[string]any{}
+				unmarshal := yaml.Unmarshal
+				if tt.format == generate.FormatJSON {
+					unmarshal = json.Unmarshal
+				}
+				if err := unmarshal(b, &doc); err != nil {
+					t.Fatalf("%s does not parse: %v", file.Name, err)
+				}
+				if doc["asyncapi"] != tt.asyncapi {
+					t.Errorf("%s got asyncapi %v, wanted %s", file.Name, doc["asyncapi"], tt.asyncapi)
+				}
+				for _, key := range tt.keys {
+					if _, ok := doc[key].(map[string]any); !ok {
+						t.Errorf("%s is missing %s", file.Name, key)
+					}
+				}
+			}
+		})
+	}
+}
+
+func Test_ToV3_references_resolve(t *testing.T) {
+	services := servicesFromFiles(t, map[string]string{
+		"svc.md": "<!--+gendoc category=info type=description -->\nservice\n<!---gendoc -->\n",
+		"ch.tf": `#+gendoc category=channel type=description id=orders~v1
+# orders
+#-gendoc
+#+gendoc category=pubOperation type=summary id=placed channelId=orders~v1
+# places orders
+#-gendoc
+#+gendoc category=subOperation type=summary id=fulfil channelId=orders~v1
+# fulfils orders
+#-gendoc
+#+gendoc category=message type=description id=created channelId=orders~v1
+# created
+#-gendoc
+`,
+	})
+	v3 := services[0].AsyncAPI.ToV3()
+
+	ttests := map[string]struct {
+		op     string
+		action string
+	}{
+		"pubOperation is sent":     {"placed", "send"},
+		"subOperation is received": {"fulfil", "receive"},
 	}
+	for name, tt := range ttests {
+		t.Run(name, func(t *testing.T) {
+			op, ok := v3.Operations[tt.op]
+			if !ok {
+				t.Fatalf("operation %s not found in %v", tt.op, v3.Operations)
+			}
+			if op.Action != tt.action {
+				t.Errorf("got action %s, wanted %s", op.Action, tt.action)
+			}
+			if op.Channel.Ref != "#/channels/orders~0v1" {
+				t.Errorf("got channel %s", op.Channel.Ref)
+			}
+			if len(op.Messages) != 1 || op.Messages[0].Ref != "#/channels/orders~0v1/messages/created" {
+				t.Fatalf("got messages %v", op.Messages)
+			}
+			msg, ok := v3.Channels["orders~v1"].Messages["created"]
+			if !ok || msg.Ref != "#/components/messages/created" {
+				t.Errorf("got channel message %v", msg)
+			}
+			if _, ok := v3.Components.Messages["created"]; !ok {
+				t.Error("message is not in the components")
+			}
+		})
+	}
+}
 
-	g := generate.New(globalConf, log.New(&bytes.Buffer{}, log.DebugLvl))
-	g.LoadInputsFromFiles(input)
+func Test_ConstructService_uses_inline_annotation_metadata(t *testing.T) {
+	tree := parser.NewGenDocTree()
+	srv := parser.NewGenDocNode(&parser.GenDocBlock{Annotation: gendoc.GenDoc{Id: "svc", ServiceURN: "urn:::svc"}}).WithKey(parser.NewGenDocNodeKey(parser.ServiceNode, "svc"))
+	tree.AddNode(srv, tree.ParentedBranch())
+	leaf := parser.NewGenDocNode(&parser.GenDocBlock{
+		Annotation: gendoc.GenDoc{Id: "svc", ContentType: gendoc.Description, Title: "Inline title"},
+		Value:      "long description",
+	}).WithKey(parser.NewGenDocNodeKey(parser.ServiceNode, "svc__leaf__1"))
+	leaf.IsLeaf = true
+	tree.AddNode(leaf, srv)
 
-	if err := g.ConvertProcessed(); err != nil {
+	got, err := generate.ConstructService(&generate.Config{}, srv)
+	if err != nil {
 		t.Fatal(err)
 	}
+	if got.Info.Title != "Inline title" {
+		t.Errorf("title got: %s, wanted: Inline title", got.Info.Title)
+	}
+	if got.Info.Description != "long description" {
+		t.Errorf("description got: %s, wanted: long description", got.Info.Description)
+	}
+}
 
-	if err := g.BuildContextTree(); err != nil {
+func servicesFromFiles(t *testing.T, files map[string]string) []generate.Service {
+	t.Helper()
+	services, err := generatorFromFiles(t, &generate.Config{}, files).Services()
+	if err != nil {
 		t.Fatal(err)
 	}
+	return services
+}
 
-	if err := g.AsyncAPIFromProcessedTree(); err != nil {
+// generatorFromFiles builds the context tree of the files as the repo of the service svc
+func generatorFromFiles(t *testing.T, conf *generate.Config, files map[string]string) *generate.Generate {
+	t.Helper()
+	dir := t.TempDir()
+	inputs := []*fshelper.FileList{}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		inputs = append(inputs, &fshelper.FileList{Name: name, Path: path})
+	}
+	conf.ParserConfig.ServiceId = "svc"
+	g := generate.New(conf, log.New(&bytes.Buffer{}, log.ErrorLvl))
+	g.LoadInputsFromFiles(inputs)
+	if err := g.GenDocBlox(); err != nil {
+		t.Fatal(err)
+	}
+	if err := g.BuildContextTree(); err != nil {
 		t.Fatal(err)
 	}
+	if orphans := g.Orphans(); len(orphans) > 0 {
+		t.Fatalf("got orphan %v, wanted none", orphans[0].Diagnostic())
+	}
+	return g
+}
 
-	got, _ := fshelper.ListFiles(testDir)
+func Test_ConstructService_references_shared_messages(t *testing.T) {
+	ttests := map[string]struct {
+		messages string
+		want     map[string][]string
+	}{
+		"message attached to the channel": {
+			messages: "#+gendoc category=message type=description id=created channelId=orders\n# created\n#-gendoc\n",
+			want: map[string][]string{
+				"orders":  {"#/components/messages/created"},
+				"refunds": nil,
+			},
+		},
+		"message shared by several operations": {
+			messages: "#+gendoc category=message type=description id=created parent=[placed, refunded]\n# created\n#-gendoc\n",
+			want: map[string][]string{
+				"orders":  {"#/components/messages/created"},
+				"refunds": {"#/components/messages/created"},
+			},
+		},
+		"operation with several messages": {
+			messages: "#+gendoc category=message type=description id=created parent=placed\n# created\n#-gendoc\n" +
+				"#+gendoc category=message type=description id=amended parent=placed\n# amended\n#-gendoc\n",
+			want: map[string][]string{
+				"orders":  {"#/components/messages/amended", "#/components/messages/created"},
+				"refunds": nil,
+			},
+		},
+	}
+	for name, tt := range ttests {
+		t.Run(name, func(t *testing.T) {
+			services := servicesFromFiles(t, map[string]string{
+				"svc.md": "<!--+gendoc category=info type=description -->\nservice\n<!---gendoc -->\n",
+				"ch.tf": `#+gendoc category=channel type=description id=orders
+# orders
+#-gendoc
+#+gendoc category=channel type=description id=refunds
+# refunds
+#-gendoc
+#+gendoc category=pubOperation type=description id=placed channelId=orders
+# placed
+#-gendoc
+#+gendoc category=pubOperation type=description id=refunded channelId=refunds
+# refunded
+#-gendoc
+` + tt.messages,
+			})
+			a := services[0].AsyncAPI
+			for channel, want := range tt.want {
+				publish := a.Channels[channel].Publish
+				got := []string{}
+				if publish.Message != nil {
+					got = append(got, publish.Message.Ref)
+					for _, msg := range publish.Message.OneOf {
+						got = append(got, msg.Ref)
+					}
+				}
+				got = slices.DeleteFunc(got, func(ref string) bool { return ref == "" })
+				if !slices.Equal(got, want) {
+					t.Errorf("channel %s got refs %v, wanted %v", channel, got, want)
+				}
+				for _, msg := range a.OperationMessages(publish) {
+					if strings.TrimSpace(msg.Description) != msg.MessageId {
+						t.Errorf("message %s got description %q", msg.MessageId, msg.Description)
+					}
+				}
+			}
+			if want := strings.Count(tt.messages, "+gendoc"); len(a.Components.Messages) != want {
+				t.Errorf("got %d component messages, wanted each of the %d messages once", len(a.Components.Messages), want)
+			}
 
-	if len(got) != 2 {
-		t.Errorf("got (%v) wanted 2 services written out", len(got))
+			w := &bytes.Buffer{}
+			if err := generate.Render(w, a, generate.AsyncAPI2, generate.FormatYAML); err != nil {
+				t.Fatal(err)
+			}
+			rendered := &generate.AsyncAPIRoot{}
+			if err := yaml.Unmarshal(w.Bytes(), rendered); err != nil {
+				t.Fatalf("rendered AsyncAPI does not parse: %v\n%s", err, w.String())
+			}
+			if len(rendered.Components.Messages) != len(a.Components.Messages) {
+				t.Errorf("got %d rendered component messages, wanted %d", len(rendered.Components.Messages), len(a.Components.Messages))
+			}
+		})
 	}
+}
+
+func Test_ConstructService_converts_each_operation_on_its_own(t *testing.T) {
+	services := servicesFromFiles(t, map[string]string{
+		"svc.md": "<!--+gendoc category=info type=description -->\nservice\n<!---gendoc -->\n",
+		"ch.tf": `#+gendoc category=channel type=description id=orders
+# orders
+#-gendoc
+#+gendoc category=pubOperation type=summary id=placed channelId=orders
+# places orders
+#-gendoc
+#+gendoc category=pubOperation type=summary id=amended channelId=orders
+# amends orders
+#-gendoc
+#+gendoc category=subOperation type=summary id=fulfil channelId=orders
+# fulfils orders
+#-gendoc
+#+gendoc category=message type=description id=placed
+# placed
+#-gendoc
+#+gendoc category=message type=description id=amended
+# amended
+#-gendoc
+#+gendoc category=message type=description id=fulfil
+# fulfil
+#-gendoc
+`,
+	})
+	ch := services[0].AsyncAPI.Channels["orders"]
+
+	ttests := map[string]struct {
+		op      *generate.Operation
+		id      string
+		summary string
+		refs    []string
+	}{
+		"each operation keeps its own message": {ch.Operation("placed"), "placed", "places orders", []string{"#/components/messages/placed"}},
+		"subscribe":                            {ch.Subscribe, "fulfil", "fulfils orders", []string{"#/components/messages/fulfil"}},
+		"publish combines the operations":      {ch.Publish, "amended", "amends orders", []string{"#/components/messages/amended", "#/components/messages/placed"}},
+	}
+	for name, tt := range ttests {
+		t.Run(name, func(t *testing.T) {
+			if tt.op == nil {
+				t.Fatal("operation not found")
+			}
+			if tt.op.OperationId != tt.id || strings.TrimSpace(tt.op.Summary) != tt.summary {
+				t.Errorf("got operation %s %q, wanted %s %q", tt.op.OperationId, tt.op.Summary, tt.id, tt.summary)
+			}
+			got := []string{}
+			for _, ref := range append([]*generate.Message{tt.op.Message}, tt.op.Message.OneOf...) {
+				if ref.Ref != "" {
+					got = append(got, ref.Ref)
+				}
+			}
+			if !slices.Equal(got, tt.refs) {
+				t.Errorf("got messages %v, wanted %v", got, tt.refs)
+			}
+		})
+	}
+	if len(ch.Operations) != 3 {
+		t.Errorf("got %d operations, wanted 3", len(ch.Operations))
+	}
+}
 
-	// for _, file := range got {
-	// 	b, _ := os.ReadFile(file.Path)
-	// 	// fmt.Printf("file: %s\n\n%s\n\n", file.Path, string(b))
-	// }
+func Test_AsyncAPIFromProcessedTree_reports_combined_operations(t *testing.T) {
+	ttests := map[string]struct {
+		version generate.AsyncAPIVersion
+		// the warning of the operation dropped in the combined publish operation, empty when none
+		warning string
+	}{
+		"2.6 drops the second publish operation": {generate.AsyncAPI2, "channels.orders.publish combines placed into amended"},
+		"3.0 keeps each operation":               {generate.AsyncAPI3, ""},
+	}
+	for name, tt := range ttests {
+		t.Run(name, func(t *testing.T) {
+			g := generatorFromFiles(t, &generate.Config{InterimOutputDir: t.TempDir(), AsyncAPIVersion: tt.version}, map[string]string{
+				"svc.md": "<!--+gendoc category=info type=description -->\nservice\n<!---gendoc -->\n",
+				"ch.tf":  "#+gendoc category=channel type=description id=orders\n# orders\n#-gendoc\n#+gendoc category=pubOperation type=summary id=placed channelId=orders\n# places orders\n#-gendoc\n#+gendoc category=pubOperation type=summary id=amended channelId=orders\n# amends orders\n#-gendoc\n",
+			})
+			if err := g.AsyncAPIFromProcessedTree(); err != nil {
+				t.Fatal(err)
+			}
+			combined := g.CombinedOperations()
+			if tt.warning == "" {
+				if len(combined) > 0 {
+					t.Errorf("got %v, wanted no combined operations", combined)
+				}
+				return
+			}
+			if len(combined) != 1 {
+				t.Fatalf("got %d combined operations, wanted 1", len(combined))
+			}
+			d := combined[0]
+			if d.Code != "GD037" || d.Severity != diag.SeverityWarning || d.File != "ch.tf" || d.Line != 4 {
+				t.Errorf("got %s, wanted a GD037 warning at ch.tf:4", d)
+			}
+			if !strings.Contains(d.Message(), tt.warning) || !errors.Is(d.Err, generate.ErrCombinedOperations) {
+				t.Errorf("got %s, wanted %q", d.Message(), tt.warning)
+			}
+		})
+	}
+}
+
+func Test_NewTemplateProcessorFromDir(t *testing.T) {
+	services := servicesFromFiles(t, map[string]string{
+		"svc.md": "<!--+gendoc category=info type=description -->\nservice\n<!---gendoc -->\n",
+		"ch.tf": `#+gendoc category=channel type=description id=orders
+# orders
+#-gendoc
+#+gendoc category=pubOperation type=summary id=placed channelId=orders
+# places orders
+#-gendoc
+`,
+	})
+
+	ttests := map[string]struct {
+		files   map[string]string
+		entry   string
+		version generate.AsyncAPIVersion
+		want    string
+		err     error
+	}{
+		"overrides the embedded template": {
+			files:   map[string]string{generate.AsyncAPIRootCompleteTpl: "custom: {{ .Info.Title }}"},
+			version: generate.AsyncAPI2,
+			want:    "custom: svc",
+		},
+		"keeps the embedded templates not overridden": {
+			files:   map[string]string{generate.AsyncAPIRootCompleteTpl: "custom: {{ .Info.Title }}"},
+			version: generate.AsyncAPI3,
+			want:    "asyncapi: 3.0.0",
+		},
+		"adds an entry sharing the partials": {
+			files: map[string]string{
+				"summary.md":   "# {{ (service).Index.Val }}\n{{ template \"line\" (node \"channel\" \"orders\") }}",
+				"_helpers.tpl": `{{ define "line" }}- {{ .Index.Val }} {{ range leaves . }}{{ sourceLink . "{file}#L{line}-L{endLine}" }}{{ end }}{{ end }}`,
+			},
+			entry:   "summary.md",
+			version: generate.AsyncAPI2,
+			want:    "# svc\n- orders ch.tf#L1-L3",
+		},
+		"unknown entry": {
+			files: map[string]string{},
+			entry: "missing.md",
+			err:   generate.ErrTemplateNotFound,
+		},
+	}
+	for name, tt := range ttests {
+		t.Run(name, func(t *testing.T) {
+			dir := t.TempDir()
+			for name, content := range tt.files {
+				if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			tp, err := generate.NewTemplateProcessorFromDir(dir, tt.entry)
+			if tt.err != nil {
+				if !errors.Is(err, tt.err) {
+					t.Fatalf("got %v, wanted %v", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			w := &bytes.Buffer{}
+			if err := tp.GenerateService(w, services[0], tt.version); err != nil {
+				t.Fatal(err)
+			}
+			if !strings.Contains(w.String(), tt.want) {
+				t.Errorf("got:\n%s\nwanted it to contain:\n%s", w.String(), tt.want)
+			}
+		})
+	}
 }
@@ -0,0 +1,103 @@
+package generate
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"github.com/dnitsch/async-api-generator/internal/parser"
+)
+
+// nodeFuncs are the template functions looking up the nodes of the service being rendered
+//
+//   - service returns the node of the service
+//   - node returns the channel, operation or message below the service by category and id, nil when not found
+//   - leaves returns the blocks documenting a node in source order
+//   - sourceLink formats the location of a block, see sourceLink
+//
+// The templates are parsed with a nil service and bound to each service before it is rendered.
+func nodeFuncs(srvNode *parser.GenDocNode) template.FuncMap {
+	return template.FuncMap{
+		"service": func() *parser.GenDocNode { return srvNode },
+		"node": func(category, id string) *parser.GenDocNode {
+			return findNode(srvNode, category, id)
+		},
+		"leaves":     leafBlocks,
+		"sourceLink": sourceLink,
+	}
+}
+
+// findNode returns the first node of the category name, e.g. channel, with the id
+// at or below the node in breadth first order
+func findNode(node *parser.GenDocNode, category, id string) *parser.GenDocNode {
+	if node == nil {
+		return nil
+	}
+	seen := map[*parser.GenDocNode]bool{}
+	queue := []*parser.GenDocNode{node}
+	for len(queue) > 0 {
+		current := queue[0]
+		queue = queue[1:]
+		if seen[current] || current.IsLeaf {
+			continue
+		}
+		seen[current] = true
+		if current.Index.Typ.String() == category && current.Index.Val == id {
+			return current
+		}
+		queue = append(queue, current.Children...)
+	}
+	return nil
+}
+
+// leafBlocks returns the blocks of the leaf nodes of the node ordered by source path and line
+func leafBlocks(node *parser.GenDocNode) []*parser.GenDocBlock {
+	if node == nil {
+		return nil
+	}
+	leafs, _ := node.SortLeafNodes()
+	blocks := make([]*parser.GenDocBlock, 0, len(leafs))
+	for _, leaf := range leafs {
+		blocks = append(blocks, leaf.Value)
+	}
+	sort.SliceStable(blocks, func(i, j int) bool {
+		a, b := blocks[i].Token, blocks[j].Token
+		if a.Source.Path != b.Source.Path {
+			return a.Source.Path < b.Source.Path
+		}
+		return a.Line < b.Line
+	})
+	return blocks
+}
+
+// sourceLink formats the location of the block,
+// `<repoUrl>/<path>#L<line>` when the repo of the service is known or else `path:line`.
+//
+// An optional format replaces {repo}, {path}, {file}, {line} and {endLine},
+// e.g. "{repo}?path=/{path}&line={line}" links into an Azure DevOps repo.
+// The {path} has no leading slash so that it can be joined to the repo url.
+func sourceLink(block *parser.GenDocBlock, format ...string) (string, error) {
+	if block == nil {
+		return "", nil
+	}
+	if len(format) > 1 {
+		return "", fmt.Errorf("sourceLink takes a single format, got %d", len(format))
+	}
+	repo := strings.TrimSuffix(block.Annotation.ServiceRepoUrl, "/")
+	layout := "{repo}/{path}#L{line}"
+	switch {
+	case len(format) == 1:
+		layout = format[0]
+	case repo == "":
+		return blockSource(block), nil
+	}
+	return strings.NewReplacer(
+		"{repo}", repo,
+		"{path}", strings.TrimPrefix(strings.TrimPrefix(block.Token.Source.Path, "./"), "/"),
+		"{file}", block.Token.Source.File,
+		"{line}", strconv.Itoa(block.Token.Line),
+		"{endLine}", strconv.Itoa(block.EndToken.Line),
+	).Replace(layout), nil
+}
@@ -0,0 +1,208 @@
+package generate
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+
+	"github.com/dnitsch/async-api-generator/internal/diag"
+	"github.com/dnitsch/async-api-generator/internal/gendoc"
+	"github.com/dnitsch/async-api-generator/internal/parser"
+	"github.com/dnitsch/async-api-generator/internal/token"
+)
+
+var (
+	ErrDuplicateId              = errors.New("id is already documented with the same category and type")
+	ErrMissingParent            = errors.New("parent is not documented")
+	ErrOrphan                   = errors.New("is orphaned")
+	ErrChannelWithoutOperations = errors.New("channel has no operations")
+	ErrOperationWithoutMessages = errors.New("operation has no messages")
+	ErrValidation               = errors.New("validation failed")
+)
+
+// validation codes follow on from the parser codes
+const (
+	codeDuplicateId              = "GD030"
+	codeMissingParent            = "GD031"
+	codeOrphan                   = "GD032"
+	codeChannelWithoutOperations = "GD033"
+	codeOperationWithoutMessages = "GD034"
+)
+
+// Validate checks the processed blocks and the context tree for incomplete documentation
+//
+// Orphaned blocks are included as explained by Orphans.
+// All the findings are warnings, missing parents or children can be documented in another repo
+// and only come together in the global context.
+//
+// Must be called after BuildContextTree.
+func (g *Generate) Validate() diag.Diagnostics {
+	diags := g.duplicateIds()
+	diags = append(diags, g.missingParents()...)
+	diags = append(diags, g.orphans()...)
+	diags = append(diags, g.childlessNodes()...)
+	return diags
+}
+
+// blockDiagnostic positions the diagnostic at the begin marker of the block
+func blockDiagnostic(block *parser.GenDocBlock, severity diag.Severity, code string, err error) *diag.Diagnostic {
+	return &diag.Diagnostic{
+		File:     block.Token.Source.File,
+		Path:     block.Token.Source.Path,
+		Line:     block.Token.Line,
+		Column:   block.Token.Column,
+		Severity: severity,
+		Code:     code,
+		Err:      err,
+	}
+}
+
+// duplicateIds reports blocks documenting the same part of the same id more than once,
+// only one of them ends up in the AsyncAPI.
+//
+// Examples are exempt as a message can have several, as are nameId blocks which have no content.
+// Channels of different services with the same id are not duplicates unless shared.
+func (g *Generate) duplicateIds() diag.Diagnostics {
+	type docKey struct {
+		category    gendoc.CategoryType
+		contentType gendoc.ContentType
+		id          string
+		services    string
+	}
+	diags := diag.Diagnostics{}
+	seen := map[docKey]*parser.GenDocBlock{}
+	// the processed blocks come from concurrent parsing, ordering by position picks a stable first block
+	for _, block := range blocksByPosition(*g.processed) {
+		if block.Annotation.ContentType == gendoc.Example || block.Annotation.ContentType == gendoc.NameId {
+			continue
+		}
+		key := docKey{block.Annotation.CategoryType, block.Annotation.ContentType, block.Annotation.Id, ""}
+		if block.NodeCategory == parser.ChannelNode && !g.shared[block.Annotation.Id] {
+			key.services = block.Annotation.Parent.String()
+		}
+		first, found := seen[key]
+		if !found {
+			seen[key] = block
+			continue
+		}
+		diags = append(diags, blockDiagnostic(block, diag.SeverityWarning, codeDuplicateId,
+			fmt.Errorf("%s %s '%s' first documented at %s:%d: %w", key.category, key.contentType, key.id, first.Token.Source.File, first.Token.Line, ErrDuplicateId)))
+	}
+	return diags
+}
+
+func blocksByPosition(processed Processed) []*parser.GenDocBlock {
+	blocks := make([]*parser.GenDocBlock, len(processed))
+	for i := range processed {
+		blocks[i] = &processed[i]
+	}
+	sort.SliceStable(blocks, func(i, j int) bool {
+		a, b := blocks[i].Token, blocks[j].Token
+		if a.Source.Path != b.Source.Path {
+			return a.Source.Path < b.Source.Path
+		}
+		return a.Line < b.Line
+	})
+	return blocks
+}
+
+// missingParents reports the listed parents which are not documented anywhere
+//
+// Each missing parent is reported once per id at the first block listing it.
+// A parent which is documented but is itself orphaned is not reported here,
+// neither are the orphaned blocks.
+func (g *Generate) missingParents() diag.Diagnostics {
+	documented := map[parser.GenDocNodeKey]bool{}
+	// ids by category to suggest the nearest one for a likely typo
+	ids := map[parser.NodeCategory][]string{}
+	for _, block := range *g.processed {
+		key := *parser.NewGenDocNodeKey(block.NodeCategory, block.Annotation.Id)
+		if !documented[key] {
+			documented[key] = true
+			ids[block.NodeCategory] = append(ids[block.NodeCategory], block.Annotation.Id)
+		}
+	}
+	// orphaned blocks are explained by Orphans
+	orphaned := map[string]bool{}
+	for _, node := range g.tree.OrhpanedBranch().Children {
+		orphaned[tokenPosition(node.Value.Token)] = true
+	}
+	diags := diag.Diagnostics{}
+	reported := map[string]bool{}
+	for _, block := range blocksByPosition(*g.processed) {
+		if block.NodeCategory == parser.ServiceNode || orphaned[tokenPosition(block.Token)] {
+			continue
+		}
+		for _, ref := range parentRefs(block, block.NodeCategory) {
+			for _, id := range ref.ids {
+				parent := parser.NewGenDocNodeKey(ref.cat, id)
+				if documented[*parent] {
+					continue
+				}
+				if seen := fmt.Sprintf("%d:%s>%d:%s", block.NodeCategory, block.Annotation.Id, ref.cat, id); !reported[seen] {
+					reported[seen] = true
+					diags = append(diags, blockDiagnostic(block, diag.SeverityWarning, codeMissingParent,
+						fmt.Errorf("%s '%s' parent '%s': %w%s", block.Annotation.CategoryType, block.Annotation.Id, id, ErrMissingParent, gendoc.DidYouMean(id, ids[parent.Typ]))))
+				}
+			}
+		}
+	}
+	return diags
+}
+
+// orphans reports every orphaned block with the parent it was looking for
+func (g *Generate) orphans() diag.Diagnostics {
+	diags := diag.Diagnostics{}
+	for _, orphan := range g.Orphans() {
+		diags = append(diags, orphan.Diagnostic())
+	}
+	return diags
+}
+
+// childlessNodes reports channels without operations and operations without messages
+//
+// A node linked under several parents is only reported once.
+func (g *Generate) childlessNodes() diag.Diagnostics {
+	diags := diag.Diagnostics{}
+	visited := map[parser.GenDocNodeKey]bool{}
+	var walk func(node *parser.GenDocNode)
+	walk = func(node *parser.GenDocNode) {
+		_, children := node.SortLeafNodes()
+		for _, child := range children {
+			if visited[child.Index] {
+				continue
+			}
+			visited[child.Index] = true
+			switch {
+			case child.Index.Typ == parser.ChannelNode && !hasChildOf(child, parser.OperationNode):
+				diags = append(diags, blockDiagnostic(child.Value, diag.SeverityWarning, codeChannelWithoutOperations,
+					fmt.Errorf("channel '%s': %w", child.Index.Val, ErrChannelWithoutOperations)))
+			case child.Index.Typ == parser.OperationNode && !hasMessages(child):
+				diags = append(diags, blockDiagnostic(child.Value, diag.SeverityWarning, codeOperationWithoutMessages,
+					fmt.Errorf("operation '%s': %w", child.Index.Val, ErrOperationWithoutMessages)))
+			}
+			walk(child)
+		}
+	}
+	walk(g.tree.ParentedBranch())
+	return diags
+}
+
+// hasChildOf reports whether the node has a non leaf child of the category
+func hasChildOf(node *parser.GenDocNode, cat parser.NodeCategory) bool {
+	_, children := node.SortLeafNodes()
+	return slices.ContainsFunc(children, func(child *parser.GenDocNode) bool { return child.Index.Typ == cat })
+}
+
+// hasMessages reports whether the operation or any of its channels has messages
+func hasMessages(op *parser.GenDocNode) bool {
+	return hasChildOf(op, parser.MessageNode) || slices.ContainsFunc(op.Parents(), func(ch *parser.GenDocNode) bool {
+		return hasChildOf(ch, parser.MessageNode)
+	})
+}
+
+// tokenPosition identifies the token by its position in the source
+func tokenPosition(tok token.Token) string {
+	return fmt.Sprintf("%s:%d:%d", tok.Source.Path, tok.Line, tok.Column)
+}
@@ -0,0 +1,173 @@
+package generate_test
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/dnitsch/async-api-generator/internal/diag"
+	"github.com/dnitsch/async-api-generator/internal/fshelper"
+	"github.com/dnitsch/async-api-generator/internal/generate"
+	"github.com/dnitsch/async-api-generator/internal/parser"
+	log "github.com/dnitsch/simplelog"
+)
+
+func validateFiles(t *testing.T, files map[string]string) diag.Diagnostics {
+	t.Helper()
+	dir := t.TempDir()
+	inputs := []*fshelper.FileList{}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		inputs = append(inputs, &fshelper.FileList{Name: name, Path: path})
+	}
+	g := generate.New(&generate.Config{Mode: parser.Validate, ParserConfig: parser.Config{ServiceId: "svc"}}, log.New(&bytes.Buffer{}, log.ErrorLvl))
+	g.LoadInputsFromFiles(inputs)
+	if err := g.GenDocBlox(); err != nil {
+		t.Fatal(err)
+	}
+	if err := g.BuildContextTree(); err != nil {
+		t.Fatal(err)
+	}
+	diags := g.Validate()
+	if err := g.AsyncAPIFromProcessedTree(); err != nil {
+		t.Fatal(err)
+	}
+	return diags
+}
+
+func Test_Validate_reports_incomplete_documentation(t *testing.T) {
+	ttests := map[string]struct {
+		files map[string]string
+		want  []error
+	}{
+		"complete": {
+			files: map[string]string{
+				"svc.md": "<!--+gendoc category=info type=description -->\nservice\n<!---gendoc -->\n",
+				"ch.tf": `#+gendoc category=channel type=description id=topic
+# topic
+#-gendoc
+#+gendoc category=pubOperation type=description id=evt channelId=topic
+# operation
+#-gendoc
+#+gendoc category=message type=description id=evt
+# message
+#-gendoc
+`,
+			},
+			want: nil,
+		},
+		"duplicate id": {
+			files: map[string]string{
+				"a.md": "<!--+gendoc category=info type=description -->\nservice\n<!---gendoc -->\n",
+				"b.md": "<!--+gendoc category=info type=description -->\nagain\n<!---gendoc -->\n",
+			},
+			want: []error{generate.ErrDuplicateId},
+		},
+		"missing parent reported once": {
+			files: map[string]string{
+				"svc.md": "<!--+gendoc category=info type=description -->\nservice\n<!---gendoc -->\n",
+				"ch.tf": `#+gendoc category=channel type=description id=topic parent=[svc, other]
+# topic
+#-gendoc
+#+gendoc category=channel type=summary id=topic parent=[svc, other]
+# topic
+#-gendoc
+`,
+			},
+			want: []error{generate.ErrMissingParent, generate.ErrChannelWithoutOperations},
+		},
+		"channel without operations": {
+			files: map[string]string{
+				"svc.md": "<!--+gendoc category=info type=description -->\nservice\n<!---gendoc -->\n",
+				"ch.tf":  "#+gendoc category=channel type=description id=topic\n# topic\n#-gendoc\n",
+			},
+			want: []error{generate.ErrChannelWithoutOperations},
+		},
+		"operation without messages": {
+			files: map[string]string{
+				"svc.md": "<!--+gendoc category=info type=description -->\nservice\n<!---gendoc -->\n",
+				"ch.tf": `#+gendoc category=channel type=description id=topic
+# topic
+#-gendoc
+#+gendoc category=subOperation type=description id=evt channelId=topic
+# operation
+#-gendoc
+`,
+			},
+			want: []error{generate.ErrOperationWithoutMessages},
+		},
+		"message attached to the channel": {
+			files: map[string]string{
+				"svc.md": "<!--+gendoc category=info type=description -->\nservice\n<!---gendoc -->\n",
+				"ch.tf": `#+gendoc category=channel type=description id=topic
+# topic
+#-gendoc
+#+gendoc category=subOperation type=description id=evt channelId=topic
+# operation
+#-gendoc
+#+gendoc category=message type=description id=created channelId=topic
+# message
+#-gendoc
+`,
+			},
+			want: nil,
+		},
+		"orphan schema": {
+			files: map[string]string{
+				"svc.md":          "<!--+gendoc category=info type=description -->\nservice\n<!---gendoc -->\n",
+				"evt.schema.json": `{"type": "object"}`,
+			},
+			want: []error{generate.ErrOrphan},
+		},
+	}
+	for name, tt := range ttests {
+		t.Run(name, func(t *testing.T) {
+			got := validateFiles(t, tt.files)
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %d diagnostics, wanted %d\n%s", len(got), len(tt.want), got)
+			}
+			for i, want := range tt.want {
+				if !errors.Is(got[i], want) {
+					t.Errorf("got %v, wanted %v", got[i], want)
+				}
+				if got[i].Severity != diag.SeverityWarning || got[i].Code == "" {
+					t.Errorf("got severity %s code %q, wanted a coded warning", got[i].Severity, got[i].Code)
+				}
+			}
+		})
+	}
+}
+
+func Test_Validate_suggests_nearest_parent(t *testing.T) {
+	ttests := map[string]struct {
+		channel string
+		want    error
+		suggest string
+	}{
+		"partially attached": {"#+gendoc category=subOperation type=description id=created channelId=[orders, order]\n# op\n#-gendoc\n", generate.ErrMissingParent, "did you mean 'orders'?"},
+		"orphaned":           {"#+gendoc category=subOperation type=description id=created channelId=order\n# op\n#-gendoc\n", generate.ErrOrphan, "closest: orders"},
+	}
+	for name, tt := range ttests {
+		t.Run(name, func(t *testing.T) {
+			got := validateFiles(t, map[string]string{
+				"svc.md": "<!--+gendoc category=info type=description -->\nservice\n<!---gendoc -->\n",
+				"ch.tf":  "#+gendoc category=channel type=description id=orders\n# orders\n#-gendoc\n" + tt.channel,
+			})
+			for _, d := range got {
+				if errors.Is(d, tt.want) {
+					if !strings.Contains(d.Message(), tt.suggest) {
+						t.Errorf("got: %s, wanted: %s", d.Message(), tt.suggest)
+					}
+					return
+				}
+			}
+			t.Fatalf("%v not reported\n%s", tt.want, got)
+		})
+	}
+}
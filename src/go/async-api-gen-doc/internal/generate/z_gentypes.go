@@ -13,6 +13,8 @@ type AsyncAPIRoot struct {
 	Channels           map[string]Channel `json:"channels" yaml:"channels"`
 	Components         *Components        `json:"components,omitempty" yaml:"components,omitempty"`
 	Tags               []Tag              `json:"tags,omitempty" yaml:"tags,omitempty"`
+	// Sources records where the fields documented with conflicting values were taken from
+	Sources []MergedSource `json:"x-gendoc-sources,omitempty" yaml:"x-gendoc-sources,omitempty"`
 }
 
 type Info struct {
@@ -20,8 +22,8 @@ type Info struct {
 	Version        string  `json:"version" yaml:"version"`
 	Description    string  `json:"description,omitempty" yaml:"description,omitempty"`
 	TermsOfService string  `json:"termsOfService,omitempty" yaml:"termsOfService,omitempty"`
-	Contact        Contact `json:"contact,omitempty" yaml:"contact,omitempty"`
-	License        License `json:"license,omitempty" yaml:"license,omitempty"`
+	Contact        *Contact `json:"contact,omitempty" yaml:"contact,omitempty"`
+	License        *License `json:"license,omitempty" yaml:"license,omitempty"`
 }
 
 type Server struct {
@@ -44,6 +46,10 @@ type Channel struct {
 	Parameters  map[string]Parameter `json:"parameters,omitempty" yaml:"parameters,omitempty"`
 	Publish     *Operation           `json:"publish,omitempty" yaml:"publish,omitempty"` // Channel will be writeable topic or queue or readable subscription or read from queu yaml:"publish,omitempty"` // Channel will be writeable topic or queue or readable subscription or read from queue
 	Subscribe   *Operation           `json:"subscribe,omitempty" yaml:"subscribe,omitempty"`
+	// Operations are all the operations of the channel in id order, each with its own message
+	Operations []*Operation `json:"-" yaml:"-"`
+	// Messages reference the messages attached directly to the channel
+	Messages []*Message `json:"-" yaml:"-"`
 }
 
 type Parameter struct {
@@ -58,6 +64,8 @@ type Operation struct {
 	Traits      []interface{} `json:"traits,omitempty" yaml:"traits,omitempty"`
 	Message     *Message       `json:"message,omitempty" yaml:"message,omitempty"`
 	Bindings    []interface{} `json:"bindings,omitempty" yaml:"bindings,omitempty"`
+	// Action is either ActionPublish or ActionSubscribe, empty for the generic operation category
+	Action string `json:"-" yaml:"-"`
 }
 
 type CommonDescription struct {
@@ -68,6 +76,10 @@ type CommonDescription struct {
 }
 
 type Message struct {
+	// Ref points to the message in the components, the other fields are then empty
+	Ref string `json:"$ref,omitempty" yaml:"$ref,omitempty"`
+	// OneOf lists the messages of an operation with several, the other fields are then empty
+	OneOf []*Message `json:"oneOf,omitempty" yaml:"oneOf,omitempty"`
 	// MessageBodyShared `json:"inline" yaml:"inline"`
 	Name         string                `json:"name,omitempty" yaml:"name,omitempty"`
 	Summary      string                `json:"summary,omitempty" yaml:"summary,omitempty"`
@@ -75,10 +87,11 @@ type Message struct {
 	Headers      []map[string]Schema   `json:"headers,omitempty" yaml:"headers,omitempty"`
 	Title        string                `json:"title,omitempty" yaml:"title,omitempty"`
 	Description  string                `json:"description,omitempty" yaml:"description,omitempty"`
-	MessageId    string                `json:"messageId" yaml:"messageId"`
-	Examples     []MessageBodyShared   `json:"examples,omitempty" yaml:"examples,omitempty"`
+	MessageId    string                `json:"messageId,omitempty" yaml:"messageId,omitempty"`
+	// Examples are rendered as comments for EventCatalog, they are not AsyncAPI examples
+	Examples     []MessageBodyShared   `json:"-" yaml:"-"`
 	Tags         []Tag                 `json:"tags,omitempty" yaml:"tags,omitempty"`
-	ExternalDocs ExternalDocumentation `json:"externalDocs,omitempty" yaml:"externalDocs,omitempty"`
+	ExternalDocs *ExternalDocumentation `json:"externalDocs,omitempty" yaml:"externalDocs,omitempty"`
 }
 
 // Schema was changed to be an interface type - i.e. any
@@ -0,0 +1,57 @@
+package generate
+
+// the AsyncAPI 3.0 shape of the document, channels have an address and the messages on it
+// and the operations sit at the top level referencing their channel
+// NOTE: only the parts populated from the annotations are modelled
+
+// AsyncAPIRootV3
+type AsyncAPIRootV3 struct {
+	AsyncAPI           string                 `json:"asyncapi" yaml:"asyncapi"`
+	ID                 string                 `json:"id" yaml:"id"`
+	Info               InfoV3                 `json:"info" yaml:"info"`
+	DefaultContentType string                 `json:"defaultContentType,omitempty" yaml:"defaultContentType,omitempty"`
+	Channels           map[string]ChannelV3   `json:"channels,omitempty" yaml:"channels,omitempty"`
+	Operations         map[string]OperationV3 `json:"operations,omitempty" yaml:"operations,omitempty"`
+	Components         *ComponentsV3          `json:"components,omitempty" yaml:"components,omitempty"`
+	// Sources records where the fields documented with conflicting values were taken from
+	Sources []MergedSource `json:"x-gendoc-sources,omitempty" yaml:"x-gendoc-sources,omitempty"`
+}
+
+type InfoV3 struct {
+	Title       string `json:"title" yaml:"title"`
+	Version     string `json:"version" yaml:"version"`
+	Description string `json:"description,omitempty" yaml:"description,omitempty"`
+	Tags        []Tag  `json:"tags,omitempty" yaml:"tags,omitempty"`
+}
+
+type ChannelV3 struct {
+	Address     string               `json:"address" yaml:"address"`
+	Description string               `json:"description,omitempty" yaml:"description,omitempty"`
+	Messages    map[string]Reference `json:"messages,omitempty" yaml:"messages,omitempty"`
+}
+
+type OperationV3 struct {
+	Action      string      `json:"action" yaml:"action"`
+	Channel     Reference   `json:"channel" yaml:"channel"`
+	Summary     string      `json:"summary,omitempty" yaml:"summary,omitempty"`
+	Description string      `json:"description,omitempty" yaml:"description,omitempty"`
+	Messages    []Reference `json:"messages,omitempty" yaml:"messages,omitempty"`
+}
+
+type MessageV3 struct {
+	Name        string              `json:"name,omitempty" yaml:"name,omitempty"`
+	Title       string              `json:"title,omitempty" yaml:"title,omitempty"`
+	Summary     string              `json:"summary,omitempty" yaml:"summary,omitempty"`
+	Description string              `json:"description,omitempty" yaml:"description,omitempty"`
+	ContentType string              `json:"contentType,omitempty" yaml:"contentType,omitempty"`
+	Payload     any                 `json:"payload,omitempty" yaml:"payload,omitempty"`
+	Examples    []MessageBodyShared `json:"-" yaml:"-"`
+}
+
+type ComponentsV3 struct {
+	Messages map[string]MessageV3 `json:"messages,omitempty" yaml:"messages,omitempty"`
+}
+
+type Reference struct {
+	Ref string `json:"$ref" yaml:"$ref"`
+}
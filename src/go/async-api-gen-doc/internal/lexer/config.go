@@ -0,0 +1,244 @@
+package lexer
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/dnitsch/async-api-generator/internal/token"
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	ErrInvalidKeyword       = errors.New("marker keyword must be a single word")
+	ErrInvalidCommentSyntax = errors.New("comment syntax must have a name and either a line leader or an open and close pair")
+	ErrUnknownCommentSyntax = errors.New("comment syntax is not defined")
+	ErrInvalidGlob          = errors.New("file glob is not a valid pattern")
+)
+
+// DefaultKeyword is used in the markers when no keyword is configured
+const DefaultKeyword string = "gendoc"
+
+// CommentSyntax describes a comment style in which the markers can be written
+//
+// Line comment styles only set Line, e.g. `#`, and the marker annotation ends at the line break.
+// Block comment styles set Open and Close, e.g. `/*` and `*/`,
+// the marker annotation additionally ends at Close on the same line.
+type CommentSyntax struct {
+	Name  string `yaml:"name"`
+	Line  string `yaml:"line,omitempty"`
+	Open  string `yaml:"open,omitempty"`
+	Close string `yaml:"close,omitempty"`
+}
+
+// leader returns the literal preceding the marker keyword
+func (c CommentSyntax) leader() string {
+	if c.Line != "" {
+		return c.Line
+	}
+	return c.Open
+}
+
+// TokenTypes returns the begin and end marker token types emitted for the syntax
+func (c CommentSyntax) TokenTypes() (begin, end token.TokenType) {
+	// the double slash syntax predates the others and has no suffix
+	if c.Name == slashSyntax {
+		return token.BEGIN_DOC_GEN, token.END_DOC_GEN
+	}
+	return token.DocGenMarkers(c.Name)
+}
+
+// FileSyntax restricts the comment syntaxes recognised in the files matched by Glob
+//
+// A Glob without a path separator is matched against the file name, e.g. `*.tf`,
+// otherwise it is matched against the trailing segments of the path, e.g. `infra/*.yml`.
+type FileSyntax struct {
+	Glob     string   `yaml:"glob"`
+	Syntaxes []string `yaml:"syntaxes"`
+}
+
+// Config holds the marker keyword and the comment syntaxes the lexer recognises
+//
+// The markers are the keyword prefixed with `+` and `-`, e.g. `+gendoc` and `-gendoc`.
+// Files not matched by any of the Files globs recognise all the Syntaxes.
+type Config struct {
+	Keyword  string          `yaml:"keyword"`
+	Syntaxes []CommentSyntax `yaml:"syntaxes"`
+	Files    []FileSyntax    `yaml:"files"`
+}
+
+const slashSyntax = "slash"
+
+// DefaultConfig returns the built-in comment syntaxes with the default keyword
+func DefaultConfig() *Config {
+	return &Config{
+		Keyword: DefaultKeyword,
+		Syntaxes: []CommentSyntax{
+			{Name: slashSyntax, Line: "//"},
+			{Name: "hash", Line: "#"},
+			{Name: "double_dash", Line: "--"},
+			{Name: "block", Open: "/*", Close: "*/"},
+			{Name: "html", Open: "<!--", Close: "-->"},
+		},
+	}
+}
+
+// LoadConfig reads a YAML lexer config from the path
+//
+// The file is layered on top of DefaultConfig,
+// syntaxes with the same name as a built-in one replace it.
+//
+//	keyword: asyncapi
+//	syntaxes:
+//	  - name: semicolon
+//	    line: ";"
+//	files:
+//	  - glob: "*.tf"
+//	    syntaxes: [hash, slash, block]
+func LoadConfig(path string) (*Config, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	loaded := &Config{}
+	if err := yaml.Unmarshal(b, loaded); err != nil {
+		return nil, fmt.Errorf("lexer config %s: %w", path, err)
+	}
+	conf := DefaultConfig()
+	if loaded.Keyword != "" {
+		conf.Keyword = loaded.Keyword
+	}
+	for _, syntax := range loaded.Syntaxes {
+		conf.setSyntax(syntax)
+	}
+	conf.Files = loaded.Files
+	if err := conf.Validate(); err != nil {
+		return nil, fmt.Errorf("lexer config %s: %w", path, err)
+	}
+	return conf, nil
+}
+
+func (c *Config) setSyntax(syntax CommentSyntax) {
+	for i, existing := range c.Syntaxes {
+		if existing.Name == syntax.Name {
+			c.Syntaxes[i] = syntax
+			return
+		}
+	}
+	c.Syntaxes = append(c.Syntaxes, syntax)
+}
+
+// Validate ensures the config can be used by the lexer
+func (c *Config) Validate() error {
+	if c.Keyword == "" || strings.ContainsAny(c.Keyword, " \t\n\r") {
+		return fmt.Errorf("keyword '%s': %w", c.Keyword, ErrInvalidKeyword)
+	}
+	names := map[string]bool{}
+	for _, syntax := range c.Syntaxes {
+		if syntax.Name == "" || (syntax.Line == "" && (syntax.Open == "" || syntax.Close == "")) {
+			return fmt.Errorf("syntax '%s': %w", syntax.Name, ErrInvalidCommentSyntax)
+		}
+		names[syntax.Name] = true
+	}
+	for _, file := range c.Files {
+		if _, err := filepath.Match(file.Glob, ""); err != nil {
+			return fmt.Errorf("glob '%s': %w", file.Glob, ErrInvalidGlob)
+		}
+		for _, name := range file.Syntaxes {
+			if !names[name] {
+				return fmt.Errorf("glob '%s' syntax '%s': %w", file.Glob, name, ErrUnknownCommentSyntax)
+			}
+		}
+	}
+	return nil
+}
+
+// SyntaxesFor returns the comment syntaxes recognised in the file
+//
+// The first matching Files glob wins.
+func (c *Config) SyntaxesFor(path string) []CommentSyntax {
+	for _, file := range c.Files {
+		if matchGlob(file.Glob, path) {
+			return c.syntaxesByName(file.Syntaxes)
+		}
+	}
+	return c.Syntaxes
+}
+
+func (c *Config) syntaxesByName(names []string) []CommentSyntax {
+	syntaxes := []CommentSyntax{}
+	for _, syntax := range c.Syntaxes {
+		for _, name := range names {
+			if syntax.Name == name {
+				syntaxes = append(syntaxes, syntax)
+			}
+		}
+	}
+	return syntaxes
+}
+
+func matchGlob(glob, path string) bool {
+	path = filepath.ToSlash(path)
+	if !strings.Contains(glob, "/") {
+		ok, _ := filepath.Match(glob, filepath.Base(path))
+		return ok
+	}
+	segments := strings.Split(path, "/")
+	for i := range segments {
+		if ok, _ := filepath.Match(glob, strings.Join(segments[i:], "/")); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// beginMarker returns the keyword as a begin marker, e.g. `+gendoc`
+func (c *Config) beginMarker() string {
+	return "+" + c.Keyword
+}
+
+// endMarker returns the keyword as an end marker, e.g. `-gendoc`
+func (c *Config) endMarker() string {
+	return "-" + c.Keyword
+}
+
+// markerSyntaxes orders the syntaxes so that the longest leader is tried first
+func markerSyntaxes(syntaxes []CommentSyntax) []CommentSyntax {
+	sorted := append([]CommentSyntax{}, syntaxes...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return len(sorted[i].leader()) > len(sorted[j].leader())
+	})
+	return sorted
+}
+
+// ContainsMarker reports whether the input contains the begin marker keyword.
+//
+// It is a cheap check to run ahead of tokenising, the input is streamed in chunks
+// so that files without any markers, e.g. lockfiles or binaries, can be skipped.
+func (c *Config) ContainsMarker(r io.Reader) (bool, error) {
+	keyword := []byte(c.beginMarker())
+	decoded := decodeReader(r)
+	buf := make([]byte, 32*1024)
+	tail := 0
+	for {
+		n, err := decoded.Read(buf[tail:])
+		if bytes.Contains(buf[:tail+n], keyword) {
+			return true, nil
+		}
+		if err == io.EOF {
+			return false, nil
+		}
+		if err != nil {
+			return false, err
+		}
+		// keep the end of the chunk in case the keyword spans two reads
+		keep := min(len(keyword)-1, tail+n)
+		copy(buf, buf[tail+n-keep:tail+n])
+		tail = keep
+	}
+}
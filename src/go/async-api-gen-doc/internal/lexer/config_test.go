@@ -0,0 +1,93 @@
+package lexer_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/dnitsch/async-api-generator/internal/lexer"
+)
+
+func Test_LoadConfig_layers_on_top_of_defaults(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "lexer.yml")
+	conf := `keyword: asyncapi
+syntaxes:
+  - name: semicolon
+    line: ";"
+  - name: hash
+    line: "##"
+files:
+  - glob: "*.dsl"
+    syntaxes: [semicolon]
+  - glob: "infra/*.yml"
+    syntaxes: [hash]
+`
+	if err := os.WriteFile(path, []byte(conf), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	got, err := lexer.LoadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Keyword != "asyncapi" {
+		t.Errorf("keyword got: %s, wanted: asyncapi", got.Keyword)
+	}
+	if len(got.Syntaxes) != len(lexer.DefaultConfig().Syntaxes)+1 {
+		t.Errorf("got %d syntaxes, wanted the defaults plus one", len(got.Syntaxes))
+	}
+
+	ttests := map[string]struct {
+		path string
+		want []string
+	}{
+		"matched by file name":      {"/repo/src/order.dsl", []string{"semicolon"}},
+		"matched by path segments":  {"/repo/infra/deploy.yml", []string{"hash"}},
+		"not matched uses all":      {"/repo/src/order.cs", nil},
+		"path glob needs directory": {"/repo/deploy.yml", nil},
+	}
+	for name, tt := range ttests {
+		t.Run(name, func(t *testing.T) {
+			syntaxes := got.SyntaxesFor(tt.path)
+			if tt.want == nil {
+				if len(syntaxes) != len(got.Syntaxes) {
+					t.Errorf("got %d syntaxes, wanted all %d", len(syntaxes), len(got.Syntaxes))
+				}
+				return
+			}
+			if len(syntaxes) != len(tt.want) {
+				t.Fatalf("got %v, wanted %v", syntaxes, tt.want)
+			}
+			for i, syntax := range syntaxes {
+				if syntax.Name != tt.want[i] {
+					t.Errorf("got %s, wanted %s", syntax.Name, tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func Test_LoadConfig_failure(t *testing.T) {
+	ttests := map[string]struct {
+		conf string
+		want error
+	}{
+		"keyword with whitespace":  {"keyword: two words", lexer.ErrInvalidKeyword},
+		"syntax without leader":    {"syntaxes:\n  - name: broken\n", lexer.ErrInvalidCommentSyntax},
+		"block without close":      {"syntaxes:\n  - name: broken\n    open: \"(*\"\n", lexer.ErrInvalidCommentSyntax},
+		"unknown syntax on a glob": {"files:\n  - glob: \"*.tf\"\n    syntaxes: [nope]\n", lexer.ErrUnknownCommentSyntax},
+		"invalid glob":             {"files:\n  - glob: \"[\"\n    syntaxes: [hash]\n", lexer.ErrInvalidGlob},
+	}
+	for name, tt := range ttests {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "lexer.yml")
+			if err := os.WriteFile(path, []byte(tt.conf), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			_, err := lexer.LoadConfig(path)
+			if !errors.Is(err, tt.want) {
+				t.Errorf("got: %v, wanted: %v", err, tt.want)
+			}
+		})
+	}
+}
@@ -4,62 +4,139 @@
 package lexer
 
 import (
+	"bufio"
+	"io"
 	"strings"
+	"unicode/utf8"
 
 	"github.com/dnitsch/async-api-generator/internal/token"
+	"golang.org/x/text/encoding/unicode"
+	"golang.org/x/text/transform"
 )
 
 const (
-	// Literals
-	BEGIN_DOC string = "+gendoc"
-	END_DOC   string = "-gendoc"
+	// Literals used with the DefaultKeyword
+	BEGIN_DOC string = "+" + DefaultKeyword
+	END_DOC   string = "-" + DefaultKeyword
 )
 
 // nonText characters captures all character sets that are _not_ assignable to TEXT
-var nonText = map[string]bool{" ": true, "\n": true, "\r": true, "\t": true}
+var nonText = map[rune]bool{' ': true, '\n': true, '\r': true, '\t': true}
 
 type Source struct {
-	Input    string
+	Input    io.Reader
 	FileName string
 	FullPath string
 }
 
 // Lexer
 type Lexer struct {
-	length       int
-	source       Source
-	position     int  // current position in input (points to current char)
-	readPosition int  // current reading position in input (after current char)
-	ch           byte // current char under examination
-	line         int  // current line - start at 1
-	column       int  // column of text - gets set to 0 on every new line - start at 0
+	reader *bufio.Reader
+	ahead  []rune // chars read from the reader for peeking but not yet consumed
+	err    error  // first non EOF error returned by the reader
+	source Source
+	ch     rune // current char under examination
+	line   int  // current line - start at 1
+	column int  // column of the current char - gets set to 0 on every new line, the first char is at 1
+	// marker keywords and the comment syntaxes recognised in the source
+	begin    string
+	end      string
+	syntaxes []CommentSyntax
 }
 
 // New returns a Lexer pointer allocation
+//
+// The input is streamed and decoded to UTF-8, see decodeReader,
+// then walked rune by rune so that Line and Column on tokens point at characters rather than bytes.
+// Only the few chars required for peeking are held in memory.
 func New(source Source) *Lexer {
-
-	l := &Lexer{source: source, line: 1, column: 0, length: len(source.Input)}
+	input := source.Input
+	if input == nil {
+		input = strings.NewReader("")
+	}
+	l := &Lexer{source: source, reader: bufio.NewReader(decodeReader(input)), line: 1, column: 0}
 	l.readChar()
+	return l.WithConfig(DefaultConfig())
+}
+
+// WithConfig sets the marker keyword and
+// the comment syntaxes recognised in the source file
+func (l *Lexer) WithConfig(conf *Config) *Lexer {
+	l.begin = conf.beginMarker()
+	l.end = conf.endMarker()
+	l.syntaxes = markerSyntaxes(conf.SyntaxesFor(l.source.FullPath))
 	return l
 }
 
+// CommentLeader returns the line comment leader of the syntax
+// which emits the begin marker type, empty for block comment syntaxes
+func (l *Lexer) CommentLeader(typ token.TokenType) string {
+	syntax, _ := l.Syntax(typ)
+	return syntax.Line
+}
+
+// Syntax returns the comment syntax recognised in the source which emits the begin marker type
+func (l *Lexer) Syntax(typ token.TokenType) (CommentSyntax, bool) {
+	for _, syntax := range l.syntaxes {
+		if begin, _ := syntax.TokenTypes(); begin == typ {
+			return syntax, true
+		}
+	}
+	return CommentSyntax{}, false
+}
+
+// IsLineComment reports whether the literal is a line comment leader in the source
+func (l *Lexer) IsLineComment(literal string) bool {
+	for _, syntax := range l.syntaxes {
+		if syntax.Line != "" && syntax.Line == literal {
+			return true
+		}
+	}
+	return false
+}
+
+// decodeReader strips a UTF-8 byte order mark and decodes UTF-16 input
+// which starts with a byte order mark.
+//
+// Input without a byte order mark is treated as UTF-8.
+func decodeReader(r io.Reader) io.Reader {
+	return transform.NewReader(r, unicode.BOMOverride(transform.Nop))
+}
+
+// Err returns the first error, other than io.EOF, encountered while reading the input.
+//
+// The lexer emits an EOF token when reading fails.
+func (l *Lexer) Err() error {
+	return l.err
+}
+
 // NextToken advances through the source returning a found token
+//
+// Begin and end markers are recognised in all the configured comment styles,
+// each style is emitted as its own token type. The built-in styles are:
+//
+//	//+gendoc ... //-gendoc
+//	#+gendoc ... #-gendoc
+//	--+gendoc ... ---gendoc
+//	/*+gendoc ... */ ... /*-gendoc */
+//	<!--+gendoc ... --> ... <!---gendoc -->
 func (l *Lexer) NextToken() token.Token {
 	var tok token.Token
+	// tokens are positioned at their first char
+	line, column := l.line, l.column
+
+	if marker, found := l.readMarker(); found {
+		l.setPosition(&marker, line, column)
+		l.readChar()
+		return marker
+	}
 
 	switch l.ch {
 	case '/':
 		if l.peekChar() == '/' {
 			// if next char is a `/` then we have to consume it from lexer
 			l.readChar()
-			if l.peekIsDocGenBegin() {
-				tok = l.readDocAnnotation(token.Token{Type: token.BEGIN_DOC_GEN, Literal: "//+gendoc"})
-			} else if l.peekIsDocGenEnd() {
-				tok = token.Token{Type: token.END_DOC_GEN, Literal: "//-gendoc"}
-			} else {
-				// it is not a doc gen marker assigning double slash as text
-				tok = token.Token{Type: token.DOUBLE_FORWARD_SLASH, Literal: "//"}
-			}
+			tok = token.Token{Type: token.DOUBLE_FORWARD_SLASH, Literal: "//"}
 		} else {
 			tok = token.Token{Type: token.FORWARD_SLASH, Literal: "/"}
 		}
@@ -73,9 +150,8 @@ func (l *Lexer) NextToken() token.Token {
 	case '-':
 		tok = l.htmlCommentTextToken("-->", token.END_HTML_COMMENT)
 	case '\n':
-		l.line = l.line + 1
-		l.column = 0 // reset column count
 		tok = l.setTextSeparatorToken()
+		l.newLine()
 		// want to preserve all indentations and punctuation
 	case ' ', '\r', '\t', '\f':
 		tok = l.setTextSeparatorToken()
@@ -86,45 +162,88 @@ func (l *Lexer) NextToken() token.Token {
 		if isText(l.ch) {
 			tok.Literal = l.readText()
 			tok.Type = token.TEXT
+			l.setPosition(&tok, line, column)
 			return tok
 		}
 		tok = newToken(token.ILLEGAL, l.ch)
 	}
-	// add general properties to each token
-	tok.Line = l.line
-	tok.Column = l.column
-	tok.Source = token.Source{Path: l.source.FullPath, File: l.source.FileName}
+	l.setPosition(&tok, line, column)
 	l.readChar()
 	return tok
 }
 
+// setPosition adds general properties to each token
+func (l *Lexer) setPosition(tok *token.Token, line, column int) {
+	tok.Line = line
+	tok.Column = column
+	tok.Source = token.Source{Path: l.source.FullPath, File: l.source.FileName}
+}
+
+// newLine resets the column count once a line break has been consumed
+func (l *Lexer) newLine() {
+	l.line = l.line + 1
+	l.column = 0
+}
+
 // readChar moves cursor along
 func (l *Lexer) readChar() {
-	if l.readPosition >= l.length {
-		l.ch = 0
+	if len(l.ahead) > 0 {
+		l.ch = l.ahead[0]
+		l.ahead = l.ahead[1:]
 	} else {
-		l.ch = l.source.Input[l.readPosition]
+		l.ch = l.readRune()
 	}
-	l.position = l.readPosition
-	l.readPosition += 1
 	l.column += 1
 }
 
-// peekChar reveals next char withouh advancing the cursor along
-func (l *Lexer) peekChar() byte {
-	if l.readPosition >= l.length {
+// readRune reads the next char from the input
+// CRLF line endings are normalised to LF
+//
+// Returns 0 once the input is exhausted
+func (l *Lexer) readRune() rune {
+	ch, _, err := l.reader.ReadRune()
+	if err != nil {
+		if err != io.EOF && l.err == nil {
+			l.err = err
+		}
 		return 0
-	} else {
-		return l.source.Input[l.readPosition]
 	}
+	if ch == '\r' {
+		if next, _, err := l.reader.ReadRune(); err == nil {
+			if next == '\n' {
+				return next
+			}
+			_ = l.reader.UnreadRune()
+		}
+	}
+	return ch
+}
+
+// peekAt reveals the char at the offset after the current char
+// without advancing the cursor along, 0 is the next char
+func (l *Lexer) peekAt(offset int) rune {
+	for len(l.ahead) <= offset {
+		ch := l.readRune()
+		if ch == 0 {
+			return 0
+		}
+		l.ahead = append(l.ahead, ch)
+	}
+	return l.ahead[offset]
+}
+
+// peekChar reveals next char withouh advancing the cursor along
+func (l *Lexer) peekChar() rune {
+	return l.peekAt(0)
 }
 
 func (l *Lexer) readText() string {
-	position := l.position
-	for isText(l.ch) && l.readPosition <= l.length {
+	text := strings.Builder{}
+	for isText(l.ch) && l.ch != 0 {
+		text.WriteRune(l.ch)
 		l.readChar()
 	}
-	return l.source.Input[position:l.position]
+	return text.String()
 }
 
 func (l *Lexer) setTextSeparatorToken() token.Token {
@@ -133,11 +252,25 @@ func (l *Lexer) setTextSeparatorToken() token.Token {
 }
 
 // readDocAnnotation reads the rest of the line identified by
-func (l *Lexer) readDocAnnotation(tok token.Token) token.Token {
+//
+// When a closer is provided, e.g. `*/` or `-->`, the annotation
+// also ends when the closer is found and the closer is consumed.
+func (l *Lexer) readDocAnnotation(tok token.Token, closer string) token.Token {
 	metaTag := ""
+	startColumn := l.column + 1
+	lines := []token.MetaLine{}
 Loop:
 	for {
 		peekChar := l.peekChar()
+		// reached the end of the input
+		if peekChar == 0 {
+			break Loop
+		}
+		// block style comments close the annotation on the same line
+		if closer != "" && l.peekIs(0, closer) {
+			l.advance(len(closer))
+			break Loop
+		}
 		// if NEXT CHAR is line break AND the current byte is NOT `0x5c` (`\`)
 		// we exit the forever loop as we have reached the end of a meta annotation string
 		if peekChar == '\n' && l.ch != 0x5c { //0x5c
@@ -146,48 +279,102 @@ Loop:
 		// if current byte is `\` and is followed by line break
 		// we continue to build the meta-anotation just broken over
 		// many lines but skip adding them to the metatag
-		// strip the '\n' and '\\' chars from the metaTag
-		if peekChar != '\n' && peekChar != 0x5c {
+		// strip the '\n' and the '\\' preceding it from the metaTag,
+		// any other '\\' is kept for the escapes in quoted values, e.g. `title='Order \'cancelled\''`
+		if peekChar != '\n' && (peekChar != 0x5c || l.peekAt(1) != '\n') {
 			// the parser will strip any non key/value identifiers
 			metaTag += string(peekChar)
 		}
 		l.readChar()
+		if l.ch == '\n' {
+			// line continuation still counts as a line
+			l.newLine()
+			lines = append(lines, token.MetaLine{Offset: utf8.RuneCountInString(metaTag), Line: l.line, Column: l.column + 1})
+		}
 	}
 	tok.MetaAnnotation = strings.TrimSpace(metaTag)
+	// positions are relative to the annotation without its leading whitespace
+	leading := utf8.RuneCountInString(metaTag) - utf8.RuneCountInString(strings.TrimLeft(metaTag, " \t"))
+	tok.MetaColumn = startColumn + leading
+	for _, line := range lines {
+		if line.Offset -= leading; line.Offset > 0 {
+			tok.MetaLines = append(tok.MetaLines, line)
+		}
+	}
 	return tok
 }
 
-// peekIsDocGenBegin attempts to identify the gendoc keyword after 2 slashes
-func (l *Lexer) peekIsDocGenBegin() bool {
-	count := 0
-	docGen := ""
-	for count < len(BEGIN_DOC) {
-		count++
-		docGen += string(l.peekChar())
-		l.readChar()
+// readMarker reads a begin or end marker in any of the comment syntaxes
+// starting at the current char
+func (l *Lexer) readMarker() (token.Token, bool) {
+	for _, syntax := range l.syntaxes {
+		leader := []rune(syntax.leader())
+		if l.ch != leader[0] || !l.peekIs(0, string(leader[1:])) {
+			continue
+		}
+		skip := len(leader) - 1
+		begin, end := syntax.TokenTypes()
+		if l.peekIsDocGenBegin(skip) {
+			l.advance(skip + len([]rune(l.begin)))
+			return l.readDocAnnotation(token.Token{Type: begin, Literal: string(leader) + l.begin}, syntax.Close), true
+		}
+		if l.peekIsDocGenEnd(skip) {
+			l.advance(skip + len([]rune(l.end)))
+			tok := token.Token{Type: end, Literal: string(leader) + l.end}
+			if syntax.Close != "" {
+				tok = l.readDocMarkerClose(tok, syntax.Close)
+			}
+			return tok, true
+		}
 	}
+	return token.Token{}, false
+}
 
-	if docGen == BEGIN_DOC {
-		return true
+// readDocMarkerClose swallows the optional block comment closer
+// following an end marker on the same line, e.g. `/*-gendoc */`
+func (l *Lexer) readDocMarkerClose(tok token.Token, closer string) token.Token {
+	skip := 0
+	for l.peekIs(skip, " ") {
+		skip++
 	}
-	l.resetAfterPeek(len(BEGIN_DOC))
-	return false
+	if l.peekIs(skip, closer) {
+		l.advance(skip + len(closer))
+	}
+	return tok
 }
 
-// peekIsDocGenEnd
-func (l *Lexer) peekIsDocGenEnd() bool {
-	count := 0
-	docGen := ""
-	for count < len(END_DOC) {
-		count++
-		docGen += string(l.peekChar())
-		l.readChar()
+// peekIsDocGenBegin reports whether the gendoc begin keyword
+// follows the current char after skipping the specified number of chars
+func (l *Lexer) peekIsDocGenBegin(skip int) bool {
+	return l.peekIs(skip, l.begin)
+}
+
+// peekIsDocGenEnd reports whether the gendoc end keyword
+// follows the current char after skipping the specified number of chars
+func (l *Lexer) peekIsDocGenEnd(skip int) bool {
+	keyword := make([]rune, len([]rune(l.end)))
+	for i := range keyword {
+		keyword[i] = l.peekAt(skip + i)
 	}
-	if strings.EqualFold(docGen, END_DOC) {
-		return true
+	return strings.EqualFold(string(keyword), l.end)
+}
+
+// peekIs reveals whether the upcoming input starts with the literal
+// after skipping the specified number of chars, without advancing the cursor
+func (l *Lexer) peekIs(skip int, literal string) bool {
+	for i, ch := range []rune(literal) {
+		if l.peekAt(skip+i) != ch {
+			return false
+		}
+	}
+	return true
+}
+
+// advance moves the cursor along by n chars
+func (l *Lexer) advance(n int) {
+	for i := 0; i < n; i++ {
+		l.readChar()
 	}
-	l.resetAfterPeek(len(END_DOC))
-	return false
 }
 
 func (l *Lexer) htmlCommentTextToken(commentLiteral string, commentType token.TokenType) token.Token {
@@ -198,7 +385,7 @@ func (l *Lexer) htmlCommentTextToken(commentLiteral string, commentType token.To
 			if idx == length { // is last char and already peeked and matched
 				break
 			}
-			if l.peekChar() == commentLiteral[idx] {
+			if l.peekChar() == rune(commentLiteral[idx]) {
 				l.readChar()
 			} else {
 				return token.Token{Type: token.TEXT, Literal: commentLiteral[0:idx]}
@@ -212,18 +399,12 @@ func (l *Lexer) htmlCommentTextToken(commentLiteral string, commentType token.To
 	return token.Token{Type: commentType, Literal: commentLiteral}
 }
 
-// resetAfterPeek will go back specified amount on the cursor
-func (l *Lexer) resetAfterPeek(back int) {
-	l.position = l.position - back
-	l.readPosition = l.readPosition - back
-}
-
 // isText only deals with any text characters defined as
 // outside of the capture group
-func isText(ch byte) bool {
-	return !nonText[string(ch)]
+func isText(ch rune) bool {
+	return !nonText[ch]
 }
 
-func newToken(tokenType token.TokenType, ch byte) token.Token {
+func newToken(tokenType token.TokenType, ch rune) token.Token {
 	return token.Token{Type: tokenType, Literal: string(ch)}
 }
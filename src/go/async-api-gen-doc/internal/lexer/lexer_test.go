@@ -1,6 +1,7 @@
 package lexer_test
 
 import (
+	"strings"
 	"testing"
 
 	"github.com/dnitsch/async-api-generator/internal/lexer"
@@ -79,7 +80,7 @@ class {
 		{token.NEW_LINE, "\n"},
 		{token.EOF, ""},
 	}
-	l := lexer.New(lexer.Source{Input: input, FullPath: "/foo/bar", FileName: "bar"})
+	l := lexer.New(lexer.Source{Input: strings.NewReader(input), FullPath: "/foo/bar", FileName: "bar"})
 
 	for i, tt := range ttests {
 
@@ -131,7 +132,7 @@ func Test_simple_with_gendoc_with_comment(t *testing.T) {
 		{token.NEW_LINE, "\n"},
 		{token.EOF, ""},
 	}
-	l := lexer.New(lexer.Source{Input: input, FullPath: "/foo/bar", FileName: "bar"})
+	l := lexer.New(lexer.Source{Input: strings.NewReader(input), FullPath: "/foo/bar", FileName: "bar"})
 
 	for i, tt := range ttests {
 
@@ -188,7 +189,7 @@ func Test_simple_with_incpomplete_html_comment(t *testing.T) {
 		{token.NEW_LINE, "\n"},
 		{token.EOF, ""},
 	}
-	l := lexer.New(lexer.Source{Input: input, FullPath: "/foo/bar", FileName: "bar"})
+	l := lexer.New(lexer.Source{Input: strings.NewReader(input), FullPath: "/foo/bar", FileName: "bar"})
 
 	for i, tt := range ttests {
 
@@ -213,7 +214,7 @@ func Test_simple_with_incpomplete_html_comment(t *testing.T) {
 
 func Test_empty_file(t *testing.T) {
 	input := ``
-	l := lexer.New(lexer.Source{Input: input, FullPath: "/foo/bar", FileName: "bar"})
+	l := lexer.New(lexer.Source{Input: strings.NewReader(input), FullPath: "/foo/bar", FileName: "bar"})
 	tok := l.NextToken()
 	if tok.Type != token.EOF {
 		t.Fatal("expected EOF")
@@ -245,3 +246,286 @@ func Test_empty_file(t *testing.T) {
 // 	// 	t.Fatal("expected EOF")
 // 	// }
 // }
+
+func Test_gendoc_markers_in_all_comment_styles(t *testing.T) {
+	type tokenWant struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}
+	ttests := map[string]struct {
+		input    string
+		expect   []tokenWant
+		metaWant string
+	}{
+		"hash style as used by python, shell, yaml and terraform": {
+			"#+gendoc category=info type=description\nfoo\n#-gendoc\n",
+			[]tokenWant{
+				{token.BEGIN_DOC_GEN_HASH, "#+gendoc"},
+				{token.NEW_LINE, "\n"},
+				{token.TEXT, "foo"},
+				{token.NEW_LINE, "\n"},
+				{token.END_DOC_GEN_HASH, "#-gendoc"},
+				{token.NEW_LINE, "\n"},
+				{token.EOF, ""},
+			},
+			"category=info type=description",
+		},
+		"double dash style as used by SQL and lua": {
+			"--+gendoc category=info type=description\nfoo\n---gendoc\n",
+			[]tokenWant{
+				{token.BEGIN_DOC_GEN_DOUBLE_DASH, "--+gendoc"},
+				{token.NEW_LINE, "\n"},
+				{token.TEXT, "foo"},
+				{token.NEW_LINE, "\n"},
+				{token.END_DOC_GEN_DOUBLE_DASH, "---gendoc"},
+				{token.NEW_LINE, "\n"},
+				{token.EOF, ""},
+			},
+			"category=info type=description",
+		},
+		"block comment style": {
+			"/*+gendoc category=info type=description */\nfoo\n/*-gendoc */\n",
+			[]tokenWant{
+				{token.BEGIN_DOC_GEN_BLOCK, "/*+gendoc"},
+				{token.NEW_LINE, "\n"},
+				{token.TEXT, "foo"},
+				{token.NEW_LINE, "\n"},
+				{token.END_DOC_GEN_BLOCK, "/*-gendoc"},
+				{token.NEW_LINE, "\n"},
+				{token.EOF, ""},
+			},
+			"category=info type=description",
+		},
+		"block comment style without closer on the end marker": {
+			"/*+gendoc category=info type=description*/\nfoo\n/*-gendoc\n*/",
+			[]tokenWant{
+				{token.BEGIN_DOC_GEN_BLOCK, "/*+gendoc"},
+				{token.NEW_LINE, "\n"},
+				{token.TEXT, "foo"},
+				{token.NEW_LINE, "\n"},
+				{token.END_DOC_GEN_BLOCK, "/*-gendoc"},
+				{token.NEW_LINE, "\n"},
+				{token.TEXT, "*/"},
+				{token.EOF, ""},
+			},
+			"category=info type=description",
+		},
+		"html comment style": {
+			"<!--+gendoc category=info type=description -->\n# foo\n<!---gendoc -->\n",
+			[]tokenWant{
+				{token.BEGIN_DOC_GEN_HTML, "<!--+gendoc"},
+				{token.NEW_LINE, "\n"},
+				{token.HASH, "#"},
+				{token.SPACE, " "},
+				{token.TEXT, "foo"},
+				{token.NEW_LINE, "\n"},
+				{token.END_DOC_GEN_HTML, "<!---gendoc"},
+				{token.NEW_LINE, "\n"},
+				{token.EOF, ""},
+			},
+			"category=info type=description",
+		},
+		"non marker comments are left untouched": {
+			"-- select\n/* foo */\n#bar\n",
+			[]tokenWant{
+				{token.TEXT, "--"},
+				{token.SPACE, " "},
+				{token.TEXT, "select"},
+				{token.NEW_LINE, "\n"},
+				{token.FORWARD_SLASH, "/"},
+				{token.TEXT, "*"},
+				{token.SPACE, " "},
+				{token.TEXT, "foo"},
+				{token.SPACE, " "},
+				{token.TEXT, "*/"},
+				{token.NEW_LINE, "\n"},
+				{token.HASH, "#"},
+				{token.TEXT, "bar"},
+				{token.NEW_LINE, "\n"},
+				{token.EOF, ""},
+			},
+			"",
+		},
+	}
+	for name, tt := range ttests {
+		t.Run(name, func(t *testing.T) {
+			l := lexer.New(lexer.Source{Input: strings.NewReader(tt.input), FullPath: "/foo/bar", FileName: "bar"})
+			for i, want := range tt.expect {
+				tok := l.NextToken()
+				if tok.Type != want.expectedType {
+					t.Fatalf("tests[%d] - tokentype wrong. got=%q, expected=%q", i, tok.Type, want.expectedType)
+				}
+				if tok.Literal != want.expectedLiteral {
+					t.Fatalf("tests[%d] - literal wrong. got=%q, expected=%q", i, tok.Literal, want.expectedLiteral)
+				}
+				if token.IsBeginDocGen(tok.Type) && tok.MetaAnnotation != tt.metaWant {
+					t.Errorf("gendoc meta annotation:\ngot: %s\nwanted %s", tok.MetaAnnotation, tt.metaWant)
+				}
+			}
+		})
+	}
+}
+
+func Test_token_positions_are_rune_based(t *testing.T) {
+	input := "héllo 🌃 wörld\n//+gendoc id=foo \\\ncategory=message\n//-gendoc\n"
+	ttests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+		line, column    int
+	}{
+		{token.TEXT, "héllo", 1, 1},
+		{token.SPACE, " ", 1, 6},
+		{token.TEXT, "🌃", 1, 7},
+		{token.SPACE, " ", 1, 8},
+		{token.TEXT, "wörld", 1, 9},
+		{token.NEW_LINE, "\n", 1, 14},
+		{token.BEGIN_DOC_GEN, "//+gendoc", 2, 1},
+		{token.NEW_LINE, "\n", 3, 17},
+		{token.END_DOC_GEN, "//-gendoc", 4, 1},
+		{token.NEW_LINE, "\n", 4, 10},
+		{token.EOF, "", 5, 1},
+	}
+	l := lexer.New(lexer.Source{Input: strings.NewReader(input), FullPath: "/foo/bar", FileName: "bar"})
+	for i, tt := range ttests {
+		tok := l.NextToken()
+		if tok.Type != tt.expectedType || tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - token wrong. got=%q %q, expected=%q %q", i, tok.Type, tok.Literal, tt.expectedType, tt.expectedLiteral)
+		}
+		if tok.Line != tt.line || tok.Column != tt.column {
+			t.Errorf("tests[%d] %q - position wrong. got=%d:%d, expected=%d:%d", i, tok.Literal, tok.Line, tok.Column, tt.line, tt.column)
+		}
+	}
+}
+
+func Test_input_is_decoded_and_normalised(t *testing.T) {
+	utf16 := func(bigEndian bool, s string) string {
+		b := []byte{0xFF, 0xFE}
+		if bigEndian {
+			b = []byte{0xFE, 0xFF}
+		}
+		for _, r := range s {
+			if bigEndian {
+				b = append(b, byte(r>>8), byte(r))
+			} else {
+				b = append(b, byte(r), byte(r>>8))
+			}
+		}
+		return string(b)
+	}
+	want := []token.Token{
+		{Type: token.BEGIN_DOC_GEN, Literal: "//+gendoc", MetaAnnotation: "id=foo"},
+		{Type: token.NEW_LINE, Literal: "\n"},
+		{Type: token.TEXT, Literal: "ünïcode"},
+		{Type: token.NEW_LINE, Literal: "\n"},
+		{Type: token.END_DOC_GEN, Literal: "//-gendoc"},
+		{Type: token.EOF, Literal: ""},
+	}
+	ttests := map[string]string{
+		"UTF-8 with BOM":       "\xEF\xBB\xBF//+gendoc id=foo\nünïcode\n//-gendoc",
+		"CRLF line endings":    "//+gendoc id=foo\r\nünïcode\r\n//-gendoc",
+		"UTF-16 little endian": utf16(false, "//+gendoc id=foo\r\nünïcode\r\n//-gendoc"),
+		"UTF-16 big endian":    utf16(true, "//+gendoc id=foo\nünïcode\n//-gendoc"),
+	}
+	for name, input := range ttests {
+		t.Run(name, func(t *testing.T) {
+			l := lexer.New(lexer.Source{Input: strings.NewReader(input), FullPath: "/foo/bar", FileName: "bar"})
+			for i, tt := range want {
+				tok := l.NextToken()
+				if tok.Type != tt.Type || tok.Literal != tt.Literal || tok.MetaAnnotation != tt.MetaAnnotation {
+					t.Fatalf("tests[%d] - token wrong. got=%q %q %q, expected=%q %q %q", i, tok.Type, tok.Literal, tok.MetaAnnotation, tt.Type, tt.Literal, tt.MetaAnnotation)
+				}
+			}
+		})
+	}
+}
+
+func Test_ContainsMarker(t *testing.T) {
+	ttests := map[string]struct {
+		input string
+		want  bool
+	}{
+		"marker present":           {"foo\n//+gendoc id=bar\n//-gendoc", true},
+		"marker absent":            {"package-lock contents without any markers", false},
+		"empty input":              {"", false},
+		"binary content":           {"\x00\x01\x02\xff\xfe", false},
+		"marker spans chunks":      {strings.Repeat("a", 32*1024-3) + "#+gendoc id=bar", true},
+		"marker after large input": {strings.Repeat("a\n", 100*1024) + "<!--+gendoc id=bar -->", true},
+		"UTF-16 input":             {"\xFF\xFE/\x00/\x00+\x00g\x00e\x00n\x00d\x00o\x00c\x00", true},
+	}
+	for name, tt := range ttests {
+		t.Run(name, func(t *testing.T) {
+			got, err := lexer.DefaultConfig().ContainsMarker(strings.NewReader(tt.input))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("got: %v, wanted: %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_markers_with_configured_keyword_and_syntax(t *testing.T) {
+	conf := lexer.DefaultConfig()
+	conf.Keyword = "asyncapi"
+	conf.Syntaxes = append(conf.Syntaxes, lexer.CommentSyntax{Name: "semicolon", Line: ";"}, lexer.CommentSyntax{Name: "pascal", Open: "(*", Close: "*)"})
+	conf.Files = []lexer.FileSyntax{{Glob: "*.dsl", Syntaxes: []string{"semicolon", "pascal"}}}
+
+	ttests := map[string]struct {
+		path  string
+		input string
+		want  []token.Token
+	}{
+		"custom line syntax": {
+			"/foo/order.dsl",
+			";+asyncapi id=foo\n;-ASYNCAPI",
+			[]token.Token{
+				{Type: "BEGIN_DOC_GEN_SEMICOLON", Literal: ";+asyncapi", MetaAnnotation: "id=foo"},
+				{Type: token.NEW_LINE, Literal: "\n"},
+				{Type: "END_DOC_GEN_SEMICOLON", Literal: ";-asyncapi"},
+				{Type: token.EOF},
+			},
+		},
+		"custom block syntax": {
+			"/foo/order.dsl",
+			"(*+asyncapi id=foo *)\n(*-asyncapi *)",
+			[]token.Token{
+				{Type: "BEGIN_DOC_GEN_PASCAL", Literal: "(*+asyncapi", MetaAnnotation: "id=foo"},
+				{Type: token.NEW_LINE, Literal: "\n"},
+				{Type: "END_DOC_GEN_PASCAL", Literal: "(*-asyncapi"},
+				{Type: token.EOF},
+			},
+		},
+		"syntax not enabled for the file": {
+			"/foo/order.dsl",
+			"//+asyncapi",
+			[]token.Token{
+				{Type: token.DOUBLE_FORWARD_SLASH, Literal: "//"},
+				{Type: token.TEXT, Literal: "+asyncapi"},
+				{Type: token.EOF},
+			},
+		},
+		"default keyword no longer recognised": {
+			"/foo/order.cs",
+			"//+gendoc id=foo",
+			[]token.Token{
+				{Type: token.DOUBLE_FORWARD_SLASH, Literal: "//"},
+				{Type: token.TEXT, Literal: "+gendoc"},
+				{Type: token.SPACE, Literal: " "},
+				{Type: token.TEXT, Literal: "id=foo"},
+				{Type: token.EOF},
+			},
+		},
+	}
+	for name, tt := range ttests {
+		t.Run(name, func(t *testing.T) {
+			l := lexer.New(lexer.Source{Input: strings.NewReader(tt.input), FullPath: tt.path, FileName: "bar"}).WithConfig(conf)
+			for i, want := range tt.want {
+				tok := l.NextToken()
+				if tok.Type != want.Type || tok.Literal != want.Literal || tok.MetaAnnotation != want.MetaAnnotation {
+					t.Fatalf("tests[%d] - token wrong. got=%q %q %q, expected=%q %q %q", i, tok.Type, tok.Literal, tok.MetaAnnotation, want.Type, want.Literal, want.MetaAnnotation)
+				}
+			}
+		})
+	}
+}
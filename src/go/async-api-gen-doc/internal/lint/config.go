@@ -0,0 +1,117 @@
+package lint
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+
+	"github.com/dnitsch/async-api-generator/internal/diag"
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	ErrUnknownRule     = errors.New("rule is not defined")
+	ErrInvalidSeverity = errors.New("severity must be one of error, warning or info")
+	ErrInvalidPattern  = errors.New("pattern is not a valid regular expression")
+	ErrInvalidMin      = errors.New("min must not be negative")
+)
+
+// RuleConfig configures a single rule, unset fields keep the rule defaults
+//
+// Pattern and Min are only used by the rules which document them.
+type RuleConfig struct {
+	Enabled  *bool         `yaml:"enabled,omitempty"`
+	Severity diag.Severity `yaml:"severity,omitempty"`
+	Pattern  string        `yaml:"pattern,omitempty"`
+	Min      int           `yaml:"min,omitempty"`
+}
+
+// Config holds the rule configs by rule name
+type Config struct {
+	Rules map[string]RuleConfig `yaml:"rules"`
+}
+
+// DefaultConfig returns the built-in rules with their default config
+func DefaultConfig() *Config {
+	conf := &Config{Rules: map[string]RuleConfig{}}
+	for _, rule := range Rules() {
+		conf.Rules[rule.Name] = rule.defaults
+	}
+	return conf
+}
+
+// LoadConfig reads a YAML lint config from the path
+//
+// The file is layered on top of DefaultConfig,
+// only the fields set for a rule override its defaults.
+//
+//	rules:
+//	  channel-id-pattern:
+//	    severity: error
+//	    pattern: '^[a-z]+-[a-z]+~.+$'
+//	  description-min-length:
+//	    min: 40
+//	  service-title:
+//	    enabled: false
+func LoadConfig(path string) (*Config, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	loaded := &Config{}
+	if err := yaml.Unmarshal(b, loaded); err != nil {
+		return nil, fmt.Errorf("lint config %s: %w", path, err)
+	}
+	conf := DefaultConfig()
+	for name, rc := range loaded.Rules {
+		existing, ok := conf.Rules[name]
+		if !ok {
+			return nil, fmt.Errorf("lint config %s rule '%s': %w", path, name, ErrUnknownRule)
+		}
+		conf.Rules[name] = existing.merge(rc)
+	}
+	if err := conf.Validate(); err != nil {
+		return nil, fmt.Errorf("lint config %s: %w", path, err)
+	}
+	return conf, nil
+}
+
+func (r RuleConfig) merge(override RuleConfig) RuleConfig {
+	if override.Enabled != nil {
+		r.Enabled = override.Enabled
+	}
+	if override.Severity != "" {
+		r.Severity = override.Severity
+	}
+	if override.Pattern != "" {
+		r.Pattern = override.Pattern
+	}
+	if override.Min != 0 {
+		r.Min = override.Min
+	}
+	return r
+}
+
+// Validate ensures every rule config can be used
+func (c *Config) Validate() error {
+	for name, rc := range c.Rules {
+		switch rc.Severity {
+		case "", diag.SeverityError, diag.SeverityWarning, diag.SeverityInfo:
+		default:
+			return fmt.Errorf("rule '%s' severity '%s': %w", name, rc.Severity, ErrInvalidSeverity)
+		}
+		if _, err := regexp.Compile(rc.Pattern); err != nil {
+			return fmt.Errorf("rule '%s' pattern '%s': %w", name, rc.Pattern, ErrInvalidPattern)
+		}
+		if rc.Min < 0 {
+			return fmt.Errorf("rule '%s': %w", name, ErrInvalidMin)
+		}
+	}
+	return nil
+}
+
+// IsEnabled reports whether the rule runs, rules are enabled unless disabled in the config
+func (r RuleConfig) IsEnabled() bool {
+	return r.Enabled == nil || *r.Enabled
+}
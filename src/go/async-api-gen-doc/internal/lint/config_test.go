@@ -0,0 +1,59 @@
+package lint_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/dnitsch/async-api-generator/internal/diag"
+	"github.com/dnitsch/async-api-generator/internal/lint"
+)
+
+func Test_LoadConfig(t *testing.T) {
+	ttests := map[string]struct {
+		conf    string
+		wantErr error
+		check   func(t *testing.T, got *lint.Config)
+	}{
+		"layers on top of defaults": {
+			conf: `rules:
+  channel-id-pattern:
+    severity: error
+    pattern: '^[a-z]+-[a-z]+~.+$'
+  service-title:
+    enabled: false
+`,
+			check: func(t *testing.T, got *lint.Config) {
+				if rc := got.Rules["channel-id-pattern"]; rc.Severity != diag.SeverityError || rc.Pattern == "" {
+					t.Errorf("channel-id-pattern not overridden: %+v", rc)
+				}
+				if got.Rules["service-title"].IsEnabled() {
+					t.Error("service-title should be disabled")
+				}
+				if rc := got.Rules["description-min-length"]; !rc.IsEnabled() || rc.Min != 20 || rc.Severity != diag.SeverityWarning {
+					t.Errorf("description-min-length defaults not kept: %+v", rc)
+				}
+			},
+		},
+		"unknown rule":     {conf: "rules:\n  foo: {}\n", wantErr: lint.ErrUnknownRule},
+		"invalid severity": {conf: "rules:\n  service-title:\n    severity: fatal\n", wantErr: lint.ErrInvalidSeverity},
+		"invalid pattern":  {conf: "rules:\n  channel-id-pattern:\n    pattern: '[a-'\n", wantErr: lint.ErrInvalidPattern},
+		"negative min":     {conf: "rules:\n  description-min-length:\n    min: -1\n", wantErr: lint.ErrInvalidMin},
+	}
+	for name, tt := range ttests {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "lint.yml")
+			if err := os.WriteFile(path, []byte(tt.conf), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			got, err := lint.LoadConfig(path)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("got error %v, wanted %v", err, tt.wantErr)
+			}
+			if tt.check != nil {
+				tt.check(t, got)
+			}
+		})
+	}
+}
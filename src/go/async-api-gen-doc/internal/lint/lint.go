@@ -0,0 +1,206 @@
+// Package lint checks the documentation against policy rules
+// on top of the syntax checked by the parser.
+//
+// The rules run over each service of the context tree
+// together with the AsyncAPI constructed from it,
+// their findings are reported as diagnostics.
+package lint
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/dnitsch/async-api-generator/internal/diag"
+	"github.com/dnitsch/async-api-generator/internal/gendoc"
+	"github.com/dnitsch/async-api-generator/internal/generate"
+	"github.com/dnitsch/async-api-generator/internal/parser"
+)
+
+var (
+	ErrLint                = errors.New("lint failed")
+	ErrServiceTitle        = errors.New("service has no title")
+	ErrChannelIdPattern    = errors.New("channel id does not match the pattern")
+	ErrDescriptionTooShort = errors.New("description is too short")
+	ErrPubOperationSchema  = errors.New("pubOperation has no message with a json_schema")
+)
+
+// Rule is a single policy check
+type Rule struct {
+	Name        string
+	Code        string
+	Description string
+	defaults    RuleConfig
+	check       func(svc generate.Service, conf RuleConfig) []finding
+}
+
+// finding is a rule violation at the block
+type finding struct {
+	block *parser.GenDocBlock
+	err   error
+}
+
+const defaultDescriptionMin = 20
+
+// Rules returns the built-in rule set
+func Rules() []Rule {
+	return []Rule{
+		{
+			Name:        "service-title",
+			Code:        "GD101",
+			Description: "every service sets a title, either as a title block or the title attribute",
+			defaults:    RuleConfig{Severity: diag.SeverityWarning},
+			check:       checkServiceTitle,
+		},
+		{
+			Name:        "channel-id-pattern",
+			Code:        "GD102",
+			Description: "channel ids match the `pattern` regular expression, only runs when a pattern is set",
+			defaults:    RuleConfig{Severity: diag.SeverityWarning},
+			check:       checkChannelIdPattern,
+		},
+		{
+			Name:        "description-min-length",
+			Code:        "GD103",
+			Description: fmt.Sprintf("descriptions are at least `min` characters long, defaults to %d", defaultDescriptionMin),
+			defaults:    RuleConfig{Severity: diag.SeverityWarning, Min: defaultDescriptionMin},
+			check:       checkDescriptionLength,
+		},
+		{
+			Name:        "pub-operation-message-schema",
+			Code:        "GD104",
+			Description: "every pubOperation has a message with a json_schema payload",
+			defaults:    RuleConfig{Severity: diag.SeverityWarning},
+			check:       checkPubOperationSchema,
+		},
+	}
+}
+
+// Run checks the services against the enabled rules
+//
+// A node linked under several services is only reported once per rule.
+func Run(services []generate.Service, conf *Config) diag.Diagnostics {
+	if conf == nil {
+		conf = DefaultConfig()
+	}
+	diags := diag.Diagnostics{}
+	reported := map[string]bool{}
+	for _, rule := range Rules() {
+		rc := rule.defaults.merge(conf.Rules[rule.Name])
+		if !rc.IsEnabled() {
+			continue
+		}
+		for _, svc := range services {
+			for _, f := range rule.check(svc, rc) {
+				d := &diag.Diagnostic{
+					File:     f.block.Token.Source.File,
+					Path:     f.block.Token.Source.Path,
+					Line:     f.block.Token.Line,
+					Column:   f.block.Token.Column,
+					Severity: rc.Severity,
+					Code:     rule.Code,
+					Err:      fmt.Errorf("%w (%s)", f.err, rule.Name),
+				}
+				if key := d.Error(); !reported[key] {
+					reported[key] = true
+					diags = append(diags, d)
+				}
+			}
+		}
+	}
+	return diags
+}
+
+// walk calls fn for every non leaf node below the node, each node only once
+func walk(node *parser.GenDocNode, fn func(node *parser.GenDocNode)) {
+	visited := map[parser.GenDocNodeKey]bool{}
+	var next func(node *parser.GenDocNode)
+	next = func(node *parser.GenDocNode) {
+		_, nonleafs := node.SortLeafNodes()
+		for _, child := range nonleafs {
+			if visited[child.Index] {
+				continue
+			}
+			visited[child.Index] = true
+			fn(child)
+			next(child)
+		}
+	}
+	next(node)
+}
+
+func checkServiceTitle(svc generate.Service, _ RuleConfig) []finding {
+	leafs, _ := svc.Node.SortLeafNodes()
+	for _, leaf := range leafs {
+		if leaf.Value.Annotation.ContentType == gendoc.Title || leaf.Value.Annotation.Title != "" {
+			return nil
+		}
+	}
+	return []finding{{svc.Node.Value, fmt.Errorf("service '%s': %w", svc.Node.Index.Val, ErrServiceTitle)}}
+}
+
+func checkChannelIdPattern(svc generate.Service, rc RuleConfig) []finding {
+	if rc.Pattern == "" {
+		return nil
+	}
+	// the pattern is checked when the config is loaded
+	pattern := regexp.MustCompile(rc.Pattern)
+	findings := []finding{}
+	walk(svc.Node, func(node *parser.GenDocNode) {
+		if node.Index.Typ == parser.ChannelNode && !pattern.MatchString(node.Index.Val) {
+			findings = append(findings, finding{node.Value, fmt.Errorf("channel '%s' pattern '%s': %w", node.Index.Val, rc.Pattern, ErrChannelIdPattern)})
+		}
+	})
+	return findings
+}
+
+func checkDescriptionLength(svc generate.Service, rc RuleConfig) []finding {
+	findings := []finding{}
+	check := func(node *parser.GenDocNode) {
+		leafs, _ := node.SortLeafNodes()
+		for _, leaf := range leafs {
+			block := leaf.Value
+			descriptions := []string{block.Annotation.Description}
+			if block.Annotation.ContentType == gendoc.Description {
+				descriptions = append(descriptions, block.Value)
+			}
+			for _, description := range descriptions {
+				description = strings.TrimSpace(description)
+				if description == "" {
+					continue
+				}
+				if length := utf8.RuneCountInString(description); length < rc.Min {
+					findings = append(findings, finding{block, fmt.Errorf("%s '%s' has %d characters, wanted at least %d: %w", block.Annotation.CategoryType, block.Annotation.Id, length, rc.Min, ErrDescriptionTooShort)})
+				}
+			}
+		}
+	}
+	check(svc.Node)
+	walk(svc.Node, check)
+	return findings
+}
+
+func checkPubOperationSchema(svc generate.Service, _ RuleConfig) []finding {
+	findings := []finding{}
+	walk(svc.Node, func(node *parser.GenDocNode) {
+		if node.Index.Typ != parser.ChannelNode {
+			return
+		}
+		_, operations := node.SortLeafNodes()
+		for _, op := range operations {
+			if op.Value.Annotation.CategoryType != gendoc.PubOperationBlock {
+				continue
+			}
+			hasSchema := slices.ContainsFunc(svc.AsyncAPI.OperationMessages(svc.AsyncAPI.Channels[node.Index.Val].Operation(op.Index.Val)), func(msg *generate.Message) bool {
+				return msg.Payload != nil && msg.Payload != ""
+			})
+			if !hasSchema {
+				findings = append(findings, finding{op.Value, fmt.Errorf("pubOperation '%s' on channel '%s': %w", op.Index.Val, node.Index.Val, ErrPubOperationSchema)})
+			}
+		}
+	})
+	return findings
+}
@@ -0,0 +1,116 @@
+package lint_test
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/dnitsch/async-api-generator/internal/diag"
+	"github.com/dnitsch/async-api-generator/internal/fshelper"
+	"github.com/dnitsch/async-api-generator/internal/generate"
+	"github.com/dnitsch/async-api-generator/internal/lint"
+	"github.com/dnitsch/async-api-generator/internal/parser"
+	log "github.com/dnitsch/simplelog"
+)
+
+func services(t *testing.T, files map[string]string) []generate.Service {
+	t.Helper()
+	dir := t.TempDir()
+	inputs := []*fshelper.FileList{}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		inputs = append(inputs, &fshelper.FileList{Name: name, Path: path})
+	}
+	g := generate.New(&generate.Config{Mode: parser.Validate, ParserConfig: parser.Config{ServiceId: "svc"}}, log.New(&bytes.Buffer{}, log.ErrorLvl))
+	g.LoadInputsFromFiles(inputs)
+	if err := g.GenDocBlox(); err != nil {
+		t.Fatal(err)
+	}
+	if err := g.BuildContextTree(); err != nil {
+		t.Fatal(err)
+	}
+	svcs, err := g.Services()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return svcs
+}
+
+const serviceTitle = "<!--+gendoc category=info type=title -->\nService\n<!---gendoc -->\n"
+
+const pubOperation = `#+gendoc category=channel type=description id=orders-topic~created
+# the topic where created orders are published
+#-gendoc
+#+gendoc category=pubOperation type=description id=created channelId=orders-topic~created
+# publishes the created order event
+#-gendoc
+`
+
+func Test_Run(t *testing.T) {
+	enabled := false
+	ttests := map[string]struct {
+		files map[string]string
+		conf  *lint.Config
+		want  []error
+	}{
+		"missing service title": {
+			files: map[string]string{"svc.md": "<!--+gendoc category=info type=description -->\nthe service handling all the orders\n<!---gendoc -->\n"},
+			want:  []error{lint.ErrServiceTitle},
+		},
+		"disabled rule is skipped": {
+			files: map[string]string{"svc.md": "<!--+gendoc category=info type=description -->\nthe service handling all the orders\n<!---gendoc -->\n"},
+			conf:  &lint.Config{Rules: map[string]lint.RuleConfig{"service-title": {Enabled: &enabled}}},
+			want:  nil,
+		},
+		"short description": {
+			files: map[string]string{"svc.md": serviceTitle + "<!--+gendoc category=info type=description -->\ntoo short\n<!---gendoc -->\n"},
+			want:  []error{lint.ErrDescriptionTooShort},
+		},
+		"short inline description": {
+			files: map[string]string{"svc.md": "<!--+gendoc category=info type=title description=short -->\nService\n<!---gendoc -->\n"},
+			want:  []error{lint.ErrDescriptionTooShort},
+		},
+		"channel id pattern": {
+			files: map[string]string{"svc.md": serviceTitle, "ch.tf": pubOperation},
+			conf:  &lint.Config{Rules: map[string]lint.RuleConfig{"channel-id-pattern": {Pattern: `^[a-z]+-[a-z]+\.`}, "pub-operation-message-schema": {Enabled: &enabled}}},
+			want:  []error{lint.ErrChannelIdPattern},
+		},
+		"pub operation without schema": {
+			files: map[string]string{"svc.md": serviceTitle, "ch.tf": pubOperation},
+			want:  []error{lint.ErrPubOperationSchema},
+		},
+		"pub operation with schema": {
+			files: map[string]string{"svc.md": serviceTitle, "ch.tf": pubOperation + `#+gendoc category=message type=json_schema id=created
+{"type": "object"}
+#-gendoc
+`},
+			want: nil,
+		},
+	}
+	for name, tt := range ttests {
+		t.Run(name, func(t *testing.T) {
+			got := lint.Run(services(t, tt.files), tt.conf)
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %d diagnostics, wanted %d\n%s", len(got), len(tt.want), got)
+			}
+			for i, want := range tt.want {
+				if !errors.Is(got[i], want) {
+					t.Errorf("got %v, wanted %v", got[i], want)
+				}
+			}
+		})
+	}
+}
+
+func Test_Run_uses_configured_severity(t *testing.T) {
+	svcs := services(t, map[string]string{"svc.md": "<!--+gendoc category=info type=description -->\nthe service handling all the orders\n<!---gendoc -->\n"})
+	got := lint.Run(svcs, &lint.Config{Rules: map[string]lint.RuleConfig{"service-title": {Severity: diag.SeverityError}}})
+	if !got.HasErrors() || got[0].Code != "GD101" {
+		t.Errorf("got %v, wanted a GD101 error", got)
+	}
+}
@@ -0,0 +1,179 @@
+package parser
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+var (
+	ErrVariableUnset     = errors.New("variable is not set")
+	ErrVariableEmpty     = errors.New("variable is set but empty")
+	ErrBadSubstitution   = errors.New("variable reference is missing the closing brace")
+	ErrMalformedEnvEntry = errors.New("env file entry must be in the form KEY=value")
+)
+
+// ExpandEnvVariables replaces `$VAR` and `${VAR}` in the input with the values from vars.
+//
+// vars are in the same form as os.Environ, i.e. `KEY=value`, a later entry overrides an earlier one.
+// The process environment is never read or modified.
+//
+//   - `${VAR:-default}` uses the default when VAR is unset or empty
+//   - `$$` is replaced by a single `$`
+//   - a `$` not followed by a name, e.g. `$1` or `$ `, is left as is
+//
+// Unset or empty variables without a default are all reported in the returned error.
+func ExpandEnvVariables(input string, vars []string) (string, error) {
+	return expandEnvVariables(input, vars, false)
+}
+
+// ExpandEnvVariablesKeepingUnset is ExpandEnvVariables leaving a reference to an unset variable as is,
+// e.g. `$schema` or `$ref` in a JSON payload
+//
+// Empty variables without a default are still reported in the returned error.
+func ExpandEnvVariablesKeepingUnset(input string, vars []string) (string, error) {
+	return expandEnvVariables(input, vars, true)
+}
+
+func expandEnvVariables(input string, vars []string, keepUnset bool) (string, error) {
+	if !strings.Contains(input, "$") {
+		return input, nil
+	}
+	lookup := environMap(vars)
+	out := strings.Builder{}
+	errs := []error{}
+	for i := 0; i < len(input); i++ {
+		if input[i] != '$' || i+1 >= len(input) {
+			out.WriteByte(input[i])
+			continue
+		}
+		switch next := input[i+1]; {
+		case next == '$':
+			out.WriteByte('$')
+			i++
+		case next == '{':
+			end := strings.IndexByte(input[i+2:], '}')
+			if end < 0 {
+				errs = append(errs, fmt.Errorf("'%s': %w", input[i:], ErrBadSubstitution))
+				out.WriteString(input[i:])
+				i = len(input)
+				continue
+			}
+			ref := input[i+2 : i+2+end]
+			name, fallback, hasDefault := strings.Cut(ref, ":-")
+			if !isVarName(name) {
+				// not a variable reference leave as is
+				out.WriteString(input[i : i+3+end])
+			} else if val, err := lookupVar(lookup, name); err == nil {
+				out.WriteString(val)
+			} else if hasDefault {
+				out.WriteString(fallback)
+			} else if keepUnset && errors.Is(err, ErrVariableUnset) {
+				out.WriteString(input[i : i+3+end])
+			} else {
+				errs = append(errs, err)
+			}
+			i += 2 + end
+		case isVarStart(next):
+			end := i + 1
+			for end < len(input) && isVarChar(input[end]) {
+				end++
+			}
+			val, err := lookupVar(lookup, input[i+1:end])
+			switch {
+			case err == nil:
+				out.WriteString(val)
+			case keepUnset && errors.Is(err, ErrVariableUnset):
+				out.WriteString(input[i:end])
+			default:
+				errs = append(errs, err)
+			}
+			i = end - 1
+		default:
+			out.WriteByte('$')
+		}
+	}
+	return out.String(), errors.Join(errs...)
+}
+
+func environMap(vars []string) map[string]string {
+	lookup := make(map[string]string, len(vars))
+	for _, v := range vars {
+		// values can contain `=` only the first one separates the key
+		key, value, _ := strings.Cut(v, "=")
+		lookup[key] = value
+	}
+	return lookup
+}
+
+func lookupVar(lookup map[string]string, name string) (string, error) {
+	val, ok := lookup[name]
+	if !ok {
+		return "", fmt.Errorf("'%s': %w", name, ErrVariableUnset)
+	}
+	if val == "" {
+		return "", fmt.Errorf("'%s': %w", name, ErrVariableEmpty)
+	}
+	return val, nil
+}
+
+func isVarStart(ch byte) bool {
+	return ch == '_' || ('a' <= ch && ch <= 'z') || ('A' <= ch && ch <= 'Z')
+}
+
+func isVarChar(ch byte) bool {
+	return isVarStart(ch) || ('0' <= ch && ch <= '9')
+}
+
+func isVarName(name string) bool {
+	if name == "" || !isVarStart(name[0]) {
+		return false
+	}
+	for i := 1; i < len(name); i++ {
+		if !isVarChar(name[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// LoadEnvFile reads `KEY=value` entries from a dotenv style file
+//
+// Empty lines and lines starting with `#` are skipped, an `export ` prefix is allowed
+// and values wrapped in matching single or double quotes are unquoted.
+// The entries are returned in the same form as os.Environ.
+func LoadEnvFile(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	environ := []string{}
+	scanner := bufio.NewScanner(f)
+	line := 0
+	for scanner.Scan() {
+		line++
+		entry := strings.TrimSpace(scanner.Text())
+		if entry == "" || strings.HasPrefix(entry, "#") {
+			continue
+		}
+		entry = strings.TrimPrefix(entry, "export ")
+		key, value, ok := strings.Cut(entry, "=")
+		key = strings.TrimSpace(key)
+		if !ok || !isVarName(key) {
+			return nil, fmt.Errorf("%s:%d: %w", path, line, ErrMalformedEnvEntry)
+		}
+		value = strings.TrimSpace(value)
+		if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+			value = value[1 : len(value)-1]
+		}
+		environ = append(environ, key+"="+value)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return environ, nil
+}
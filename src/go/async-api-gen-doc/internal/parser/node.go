@@ -2,8 +2,9 @@ package parser
 
 import (
 	"fmt"
+	"hash/fnv"
+	"slices"
 	"strconv"
-	"time"
 
 	"github.com/dnitsch/async-api-generator/internal/gendoc"
 	"github.com/dnitsch/async-api-generator/internal/token"
@@ -15,6 +16,15 @@ type GenDocBlock struct {
 	NodeCategory NodeCategory  `json:"docCategory"`
 	Value        string        `json:"value"`
 	EndToken     token.Token   `json:"endToken"`
+	// Syntax is the name of the comment syntax of the begin marker, e.g. hash,
+	// the block is only closed by the end marker of the same syntax
+	Syntax string `json:"syntax,omitempty"`
+	// RefSource is the resolved file referenced via the `ref=` attribute
+	// the Value is the content of that file
+	RefSource *token.Source `json:"refSource,omitempty"`
+	// Origin is the id of the service repo the block is documented in,
+	// empty when the repo is not analysed as a service
+	Origin string `json:"origin,omitempty"`
 }
 
 // NodeCategory is an internal concept for assigning depth to the node
@@ -31,6 +41,21 @@ const (
 	MessageNode
 )
 
+// String returns the name of the category, e.g. channel
+func (c NodeCategory) String() string {
+	switch c {
+	case ServiceNode:
+		return "service"
+	case ChannelNode:
+		return "channel"
+	case OperationNode:
+		return "operation"
+	case MessageNode:
+		return "message"
+	}
+	return strconv.Itoa(int(c))
+}
+
 var nodeCatConverter = map[string]NodeCategory{
 	"server":       ServiceNode,
 	"root":         ServiceNode,
@@ -45,12 +70,22 @@ var nodeCatConverter = map[string]NodeCategory{
 type GenDocTree struct {
 	Root  *GenDocNode
 	Index map[string]*GenDocNode
+	// ids holds the nodes of each category and id across all namespaces
+	ids map[string][]*GenDocNode
 }
 
 const idxDivider string = "_#_"
 
 func indexFromKey(key *GenDocNodeKey) string {
-	return fmt.Sprintf("%v%s%s", key.Typ, idxDivider, key.Val)
+	if key.Namespace == "" {
+		return idFromKey(key)
+	}
+	return fmt.Sprintf("%d%s%s%s%s", key.Typ, idxDivider, key.Namespace, idxDivider, key.Val)
+}
+
+// idFromKey is the index of the key without its namespace
+func idFromKey(key *GenDocNodeKey) string {
+	return fmt.Sprintf("%d%s%s", key.Typ, idxDivider, key.Val)
 }
 
 func NewGenDocTree() *GenDocTree {
@@ -58,6 +93,7 @@ func NewGenDocTree() *GenDocTree {
 	ntrie := &GenDocTree{
 		Root:  root,
 		Index: map[string]*GenDocNode{indexFromKey(root.key): root},
+		ids:   map[string][]*GenDocNode{idFromKey(root.key): {root}},
 	}
 	// add top level branches
 	orphaned := NewGenDocNode(&GenDocBlock{}).WithKey(NewGenDocNodeKey(0, "orphaned"))
@@ -76,25 +112,41 @@ func (t *GenDocTree) OrhpanedBranch() *GenDocNode {
 }
 
 // GenDocNode base node for the n-ary doc tree
+//
+// A node can be linked under several parents, e.g. a channel shared by two services.
+// Children must only be modified via the tree so that the child index and parents stay in sync.
 type GenDocNode struct {
 	key      *GenDocNodeKey `json:"-"`
 	Index    GenDocNodeKey  `json:"index"`
 	Value    *GenDocBlock   `json:"value"`
 	Children []*GenDocNode  `json:"children"`
 	IsLeaf   bool           `json:"isLeaf"`
-	// potentially add siblings
+	// parents are the nodes this node is linked under
+	parents []*GenDocNode
+	// childIdx holds the position of each child in Children
+	childIdx map[GenDocNodeKey]int
 }
 
 // GenDocNodeKey helper key for when a tree
 //
 //	can be loaded into a Radix and use the string as a key to walk it
+//
+// The Namespace scopes the id to its owning service, so that two services
+// documenting a channel or an operation with the same id do not share a node.
+// Services and shared channels, and the nodes below them, have no namespace.
 type GenDocNodeKey struct {
-	Typ NodeCategory `json:"typ"`
-	Val string       `json:"val"`
+	Typ       NodeCategory `json:"typ"`
+	Namespace string       `json:"namespace,omitempty"`
+	Val       string       `json:"val"`
 }
 
 func NewGenDocNodeKey(typ NodeCategory, val string) *GenDocNodeKey {
-	return &GenDocNodeKey{typ, val}
+	return &GenDocNodeKey{Typ: typ, Val: val}
+}
+
+// NewScopedGenDocNodeKey returns the key of the id within the namespace
+func NewScopedGenDocNodeKey(typ NodeCategory, namespace, val string) *GenDocNodeKey {
+	return &GenDocNodeKey{Typ: typ, Namespace: namespace, Val: val}
 }
 
 func NewGenDocNode(value *GenDocBlock) *GenDocNode {
@@ -114,11 +166,62 @@ func (g *GenDocNode) WithKey(key *GenDocNodeKey) *GenDocNode {
 
 // IsKeyEqual compares the current node's key to the comparator Key
 func (g *GenDocNode) IsKeyEqual(key *GenDocNodeKey) bool {
-	return g.key.Typ == key.Typ && g.key.Val == key.Val
+	return *g.key == *key
 }
 
+// addChild links the child under the node, a child with the same key is replaced in place
 func (n *GenDocNode) addChild(child *GenDocNode) {
-	n.Children = append(n.Children, child)
+	if i, ok := n.childIdx[*child.key]; ok {
+		if n.Children[i] == child {
+			return
+		}
+		n.Children[i].removeParent(n)
+		n.Children[i] = child
+	} else {
+		// leaves make up most of the tree and never have children
+		if n.childIdx == nil {
+			n.childIdx = map[GenDocNodeKey]int{}
+		}
+		n.childIdx[*child.key] = len(n.Children)
+		n.Children = append(n.Children, child)
+	}
+	child.parents = append(child.parents, n)
+}
+
+// removeChild unlinks the child with the key
+//
+// The remaining children keep their order, only those after the removed one are reindexed.
+func (n *GenDocNode) removeChild(key GenDocNodeKey) {
+	i, ok := n.childIdx[key]
+	if !ok {
+		return
+	}
+	n.Children[i].removeParent(n)
+	n.Children = slices.Delete(n.Children, i, i+1)
+	delete(n.childIdx, key)
+	for j := i; j < len(n.Children); j++ {
+		n.childIdx[*n.Children[j].key] = j
+	}
+}
+
+func (n *GenDocNode) removeParent(parent *GenDocNode) {
+	for i, p := range n.parents {
+		if p == parent {
+			n.parents = append(n.parents[:i], n.parents[i+1:]...)
+			return
+		}
+	}
+}
+
+// Parents returns the nodes this node is linked under, in the order it was linked
+func (n *GenDocNode) Parents() []*GenDocNode {
+	return n.parents
+}
+
+// HasChild reports whether a direct child with the key exists
+func (n *GenDocNode) HasChild(key *GenDocNodeKey) bool {
+	_, ok := n.childIdx[*key]
+	return ok
 }
 
 // SortLeafNodes returns all children of the parent either leaf or non-leaf nodes
@@ -141,19 +244,37 @@ func (n *GenDocNode) IsRoot() bool {
 
 const LEAF_SUFFIX string = "__leaf__"
 
-// preMergeId is a helper for _to be merged_ leaves for any given entity
-func PreMergeKeyValSuffix(key *GenDocNodeKey) *GenDocNodeKey {
+// PreMergeKeyValSuffix is a helper for _to be merged_ leaves for any given entity
+//
+// The suffix is a hash of the block source position and content,
+// so that the same input always yields the same leaf keys.
+func PreMergeKeyValSuffix(key *GenDocNodeKey, block *GenDocBlock) *GenDocNodeKey {
 	// need to make a copy of the key
 	k := *key
-	// suffixing with randomness to not overwrite an existing index in the hashtable
-	k.Val = k.Val + LEAF_SUFFIX + strconv.FormatInt(time.Now().UTC().UnixNano(), 10)
+	// suffixing with the block identity to not overwrite an existing index in the hashtable
+	k.Val = k.Val + LEAF_SUFFIX + block.Hash()
 	return &k
 }
 
+// Hash identifies the block by its source path, position and content
+func (b *GenDocBlock) Hash() string {
+	h := fnv.New64a()
+	fmt.Fprintf(h, "%s\x00%d\x00%d\x00%d\x00%s\x00%s\x00%s\x00", b.Token.Source.Path, b.Token.Line, b.Token.Column, b.EndToken.Line, b.Annotation.CategoryType, b.Annotation.ContentType, b.Annotation.Id)
+	h.Write([]byte(b.Value))
+	return fmt.Sprintf("%016x", h.Sum64())
+}
+
 // AddNode inserts a node with the given value into the N-ary tree
 func (t *GenDocTree) AddNode(node, parent *GenDocNode) {
-
-	t.Index[indexFromKey(node.key)] = node
+	idx := indexFromKey(node.key)
+	if existing := t.Index[idx]; existing != node {
+		if existing != nil {
+			t.removeId(existing)
+		}
+		t.Index[idx] = node
+		id := idFromKey(node.key)
+		t.ids[id] = append(t.ids[id], node)
+	}
 
 	if parent.IsRoot() {
 		t.Root.addChild(node)
@@ -163,6 +284,8 @@ func (t *GenDocTree) AddNode(node, parent *GenDocNode) {
 }
 
 // DeleteNode deletes a node with the given value from the N-ary tree
+//
+// The node is unlinked from all of its parents, its children stay linked to it.
 func (t *GenDocTree) DeleteNode(key *GenDocNodeKey) {
 	delkey := indexFromKey(key)
 	node := t.Index[delkey]
@@ -171,19 +294,23 @@ func (t *GenDocTree) DeleteNode(key *GenDocNodeKey) {
 	}
 
 	delete(t.Index, delkey)
+	t.removeId(node)
 	// is root - deleting the entire tree
 	if node.IsRoot() {
 		t.Root = nil
 		return
 	}
-	parent := t.FindParentNode(node)
+	for _, parent := range slices.Clone(node.parents) {
+		parent.removeChild(*key)
+	}
+}
 
-	for i, child := range parent.Children {
-		if child.IsKeyEqual(key) {
-			parent.Children = append(parent.Children[:i], parent.Children[i+1:]...)
-			break
-		}
+// MoveNode unlinks the node from all of its parents and links it under the parent
+func (t *GenDocTree) MoveNode(node, parent *GenDocNode) {
+	for _, p := range slices.Clone(node.parents) {
+		p.removeChild(*node.key)
 	}
+	t.AddNode(node, parent)
 }
 
 // FindNode looks for a node in the tree by index
@@ -191,6 +318,19 @@ func (t *GenDocTree) FindNode(key *GenDocNodeKey) *GenDocNode {
 	return t.getNode(key)
 }
 
+// FindNodesById returns the nodes with the id in every namespace, in the order they were added
+func (t *GenDocTree) FindNodesById(typ NodeCategory, id string) []*GenDocNode {
+	return slices.Clone(t.ids[idFromKey(NewGenDocNodeKey(typ, id))])
+}
+
+func (t *GenDocTree) removeId(node *GenDocNode) {
+	id := idFromKey(node.key)
+	t.ids[id] = slices.DeleteFunc(t.ids[id], func(n *GenDocNode) bool { return n == node })
+	if len(t.ids[id]) == 0 {
+		delete(t.ids, id)
+	}
+}
+
 // getNode retrieves the node from a hashmap by key
 func (t *GenDocTree) getNode(key *GenDocNodeKey) *GenDocNode {
 	if node, ok := t.Index[indexFromKey(key)]; ok {
@@ -199,34 +339,12 @@ func (t *GenDocTree) getNode(key *GenDocNodeKey) *GenDocNode {
 	return nil
 }
 
-// FindParentNode does a BFS search
-//
-// need to do a level search in parented tree for existance of a node which satisfies the KeyLookup
+// FindParentNode returns the first parent the node was linked under
 //
-// BFS should do here i.e. go through all the siblings on each level and look for a match
-// the singleContext tree should be quite flat
+// The root has no parent.
 func (t *GenDocTree) FindParentNode(chld *GenDocNode) *GenDocNode {
-	// is root node
-	if chld.IsRoot() {
+	if chld.IsRoot() || len(chld.parents) == 0 {
 		return nil
 	}
-	var found *GenDocNode = nil
-	queue := []*GenDocNode{t.Root}
-TreeLoop:
-	for len(queue) > 0 {
-		node := queue[0]
-		queue = queue[1:]
-		// look for a level with the required category
-		// search all siblings on that level for the parentId
-		// Enqueue children of each node
-		for _, child := range node.Children {
-			queue = append(queue, child)
-			if child.IsKeyEqual(chld.key) {
-				// found level with required category
-				found = node
-				break TreeLoop
-			}
-		}
-	}
-	return found
+	return chld.parents[0]
 }
@@ -1,10 +1,11 @@
 package parser_test
 
 import (
-	"strings"
+	"fmt"
 	"testing"
 
 	"github.com/dnitsch/async-api-generator/internal/parser"
+	"github.com/dnitsch/async-api-generator/internal/token"
 )
 
 var testTree = func() *parser.GenDocTree {
@@ -86,38 +87,54 @@ func helperNodeLookUpValidator(t *testing.T, funcName string, got *parser.GenDoc
 }
 
 func Test_PreMergeKeyValSuffix_helper(t *testing.T) {
+	block := &parser.GenDocBlock{Token: token.Token{Source: token.Source{Path: "/src/foo.cs"}, Line: 2, Column: 1}, Value: "foo"}
 	ttests := map[string]struct {
 		input  *parser.GenDocNodeKey
 		expect *parser.GenDocNodeKey
 	}{
 		"simple string": {
-			&parser.GenDocNodeKey{parser.ServiceNode, "bla"},
-			&parser.GenDocNodeKey{parser.ServiceNode, "bla" + parser.LEAF_SUFFIX},
+			parser.NewGenDocNodeKey(parser.ServiceNode, "bla"),
+			parser.NewGenDocNodeKey(parser.ServiceNode, "bla"+parser.LEAF_SUFFIX),
 		},
 		"special char . in the beginnin": {
-			&parser.GenDocNodeKey{parser.ServiceNode, ".bar"},
-			&parser.GenDocNodeKey{parser.ServiceNode, ".bar" + parser.LEAF_SUFFIX},
+			parser.NewGenDocNodeKey(parser.ServiceNode, ".bar"),
+			parser.NewGenDocNodeKey(parser.ServiceNode, ".bar"+parser.LEAF_SUFFIX),
 		},
 		"special char #": {
-			&parser.GenDocNodeKey{parser.ServiceNode, "#bar"},
-			&parser.GenDocNodeKey{parser.ServiceNode, "#bar" + parser.LEAF_SUFFIX},
+			parser.NewGenDocNodeKey(parser.ServiceNode, "#bar"),
+			parser.NewGenDocNodeKey(parser.ServiceNode, "#bar"+parser.LEAF_SUFFIX),
 		},
 	}
 	for name, tt := range ttests {
 		t.Run(name, func(t *testing.T) {
-			got := parser.PreMergeKeyValSuffix(tt.input)
+			got := parser.PreMergeKeyValSuffix(tt.input, block)
 			if got.Typ != tt.expect.Typ {
 				t.Errorf("Typ should match after merge, got: %v, wanted: %v", got.Typ, tt.expect.Typ)
 			}
-			ignoreRandSuffix := strings.Split(got.Val, "__")
-			gs := strings.Join(ignoreRandSuffix[:2], "__")
-			if gs+"__" != tt.expect.Val {
-				t.Errorf("Val should match after merge, got: %v, wanted: %v", got.Val, tt.expect.Val)
+			if got.Val != tt.expect.Val+block.Hash() {
+				t.Errorf("Val should match after merge, got: %v, wanted: %v", got.Val, tt.expect.Val+block.Hash())
 			}
 		})
 	}
 }
 
+func Test_GenDocBlock_Hash(t *testing.T) {
+	base := parser.GenDocBlock{Token: token.Token{Source: token.Source{Path: "/src/foo.cs"}, Line: 2, Column: 1}, Value: "foo"}
+	moved, changed := base, base
+	moved.Token.Line = 3
+	changed.Value = "bar"
+
+	if base.Hash() != (&parser.GenDocBlock{Token: base.Token, Value: "foo"}).Hash() {
+		t.Error("same block should hash the same")
+	}
+	if base.Hash() == moved.Hash() {
+		t.Error("blocks at a different line should hash differently")
+	}
+	if base.Hash() == changed.Hash() {
+		t.Error("blocks with different content should hash differently")
+	}
+}
+
 func Test_FindParentNode(t *testing.T) {
 
 	tree := testTree()
@@ -169,6 +186,104 @@ func Test_DeleteNode(t *testing.T) {
 	})
 }
 
+func Test_DeleteNode_unlinks_from_every_parent(t *testing.T) {
+	tree := testTree()
+	l1_a := tree.FindNode(parser.NewGenDocNodeKey(parser.ServiceNode, "l1_a"))
+	l1_b := tree.FindNode(parser.NewGenDocNodeKey(parser.ServiceNode, "l1_b"))
+	shared := tree.FindNode(parser.NewGenDocNodeKey(parser.ChannelNode, "l2_a"))
+	tree.AddNode(shared, l1_b)
+	if got := shared.Parents(); len(got) != 2 || got[0] != l1_a || got[1] != l1_b {
+		t.Fatalf("got parents %v, wanted [l1_a l1_b]", got)
+	}
+
+	tree.DeleteNode(&shared.Index)
+	if l1_a.HasChild(&shared.Index) || l1_b.HasChild(&shared.Index) {
+		t.Error("deleted node still linked under a parent")
+	}
+	if len(shared.Parents()) != 0 {
+		t.Errorf("got parents %v, wanted none", shared.Parents())
+	}
+	// the remaining child is still found at its new position
+	l2_b := parser.NewGenDocNodeKey(parser.ChannelNode, "l2_b")
+	if len(l1_a.Children) != 1 || !l1_a.Children[0].IsKeyEqual(l2_b) || !l1_a.HasChild(l2_b) {
+		t.Errorf("got children %v, wanted [l2_b]", l1_a.Children)
+	}
+}
+
+func Test_removing_a_middle_child_keeps_sibling_order(t *testing.T) {
+	ttests := map[string]func(tree *parser.GenDocTree, l1_b *parser.GenDocNode){
+		"DeleteNode": func(tree *parser.GenDocTree, l1_b *parser.GenDocNode) {
+			tree.DeleteNode(&l1_b.Index)
+		},
+		"MoveNode": func(tree *parser.GenDocTree, l1_b *parser.GenDocNode) {
+			tree.MoveNode(l1_b, tree.OrhpanedBranch())
+		},
+	}
+	for name, remove := range ttests {
+		t.Run(name, func(t *testing.T) {
+			tree := testTree()
+			l1_b := tree.FindNode(parser.NewGenDocNodeKey(parser.ServiceNode, "l1_b"))
+			l1_d := parser.NewGenDocNode(&parser.GenDocBlock{}).WithKey(parser.NewGenDocNodeKey(parser.ServiceNode, "l1_d"))
+			tree.AddNode(l1_d, tree.ParentedBranch())
+
+			remove(tree, l1_b)
+			got := []string{}
+			for _, child := range tree.ParentedBranch().Children {
+				got = append(got, child.Index.Val)
+			}
+			if fmt.Sprint(got) != "[l1_a l1_c l1_d]" {
+				t.Errorf("got children %v, wanted [l1_a l1_c l1_d]", got)
+			}
+			// the siblings after the removed child are still found at their position
+			l1_c := parser.NewGenDocNode(&parser.GenDocBlock{}).WithKey(parser.NewGenDocNodeKey(parser.ServiceNode, "l1_c"))
+			tree.AddNode(l1_c, tree.ParentedBranch())
+			if children := tree.ParentedBranch().Children; len(children) != 3 || children[1] != l1_c {
+				t.Errorf("got children %v, wanted l1_c replaced in place", children)
+			}
+		})
+	}
+}
+
+func Test_MoveNode(t *testing.T) {
+	tree := testTree()
+	l1_c := tree.FindNode(parser.NewGenDocNodeKey(parser.ServiceNode, "l1_c"))
+	l2_c := tree.FindNode(parser.NewGenDocNodeKey(parser.ChannelNode, "l2_c"))
+
+	tree.MoveNode(l2_c, l1_c)
+	if got := tree.FindParentNode(l2_c); got != l1_c {
+		t.Errorf("got parent %v, wanted l1_c", got)
+	}
+	if tree.FindNode(&l2_c.Index) != l2_c {
+		t.Error("moved node not found in the index")
+	}
+	if l1_b := tree.FindNode(parser.NewGenDocNodeKey(parser.ServiceNode, "l1_b")); len(l1_b.Children) != 0 {
+		t.Errorf("got children %v under the old parent, wanted none", l1_b.Children)
+	}
+}
+
+func Test_FindNodesById_across_namespaces(t *testing.T) {
+	tree := testTree()
+	l1_b := tree.FindNode(parser.NewGenDocNodeKey(parser.ServiceNode, "l1_b"))
+	l1_c := tree.FindNode(parser.NewGenDocNodeKey(parser.ServiceNode, "l1_c"))
+	orders := parser.NewGenDocNode(&parser.GenDocBlock{}).WithKey(parser.NewScopedGenDocNodeKey(parser.ChannelNode, "urn:l1_b", "orders"))
+	billing := parser.NewGenDocNode(&parser.GenDocBlock{}).WithKey(parser.NewScopedGenDocNodeKey(parser.ChannelNode, "urn:l1_c", "orders"))
+	tree.AddNode(orders, l1_b)
+	tree.AddNode(billing, l1_c)
+	// linking the same node again does not index it twice
+	tree.AddNode(billing, l1_b)
+
+	if got := tree.FindNodesById(parser.ChannelNode, "orders"); len(got) != 2 || got[0] != orders || got[1] != billing {
+		t.Fatalf("got %v, wanted both namespaced nodes", got)
+	}
+	if tree.FindNode(parser.NewGenDocNodeKey(parser.ChannelNode, "orders")) != nil {
+		t.Error("namespaced node found without its namespace")
+	}
+	tree.DeleteNode(&orders.Index)
+	if got := tree.FindNodesById(parser.ChannelNode, "orders"); len(got) != 1 || got[0] != billing {
+		t.Errorf("got %v after delete, wanted the billing node", got)
+	}
+}
+
 func Test_SortNodes(t *testing.T) {
 
 	tree := testTree()
@@ -202,3 +317,68 @@ func Test_SortNodes(t *testing.T) {
 		})
 	}
 }
+
+// benchTreeSize is the number of channel nodes in the synthetic trees
+const benchTreeSize = 100_000
+
+// benchTree builds a tree with every channel under one of 100 services
+// and a leaf below every channel
+func benchTree(b *testing.B) (*parser.GenDocTree, []*parser.GenDocNode) {
+	b.Helper()
+	tree := parser.NewGenDocTree()
+	services := make([]*parser.GenDocNode, 100)
+	for i := range services {
+		services[i] = parser.NewGenDocNode(&parser.GenDocBlock{}).WithKey(parser.NewGenDocNodeKey(parser.ServiceNode, fmt.Sprintf("svc-%d", i)))
+		tree.AddNode(services[i], tree.ParentedBranch())
+	}
+	channels := make([]*parser.GenDocNode, benchTreeSize)
+	for i := range channels {
+		channels[i] = parser.NewGenDocNode(&parser.GenDocBlock{}).WithKey(parser.NewGenDocNodeKey(parser.ChannelNode, fmt.Sprintf("ch-%d", i)))
+		tree.AddNode(channels[i], services[i%len(services)])
+		leaf := parser.NewGenDocNode(&parser.GenDocBlock{}).WithKey(parser.NewGenDocNodeKey(parser.ChannelNode, fmt.Sprintf("ch-%d%s", i, parser.LEAF_SUFFIX)))
+		leaf.IsLeaf = true
+		tree.AddNode(leaf, channels[i])
+	}
+	return tree, channels
+}
+
+func Benchmark_AddNode(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		benchTree(b)
+	}
+}
+
+func Benchmark_DeleteNode(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		tree, channels := benchTree(b)
+		b.StartTimer()
+		for _, ch := range channels {
+			tree.DeleteNode(&ch.Index)
+		}
+	}
+}
+
+func Benchmark_MoveNode(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		tree, channels := benchTree(b)
+		orphaned := tree.OrhpanedBranch()
+		b.StartTimer()
+		for _, ch := range channels {
+			tree.MoveNode(ch, orphaned)
+		}
+	}
+}
+
+func Benchmark_FindParentNode(b *testing.B) {
+	tree, channels := benchTree(b)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, ch := range channels {
+			if tree.FindParentNode(ch) == nil {
+				b.Fatal("parent not found")
+			}
+		}
+	}
+}
@@ -4,27 +4,85 @@ import (
 	"errors"
 	"fmt"
 	"os"
+	"path/filepath"
 	"regexp"
 	"strings"
 
-	"github.com/a8m/envsubst"
+	"github.com/dnitsch/async-api-generator/internal/diag"
 	"github.com/dnitsch/async-api-generator/internal/gendoc"
 	"github.com/dnitsch/async-api-generator/internal/lexer"
 	"github.com/dnitsch/async-api-generator/internal/token"
 	log "github.com/dnitsch/simplelog"
 )
 
-func wrapErr(file string, line, position int, etyp error) error {
-	return fmt.Errorf("\n - [%s:%d:%d] %w", file, line, position, etyp)
+func wrapErr(src token.Source, line, position int, etyp error) error {
+	return &diag.Diagnostic{File: src.File, Path: src.Path, Line: line, Column: position, Severity: diag.SeverityError, Code: errorCode(etyp), Err: etyp}
+}
+
+// errorCodes identify each class of error in the diagnostics
+var errorCodes = []struct {
+	err  error
+	code string
+}{
+	{ErrNoEndTagFound, "GD001"},
+	{ErrMismatchedEndTag, "GD007"},
+	{gendoc.ErrUnparseableTag, "GD002"},
+	{gendoc.ErrZeroLengthKeyOrValue, "GD002"},
+	{gendoc.ErrUnterminatedQuote, "GD002"},
+	{gendoc.ErrUnterminatedList, "GD002"},
+	{gendoc.ErrUnknownEscape, "GD002"},
+	{gendoc.ErrIncorrectCategory, "GD003"},
+	{gendoc.ErrIncorrectType, "GD004"},
+	{gendoc.ErrIncorrectExpand, "GD005"},
+	{gendoc.ErrIncorrectShared, "GD005"},
+	{gendoc.ErrUnknownKey, "GD006"},
+	{ErrIdRequired, "GD010"},
+	{ErrParentIdRequired, "GD011"},
+	{ErrContentTypeRequired, "GD012"},
+	{ErrUnableToReplaceVarPlaceholder, "GD020"},
+	{ErrRefUnreadable, "GD021"},
+}
+
+// errorCode returns the code of the first matching error class
+//
+// Errors outside of the known classes, e.g. IO errors, have no code.
+func errorCode(err error) string {
+	for _, c := range errorCodes {
+		if errors.Is(err, c.err) {
+			return c.code
+		}
+	}
+	return ""
+}
+
+// annotationErrPosition points the error at the offending attribute
+// when the annotation error carries its position
+//
+// An attribute on a continued line of the annotation is positioned relative to the start of that line.
+func annotationErrPosition(tok token.Token, err error) (line, column int) {
+	annErr := &gendoc.AnnotationError{}
+	if !errors.As(err, &annErr) || tok.MetaColumn == 0 {
+		return tok.Line, tok.Column
+	}
+	line, column, offset := tok.Line, tok.MetaColumn, 0
+	for _, l := range tok.MetaLines {
+		if l.Offset > annErr.Pos {
+			break
+		}
+		line, column, offset = l.Line, l.Column, l.Offset
+	}
+	return line, column + annErr.Pos - offset
 }
 
 var (
-	ErrNoEndTagFound                 = errors.New("no corresponding //-gendoc end tag found")
+	ErrNoEndTagFound                 = errors.New("no corresponding -gendoc end tag found")
+	ErrMismatchedEndTag              = errors.New("-gendoc end tag is of another comment syntax than the +gendoc begin tag")
 	ErrUnableToReplaceVarPlaceholder = errors.New("variable specified in the content was not found in the environment")
 	ErrUnableToConvertCategory       = errors.New("unable to convert category to node category")
 	ErrIdRequired                    = errors.New("id must be specified")
 	ErrContentTypeRequired           = errors.New("content type must be specified")
 	ErrParentIdRequired              = errors.New("parent must be specified")
+	ErrRefUnreadable                 = errors.New("referenced file cannot be read")
 )
 
 type Parser struct {
@@ -35,6 +93,11 @@ type Parser struct {
 	peekToken token.Token
 	config    *Config
 	environ   []string
+	// lineStart is the first non whitespace token on the current line
+	lineStart   token.Token
+	atLineStart bool
+	// endDocGen is the end marker type closing the current block, see parseGenDocBlocks
+	endDocGen token.TokenType
 }
 
 func New(l *lexer.Lexer, c *Config) *Parser {
@@ -44,6 +107,8 @@ func New(l *lexer.Lexer, c *Config) *Parser {
 		errors:  []error{},
 		config:  c,
 		environ: os.Environ(),
+		// the first token is always at the start of a line
+		atLineStart: true,
 	}
 
 	// Read two tokens, so curToken and peekToken are both set
@@ -83,6 +148,7 @@ type Config struct {
 	ServiceLanguage string
 	BusinessDomain  string // Business level domain i.e. warehouse
 	BoundedDomain   string // BoundDomain within a business domain
+	Strict          bool   // unknown annotation keys are errors instead of being skipped
 	// Note: other properties can go here
 	// perhaps better to use the options pattern
 	// ...apply(opt)
@@ -97,6 +163,23 @@ func (p *Parser) WithLogger(logger log.Loggeriface) *Parser {
 func (p *Parser) nextToken() {
 	p.curToken = p.peekToken
 	p.peekToken = p.l.NextToken()
+	p.trackLineStart()
+}
+
+// trackLineStart keeps a record of the first non whitespace token on the current line
+func (p *Parser) trackLineStart() {
+	switch p.curToken.Type {
+	case token.NEW_LINE:
+		p.atLineStart = true
+		p.lineStart = token.Token{}
+	case token.SPACE, token.TAB, token.CARRIAGE_RETURN, token.CONTROL, "":
+		// indentation does not start a line
+	default:
+		if p.atLineStart {
+			p.lineStart = p.curToken
+			p.atLineStart = false
+		}
+	}
 }
 
 func (p *Parser) currentTokenIs(t token.TokenType) bool {
@@ -107,6 +190,36 @@ func (p *Parser) peekTokenIs(t token.TokenType) bool {
 	return p.peekToken.Type == t
 }
 
+// currentTokenIsEndDocGen checks the current token against the end marker closing the current block
+func (p *Parser) currentTokenIsEndDocGen() bool {
+	return p.isEndDocGen(p.curToken.Type)
+}
+
+// peekTokenIsEndDocGen checks the next token against the end marker closing the current block
+func (p *Parser) peekTokenIsEndDocGen() bool {
+	return p.isEndDocGen(p.peekToken.Type)
+}
+
+// isEndDocGen reports whether the type is the end marker of the comment syntax the current block began in,
+// any end marker when the syntax is not known
+func (p *Parser) isEndDocGen(typ token.TokenType) bool {
+	if p.endDocGen == "" {
+		return token.IsEndDocGen(typ)
+	}
+	return typ == p.endDocGen
+}
+
+// mismatchedEndDocGen returns the end marker of another comment syntax
+// than the one the current block began in, when it is either the current or the next token
+func (p *Parser) mismatchedEndDocGen() (token.Token, bool) {
+	for _, tok := range []token.Token{p.curToken, p.peekToken} {
+		if token.IsEndDocGen(tok.Type) && !p.isEndDocGen(tok.Type) {
+			return tok, true
+		}
+	}
+	return token.Token{}, false
+}
+
 // InitialParse creates a flat list of GenDocBlock
 // and parsed annotations as "expressions"
 //
@@ -120,7 +233,7 @@ func (p *Parser) InitialParse() ([]GenDocBlock, []error) {
 	genDocStms := []GenDocBlock{}
 
 	for !p.currentTokenIs(token.EOF) {
-		if p.currentTokenIs(token.BEGIN_DOC_GEN) {
+		if token.IsBeginDocGen(p.curToken.Type) {
 			// parseGenDocBlocks will advance the token until
 			// it hits the END_DOC_GEN token
 			if stmt := p.parseGenDocBlocks(); stmt != nil {
@@ -130,20 +243,38 @@ func (p *Parser) InitialParse() ([]GenDocBlock, []error) {
 		p.nextToken()
 	}
 
+	// a failed read ends the input early
+	if err := p.l.Err(); err != nil {
+		p.errors = append(p.errors, wrapErr(p.curToken.Source, p.curToken.Line, p.curToken.Column, err))
+	}
+
 	return genDocStms, p.errors
 }
 
 // parseGenDocBlocks throws away all other content other
-// than what is inside //+gendoc tags
+// than what is inside +gendoc tags in any of the supported comment styles
 // parses any annotation and creates GenDocBlock
 // for later analysis
 func (p *Parser) parseGenDocBlocks() *GenDocBlock {
 	genDocToken := p.curToken
-	stmt := &GenDocBlock{Token: genDocToken}
+	leader := p.commentLeader()
+	stmt := &GenDocBlock{Token: genDocToken, Origin: p.config.ServiceId}
+	p.endDocGen = ""
+	if syntax, ok := p.l.Syntax(genDocToken.Type); ok {
+		stmt.Syntax = syntax.Name
+		_, p.endDocGen = syntax.TokenTypes()
+	}
 	// do some parsing here perhaps of the name and file name/location etc...
-	genDocMeta, err := gendoc.New(genDocToken.MetaAnnotation, p.log)
+	opts := []gendoc.Option{}
+	if p.config.Strict {
+		opts = append(opts, gendoc.WithStrict())
+	}
+	genDocMeta, err := gendoc.New(genDocToken.MetaAnnotation, p.log, opts...)
 	if err != nil {
-		p.errors = append(p.errors, wrapErr(genDocToken.Source.File, genDocToken.Line, genDocToken.Column, err))
+		line, column := annotationErrPosition(genDocToken, err)
+		p.errors = append(p.errors, wrapErr(genDocToken.Source, line, column, err))
+		// recover by skipping the content of the block
+		p.skipGenDocBlock(genDocToken)
 		return nil
 	}
 
@@ -158,15 +289,31 @@ func (p *Parser) parseGenDocBlocks() *GenDocBlock {
 	// stop on end of file
 	for !p.peekTokenIs(token.EOF) {
 
+		// a new block starts before this one ends
+		// stop here so that the new block is still parsed
+		if token.IsBeginDocGen(p.peekToken.Type) {
+			break
+		}
+
+		// an end marker of another comment syntax does not close the block
+		// report it and drop the block, e.g. `//+gendoc` closed by `#-gendoc`
+		if end, ok := p.mismatchedEndDocGen(); ok {
+			p.errors = append(p.errors, wrapErr(end.Source, end.Line, end.Column, fmt.Errorf("block begun in the %s syntax on line %d closed by %s: %w", stmt.Syntax, genDocToken.Line, end.Literal, ErrMismatchedEndTag)))
+			if end.Line != p.curToken.Line || end.Column != p.curToken.Column {
+				p.nextToken()
+			}
+			return nil
+		}
+
 		// for cases where the body is empty
-		if p.currentTokenIs(token.END_DOC_GEN) {
+		if p.currentTokenIsEndDocGen() {
 			stmt.EndToken = p.curToken
 			notFoundEnd = false
 			break
 		}
 
 		// if currToken is some sort of comment character and peekTokenIs endDocGen
-		if p.peekTokenIs(token.END_DOC_GEN) && (p.currentTokenIs(token.END_HTML_COMMENT) || p.currentTokenIs(token.BEGIN_HTML_COMMENT)) {
+		if p.peekTokenIsEndDocGen() && (p.currentTokenIs(token.END_HTML_COMMENT) || p.currentTokenIs(token.BEGIN_HTML_COMMENT)) {
 			notFoundEnd = false
 			p.nextToken()
 			stmt.EndToken = p.curToken
@@ -176,38 +323,56 @@ func (p *Parser) parseGenDocBlocks() *GenDocBlock {
 		// when next token is end doc
 		// we skip assigning to the literal
 		// we consume it and move on
-		if p.peekTokenIs(token.END_DOC_GEN) {
+		if p.peekTokenIsEndDocGen() {
 			notFoundEnd = false
 			p.nextToken()
 			stmt.EndToken = p.curToken
 			break
 		}
 
-		// TODO: add to built string if it isn't
-		// a comment character after line break
-		// for cases when CONTENT_DOC_GEN is inside comment blocks
-		// \n# or \n//
-		//
-		// BUG: the only way for now to have valid multiline annotation
-		// is if it's wrapped in langauge specific multiline comments
-		// e.g. /* ... */
 		contentVal += p.curToken.Literal
 		p.nextToken()
 	}
 
 	if notFoundEnd {
-		p.errors = append(p.errors, wrapErr(genDocToken.Source.File, genDocToken.Line, genDocToken.Column, ErrNoEndTagFound))
+		p.errors = append(p.errors, wrapErr(genDocToken.Source, genDocToken.Line, genDocToken.Column, ErrNoEndTagFound))
 		return nil
 	}
 
-	val, err := ExpandEnvVariables(contentVal, p.environ)
+	// content written as consecutive line comments
+	// is stripped of the comment characters
+	contentVal = stripCommentLeader(contentVal, leader)
+
+	if genDocMeta.Ref != "" {
+		// content of the referenced file is used as is
+		// e.g. `$ref` inside a JSON schema is not a variable
+		refSource, refVal, err := resolveRef(genDocToken.Source, genDocMeta.Ref)
+		if err != nil {
+			p.errors = append(p.errors, wrapErr(genDocToken.Source, genDocToken.Line, genDocToken.Column, err))
+			return nil
+		}
+		if strings.TrimSpace(contentVal) != "" {
+			p.log.Debugf("inline content in %s:%d is replaced by the referenced file: %s", genDocToken.Source.File, genDocToken.Line, refSource.Path)
+		}
+		stmt.Value = refVal
+		stmt.RefSource = &refSource
+	} else if genDocMeta.ShouldExpand() {
+		expand := ExpandEnvVariables
+		// payloads are full of `$schema` and `$ref` which are not variables
+		if genDocMeta.ContentType == gendoc.Example || genDocMeta.ContentType == gendoc.JSONSchema {
+			expand = ExpandEnvVariablesKeepingUnset
+		}
+		val, err := expand(contentVal, p.environ)
+
+		if err != nil {
+			p.errors = append(p.errors, wrapErr(genDocToken.Source, genDocToken.Line, genDocToken.Column, fmt.Errorf("%v - %w", err, ErrUnableToReplaceVarPlaceholder)))
+		}
 
-	if err != nil {
-		p.errors = append(p.errors, wrapErr(genDocToken.Source.File, genDocToken.Line, genDocToken.Column, fmt.Errorf("%v - %w", err, ErrUnableToReplaceVarPlaceholder)))
+		stmt.Value = val
+	} else {
+		stmt.Value = contentVal
 	}
 
-	stmt.Value = val
-
 	// NOTE: This will never faile unless categories are extended
 	// and the mapping is not extended - GenDoc tests will catch that!
 	nodeCat := nodeCatConverter[string(genDocMeta.CategoryType)]
@@ -215,7 +380,7 @@ func (p *Parser) parseGenDocBlocks() *GenDocBlock {
 	stmt.NodeCategory = nodeCat
 	ant, err := p.parseAnnotation(genDocMeta, nodeCat, stmt)
 	if err != nil {
-		p.errors = append(p.errors, wrapErr(genDocToken.Source.File, genDocToken.Line, genDocToken.Column, err))
+		p.errors = append(p.errors, wrapErr(genDocToken.Source, genDocToken.Line, genDocToken.Column, err))
 		return nil
 	}
 	stmt.Annotation = ant
@@ -225,6 +390,83 @@ func (p *Parser) parseGenDocBlocks() *GenDocBlock {
 	return stmt
 }
 
+// skipGenDocBlock advances to the end marker of the current block.
+//
+// It stops ahead of the next begin marker, or at the end of the file, when no end marker is found.
+func (p *Parser) skipGenDocBlock(begin token.Token) {
+	for !p.currentTokenIsEndDocGen() {
+		if token.IsBeginDocGen(p.peekToken.Type) || p.currentTokenIs(token.EOF) {
+			p.errors = append(p.errors, wrapErr(begin.Source, begin.Line, begin.Column, ErrNoEndTagFound))
+			return
+		}
+		p.nextToken()
+	}
+}
+
+// resolveRef loads the file referenced by the `ref=` attribute
+//
+// Relative paths are resolved against the directory of the annotated file.
+func resolveRef(src token.Source, ref string) (token.Source, string, error) {
+	path := ref
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(filepath.Dir(src.Path), ref)
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return token.Source{}, "", fmt.Errorf("ref '%s': %v - %w", ref, err, ErrRefUnreadable)
+	}
+	return token.Source{File: filepath.Base(path), Path: path}, string(b), nil
+}
+
+// commentLeader detects the line comment leader used on the begin marker line.
+//
+// When the begin marker is preceded by a line comment, e.g. `# //+gendoc`,
+// that comment is used. When it is preceded by a block comment opener, e.g. `<!-- //+gendoc`,
+// there is no leader to strip. Otherwise the leader is implied by the marker's comment syntax.
+func (p *Parser) commentLeader() string {
+	if p.lineStart.Line != p.curToken.Line || p.lineStart.Column != p.curToken.Column {
+		if p.l.IsLineComment(p.lineStart.Literal) {
+			return p.lineStart.Literal
+		}
+		if p.lineStart.Type == token.BEGIN_HTML_COMMENT || p.lineStart.Type == token.FORWARD_SLASH {
+			return ""
+		}
+	}
+	return p.l.CommentLeader(p.curToken.Type)
+}
+
+// stripCommentLeader removes the comment leader, plus one following space,
+// from each content line.
+//
+// Stripping only happens when every non empty line starts with the leader,
+// i.e. the content is written entirely as line comments. This leaves
+// code examples with their own inline comments untouched.
+//
+// The dangling last line, i.e. the one preceding the end marker
+// in `# //-gendoc`, is removed as well.
+func stripCommentLeader(content, leader string) string {
+	if leader == "" {
+		return content
+	}
+	lines := strings.Split(content, "\n")
+	if last := len(lines) - 1; last > 0 {
+		if dangling := strings.TrimSpace(lines[last]); dangling == "" || dangling == leader {
+			lines = lines[:last]
+		}
+	}
+	for _, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if trimmed != "" && !strings.HasPrefix(trimmed, leader) {
+			return content
+		}
+	}
+	for i, line := range lines {
+		trimmed := strings.TrimLeft(line, " \t")
+		lines[i] = strings.TrimPrefix(strings.TrimPrefix(trimmed, leader), " ")
+	}
+	return strings.Join(lines, "\n")
+}
+
 // parseAnnotation performs business logic tasks as part of parsing of annotations
 func (p *Parser) parseAnnotation(gd gendoc.GenDoc, cat NodeCategory, docBlock *GenDocBlock) (gendoc.GenDoc, error) {
 	a := attemptIdExtract(gd, docBlock)
@@ -249,11 +491,15 @@ func (p *Parser) parseAnnotation(gd gendoc.GenDoc, cat NodeCategory, docBlock *G
 		if a.Id == "" {
 			return a, fmt.Errorf("%s: %w", err, ErrIdRequired)
 		}
-		if a.Parent == "" && p.config.ServiceId == "" {
+		// explicitly listed services take precedence over the service being analysed
+		if len(a.Parent) == 0 && len(a.ServiceId) > 0 {
+			a.Parent = a.ServiceId
+		}
+		if len(a.Parent) == 0 && p.config.ServiceId == "" {
 			return a, fmt.Errorf("%s: %w", err, ErrParentIdRequired)
 		}
-		if a.Parent == "" && p.config.ServiceId != "" {
-			a.Parent = p.config.ServiceId
+		if len(a.Parent) == 0 && p.config.ServiceId != "" {
+			a.Parent = gendoc.IdList{p.config.ServiceId}
 		}
 		//Operation must specify a parent -> Channel
 	case OperationNode:
@@ -262,10 +508,10 @@ func (p *Parser) parseAnnotation(gd gendoc.GenDoc, cat NodeCategory, docBlock *G
 		if a.Id == "" {
 			return a, fmt.Errorf("%s: %w", err, ErrIdRequired)
 		}
-		if a.Parent == "" && a.ChannelId == "" {
+		if len(a.Parent) == 0 && len(a.ChannelId) == 0 {
 			return a, fmt.Errorf("%s: %w", err, ErrParentIdRequired)
 		}
-		if a.Parent == "" && a.ChannelId != "" {
+		if len(a.Parent) == 0 && len(a.ChannelId) > 0 {
 			a.Parent = a.ChannelId
 		}
 	case MessageNode:
@@ -275,9 +521,10 @@ func (p *Parser) parseAnnotation(gd gendoc.GenDoc, cat NodeCategory, docBlock *G
 			return a, fmt.Errorf("%s: %w", err, ErrIdRequired)
 		}
 
-		if a.Parent == "" {
+		// a message listing its channels belongs to the channel rather than an operation
+		if len(a.Parent) == 0 && len(a.ChannelId) == 0 {
 			// the id of a message and the parent (i.e. an operation must be the same)
-			a.Parent = a.Id
+			a.Parent = gendoc.IdList{a.Id}
 		}
 
 		if a.ContentType == "" {
@@ -338,17 +585,3 @@ func attemptIdExtract(a gendoc.GenDoc, docBlock *GenDocBlock) gendoc.GenDoc {
 	}
 	return a
 }
-
-// ExpandEnvVariables expands the env vars inside DocContent
-// to their environment var values.
-//
-// Failing when a variable is either not set or set but empty.
-func ExpandEnvVariables(input string, vars []string) (string, error) {
-	for _, v := range vars {
-		kv := strings.Split(v, "=")
-		key, value := kv[0], kv[1] // kv[1] will be an empty string = ""
-		os.Setenv(key, value)
-	}
-
-	return envsubst.StringRestrictedNoDigit(input, true, true, false)
-}
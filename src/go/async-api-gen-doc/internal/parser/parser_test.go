@@ -3,8 +3,12 @@ package parser_test
 import (
 	"errors"
 	"os"
+	"path/filepath"
+	"slices"
+	"strings"
 	"testing"
 
+	"github.com/dnitsch/async-api-generator/internal/diag"
 	"github.com/dnitsch/async-api-generator/internal/gendoc"
 	"github.com/dnitsch/async-api-generator/internal/lexer"
 	"github.com/dnitsch/async-api-generator/internal/parser"
@@ -42,7 +46,7 @@ ignore me
 
 	for name, tt := range ttests {
 		t.Run(name, func(t *testing.T) {
-			lexerSource.Input = tt.input
+			lexerSource.Input = strings.NewReader(tt.input)
 			l := lexer.New(lexerSource)
 			p := parser.New(l, &parser.Config{}).WithLogger(log.New(os.Stderr, log.ErrorLvl))
 			parsed, errs := p.InitialParse()
@@ -138,7 +142,7 @@ func Test_Parse_Id_and_type_of_nodes(t *testing.T) {
 	}
 	for name, tt := range ttests {
 		t.Run(name, func(t *testing.T) {
-			lexerSource.Input = tt.input
+			lexerSource.Input = strings.NewReader(tt.input)
 			l := lexer.New(lexerSource)
 			p := parser.New(l, tt.config).WithLogger(log.New(os.Stderr, log.ErrorLvl))
 			got, errs := p.InitialParse()
@@ -157,7 +161,7 @@ func Test_Parse_Id_and_type_of_nodes(t *testing.T) {
 			if got[0].Annotation.ServiceURN != tt.wantUrn {
 				t.Errorf("parser incorrectly converted node ServieURN\ngot: %v\nexpected %v\n", got[0].Annotation.ServiceURN, tt.wantUrn)
 			}
-			if got[0].Annotation.Parent != tt.wantParentId {
+			if got[0].Annotation.Parent.String() != tt.wantParentId {
 				t.Errorf("parser incorrectly converted node Parent\ngot: %v\nexpected %v\n", got[0].Annotation.Parent, tt.wantParentId)
 			}
 		})
@@ -219,10 +223,17 @@ this is some description
 			&parser.Config{},
 			parser.ErrContentTypeRequired,
 		},
+		"unknown key in strict mode": {`let x = 42;
+		//+gendoc category=message type=description id=foo prent=bar
+this is some description
+		//-gendoc`,
+			&parser.Config{Strict: true},
+			gendoc.ErrUnknownKey,
+		},
 	}
 	for name, tt := range ttests {
 		t.Run(name, func(t *testing.T) {
-			lexerSource.Input = tt.input
+			lexerSource.Input = strings.NewReader(tt.input)
 			l := lexer.New(lexerSource)
 			p := parser.New(l, tt.config).WithLogger(log.New(os.Stderr, log.ErrorLvl))
 			_, errs := p.InitialParse()
@@ -241,7 +252,7 @@ func Test_ShouldError_when_no_End_tag_found(t *testing.T) {
 	//+gendoc category=message type=nameId parent=id1 id=id
 	`
 
-	lexerSource.Input = input
+	lexerSource.Input = strings.NewReader(input)
 	l := lexer.New(lexerSource)
 	p := parser.New(l, &parser.Config{}).WithLogger(log.New(os.Stderr, log.ErrorLvl))
 	_, errs := p.InitialParse()
@@ -259,7 +270,7 @@ func Test_Error_on_unparseable_tag(t *testing.T) {
 	//-gendoc
 	`
 
-	lexerSource.Input = input
+	lexerSource.Input = strings.NewReader(input)
 	l := lexer.New(lexerSource)
 	p := parser.New(l, &parser.Config{}).WithLogger(log.New(os.Stderr, log.ErrorLvl))
 	_, errs := p.InitialParse()
@@ -271,6 +282,147 @@ func Test_Error_on_unparseable_tag(t *testing.T) {
 	}
 }
 
+func Test_Parse_GenDocBlocks_in_all_comment_styles(t *testing.T) {
+	ttests := map[string]struct {
+		input       string
+		wantLiteral string
+		wantValue   string
+	}{
+		"hash comments": {`foo: bar
+#+gendoc category=message type=description id=foo
+this is some description
+#-gendoc
+`, "#+gendoc", "this is some description"},
+		"double dash comments": {`select 1;
+--+gendoc category=message type=description id=foo
+this is some description
+---gendoc
+`, "--+gendoc", "this is some description"},
+		"block comments": {`let x = 42;
+/*+gendoc category=message type=description id=foo */
+this is some description
+/*-gendoc */
+`, "/*+gendoc", "this is some description"},
+		"html comments": {`# title
+<!--+gendoc category=message type=description id=foo -->
+this is some description
+<!---gendoc -->
+`, "<!--+gendoc", "this is some description"},
+	}
+	for name, tt := range ttests {
+		t.Run(name, func(t *testing.T) {
+			lexerSource.Input = strings.NewReader(tt.input)
+			l := lexer.New(lexerSource)
+			p := parser.New(l, &parser.Config{}).WithLogger(log.New(os.Stderr, log.ErrorLvl))
+			got, errs := p.InitialParse()
+			if len(errs) > 0 {
+				t.Fatalf("parser had errors, expected <nil>\nerror: %v", errs)
+			}
+			if len(got) != 1 {
+				t.Fatalf("expected 1 GenDocBlock to come back, got: %d", len(got))
+			}
+			if got[0].Token.Literal != tt.wantLiteral {
+				t.Errorf("begin token literal got: %s, wanted: %s", got[0].Token.Literal, tt.wantLiteral)
+			}
+			if got[0].Annotation.Id != "foo" {
+				t.Errorf("annotation id got: %s, wanted: foo", got[0].Annotation.Id)
+			}
+			if got[0].Value != tt.wantValue {
+				t.Errorf("value got: %q, wanted: %q", got[0].Value, tt.wantValue)
+			}
+		})
+	}
+}
+
+func Test_Parse_strips_line_comment_leaders_from_content(t *testing.T) {
+	ttests := map[string]struct {
+		input     string
+		wantValue string
+	}{
+		"double slash comments": {`let x = 42;
+	//+gendoc category=message type=description id=foo
+	// first paragraph
+	//
+	//	indented example
+	//-gendoc
+`, "first paragraph\n\n\tindented example"},
+		"hash comments": {`foo: bar
+#+gendoc category=message type=description id=foo
+# first paragraph
+#
+# second paragraph
+#-gendoc
+`, "first paragraph\n\nsecond paragraph"},
+		"double dash comments": {`select 1;
+--+gendoc category=message type=description id=foo
+-- first line
+-- second line
+---gendoc
+`, "first line\nsecond line"},
+		"leader taken from the comment preceding the marker": {`foo: bar
+# //+gendoc category=message type=description id=foo
+# first line
+#second line
+# //-gendoc
+`, "first line\nsecond line"},
+		"content not written as line comments is left untouched": {`let x = 42;
+//+gendoc category=message type=description id=foo
+public class Bar () {
+  // keep me
+}
+//-gendoc
+`, "public class Bar () {\n  // keep me\n}"},
+		"block comments are not stripped": {`let x = 42;
+<!-- //+gendoc category=message type=description id=foo -->
+// not a leader here
+<!-- //-gendoc -->
+`, "// not a leader here\n"},
+		"block comment markers are not stripped": {`let x = 42;
+/*+gendoc category=message type=description id=foo */
+# heading
+/*-gendoc */
+`, "# heading"},
+	}
+	for name, tt := range ttests {
+		t.Run(name, func(t *testing.T) {
+			lexerSource.Input = strings.NewReader(tt.input)
+			l := lexer.New(lexerSource)
+			p := parser.New(l, &parser.Config{}).WithLogger(log.New(os.Stderr, log.ErrorLvl))
+			got, errs := p.InitialParse()
+			if len(errs) > 0 {
+				t.Fatalf("parser had errors, expected <nil>\nerror: %v", errs)
+			}
+			if len(got) != 1 {
+				t.Fatalf("expected 1 GenDocBlock to come back, got: %d", len(got))
+			}
+			if got[0].Value != tt.wantValue {
+				t.Errorf("value got: %q, wanted: %q", got[0].Value, tt.wantValue)
+			}
+		})
+	}
+}
+
+func Test_Error_on_unparseable_tag_points_at_attribute(t *testing.T) {
+	input := `let x = 5;
+//+gendoc category=message id=foo title="not closed
+//-gendoc
+`
+	lexerSource.Input = strings.NewReader(input)
+	l := lexer.New(lexerSource)
+	p := parser.New(l, &parser.Config{}).WithLogger(log.New(os.Stderr, log.ErrorLvl))
+	_, errs := p.InitialParse()
+	if len(errs) != 1 {
+		t.Fatalf("unexpected number of errors\n got: %v, wanted: 1", errs)
+	}
+	if !errors.Is(errs[0], gendoc.ErrUnterminatedQuote) {
+		t.Errorf("unexpected error type\n got: %v, wanted: %v", errs[0], gendoc.ErrUnterminatedQuote)
+	}
+	// the opening quote of the title value
+	if want := "[bar:2:41]"; !strings.Contains(errs[0].Error(), want) {
+		t.Errorf("error position incorrect\n got: %v, wanted: %s", errs[0], want)
+	}
+}
+
 func testHelperGenDocBlock(t *testing.T, initialGenDocBlock parser.GenDocBlock, name string, content any) bool {
 	if initialGenDocBlock.Token.Literal != "//+gendoc" {
 		t.Errorf("got=%q, wanted initialGenDocBlock.TokenLiteral = '//+gendoc'.", initialGenDocBlock.Token.Literal)
@@ -311,6 +463,41 @@ func Test_ExpandEnvVariables_succeeds(t *testing.T) {
 			"some var is foo and docs go [here](foo.com/stuff)",
 			[]string{"var=foo", "DOC_LINK=https://somestuff.com"},
 		},
+		"with braces and adjacent text": {
+			"${var}bar",
+			"foobar",
+			[]string{"var=foo"},
+		},
+		"with default for unset var": {
+			"${unset:-fallback} and ${empty:-other}",
+			"fallback and other",
+			[]string{"empty="},
+		},
+		"with default ignored for set var": {
+			"${var:-fallback}",
+			"foo",
+			[]string{"var=foo"},
+		},
+		"with escaped dollar": {
+			`{"$$schema": "$$ref"}`,
+			`{"$schema": "$ref"}`,
+			[]string{},
+		},
+		"with digits and lone dollar left as is": {
+			"costs $5 or $ more",
+			"costs $5 or $ more",
+			[]string{},
+		},
+		"with equals in value": {
+			"$url",
+			"https://foo.bar?a=b",
+			[]string{"url=https://foo.bar?a=b"},
+		},
+		"with later entry overriding": {
+			"$var",
+			"baz",
+			[]string{"var=foo", "var=baz"},
+		},
 	}
 	for name, tt := range ttests {
 		t.Run(name, func(t *testing.T) {
@@ -341,6 +528,15 @@ func Test_ExpandEnvVariables_fails(t *testing.T) {
 				}
 			},
 			[]string{"v=foo"},
+		}, "with empty var": {
+			"some var is ${var}",
+			func() func() { return func() {} },
+			[]string{"var="},
+		},
+		"with unterminated brace": {
+			"some var is ${var",
+			func() func() { return func() {} },
+			[]string{"var=foo"},
 		},
 	}
 	for name, tt := range ttests {
@@ -355,6 +551,37 @@ func Test_ExpandEnvVariables_fails(t *testing.T) {
 	}
 }
 
+func Test_ExpandEnvVariablesKeepingUnset(t *testing.T) {
+	ttests := map[string]struct {
+		input   string
+		expect  string
+		wantErr error
+	}{
+		"unset var kept":        {`{"$ref": "$foo"}`, `{"$ref": "bar"}`, nil},
+		"unset braced var kept": {`{"id": "${ref}"}`, `{"id": "${ref}"}`, nil},
+		"default still used":    {`{"id": "${ref:-foo}"}`, `{"id": "foo"}`, nil},
+		"escape still replaced": {`{"$$schema": "$$ref"}`, `{"$schema": "$ref"}`, nil},
+		"empty var fails":       {`{"id": "$empty"}`, "", parser.ErrVariableEmpty},
+	}
+	for name, tt := range ttests {
+		t.Run(name, func(t *testing.T) {
+			got, err := parser.ExpandEnvVariablesKeepingUnset(tt.input, []string{"foo=bar", "empty="})
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("got: %v, wanted: %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.expect {
+				t.Errorf("got: %q, wanted: %q", got, tt.expect)
+			}
+		})
+	}
+}
+
 func Test_Parse_WithOwnEnviron_passed_in_succeeds(t *testing.T) {
 	ttests := map[string]struct {
 		input   string
@@ -373,7 +600,7 @@ this is some description with $foo
 	for name, tt := range ttests {
 		t.Run(name, func(t *testing.T) {
 			defer os.Clearenv()
-			lexerSource.Input = tt.input
+			lexerSource.Input = strings.NewReader(tt.input)
 			l := lexer.New(lexerSource)
 			p := parser.New(l, &parser.Config{}).WithLogger(log.New(os.Stderr, log.ErrorLvl)).WithEnvironment(tt.environ)
 			got, errs := p.InitialParse()
@@ -413,7 +640,7 @@ this is some description with $foo
 	for name, tt := range ttests {
 		t.Run(name, func(t *testing.T) {
 			defer os.Clearenv()
-			lexerSource.Input = tt.input
+			lexerSource.Input = strings.NewReader(tt.input)
 			l := lexer.New(lexerSource)
 			p := parser.New(l, &parser.Config{}).WithLogger(log.New(os.Stderr, log.ErrorLvl)).WithEnvironment(tt.environ)
 			_, errs := p.InitialParse()
@@ -428,3 +655,326 @@ this is some description with $foo
 		})
 	}
 }
+
+func Test_Parse_loads_value_from_ref(t *testing.T) {
+	dir := t.TempDir()
+	schema := `{"$id": "order.v2", "type": "object"}`
+	if err := os.MkdirAll(filepath.Join(dir, "schemas"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "schemas", "order.v2.json"), []byte(schema), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	ttests := map[string]struct {
+		ref string
+	}{
+		"relative to the annotated file": {"./schemas/order.v2.json"},
+		"absolute path":                  {filepath.Join(dir, "schemas", "order.v2.json")},
+	}
+	for name, tt := range ttests {
+		t.Run(name, func(t *testing.T) {
+			src := lexer.Source{FileName: "order.cs", FullPath: filepath.Join(dir, "order.cs"),
+				Input: strings.NewReader("//+gendoc category=message type=json_schema id=OrderCancelled ref=" + tt.ref + "\n// ignored inline content\n//-gendoc\n")}
+			p := parser.New(lexer.New(src), &parser.Config{}).WithLogger(log.New(os.Stderr, log.ErrorLvl))
+			got, errs := p.InitialParse()
+			if len(errs) > 0 {
+				t.Fatalf("parser had errors, expected <nil>\nerror: %v", errs)
+			}
+			if len(got) != 1 {
+				t.Fatalf("expected 1 GenDocBlock to come back")
+			}
+			if got[0].Value != schema {
+				t.Errorf("value got: %q, wanted: %q", got[0].Value, schema)
+			}
+			if got[0].RefSource == nil || got[0].RefSource.Path != filepath.Join(dir, "schemas", "order.v2.json") {
+				t.Errorf("ref source got: %v, wanted: %s", got[0].RefSource, filepath.Join(dir, "schemas", "order.v2.json"))
+			}
+		})
+	}
+}
+
+func Test_Error_on_missing_ref(t *testing.T) {
+	input := `//+gendoc category=message type=json_schema id=OrderCancelled ref=./does/not/exist.json
+//-gendoc
+`
+	lexerSource.Input = strings.NewReader(input)
+	l := lexer.New(lexerSource)
+	p := parser.New(l, &parser.Config{}).WithLogger(log.New(os.Stderr, log.ErrorLvl))
+	_, errs := p.InitialParse()
+	if len(errs) != 1 {
+		t.Fatalf("unexpected number of errors\n got: %v, wanted: 1", errs)
+	}
+	if !errors.Is(errs[0], parser.ErrRefUnreadable) {
+		t.Errorf("unexpected error type\n got: %v, wanted: %v", errs[0], parser.ErrRefUnreadable)
+	}
+}
+
+func Test_Parse_GenDocBlocks_with_configured_syntax(t *testing.T) {
+	conf := lexer.DefaultConfig()
+	conf.Keyword = "asyncapi"
+	conf.Syntaxes = append(conf.Syntaxes, lexer.CommentSyntax{Name: "semicolon", Line: ";"})
+	input := `;+asyncapi category=message type=description id=OrderCancelled
+; emitted once an order is cancelled
+;-asyncapi
+`
+	src := lexer.Source{Input: strings.NewReader(input), FileName: "order.dsl", FullPath: "/foo/order.dsl"}
+	p := parser.New(lexer.New(src).WithConfig(conf), &parser.Config{}).WithLogger(log.New(os.Stderr, log.ErrorLvl))
+	got, errs := p.InitialParse()
+	if len(errs) > 0 {
+		t.Fatalf("parser had errors, expected <nil>\nerror: %v", errs)
+	}
+	if len(got) != 1 {
+		t.Fatalf("expected 1 GenDocBlock to come back, got: %d", len(got))
+	}
+	if got[0].Value != "emitted once an order is cancelled" {
+		t.Errorf("value got: %q, wanted: %q", got[0].Value, "emitted once an order is cancelled")
+	}
+}
+
+func Test_ExpandEnvVariables_does_not_touch_process_environment(t *testing.T) {
+	t.Setenv("GENDOC_PROCESS_ONLY", "process")
+	if _, err := parser.ExpandEnvVariables("$GENDOC_PROCESS_ONLY", []string{"GENDOC_OTHER=foo"}); err == nil {
+		t.Error("wanted error as the variable is not in the passed in environ, got <nil>")
+	}
+	if _, ok := os.LookupEnv("GENDOC_OTHER"); ok {
+		t.Error("passed in environ leaked into the process environment")
+	}
+}
+
+func Test_Parse_expand_attribute(t *testing.T) {
+	ttests := map[string]struct {
+		input  string
+		expect string
+	}{
+		"examples are expanded by default": {
+			input: `//+gendoc category=message type=example id=foo
+{"id": "${foo}"}
+//-gendoc`,
+			expect: `{"id": "bar"}`,
+		},
+		"json schema expanded by default": {
+			input: `//+gendoc category=message type=json_schema id=foo
+{"const": "${foo}"}
+//-gendoc`,
+			expect: `{"const": "bar"}`,
+		},
+		"unset variables in an example are kept": {
+			input: `//+gendoc category=message type=example id=foo
+{"$schema": "http://json-schema.org/draft-07/schema#", "$ref": "#/definitions/${order}", "id": "$foo"}
+//-gendoc`,
+			expect: `{"$schema": "http://json-schema.org/draft-07/schema#", "$ref": "#/definitions/${order}", "id": "bar"}`,
+		},
+		"unset variables in a json schema are kept": {
+			input: `//+gendoc category=message type=json_schema id=foo
+{"$schema": "http://json-schema.org/draft-07/schema#", "properties": {"id": {"$ref": "#/$defs/id"}}}
+//-gendoc`,
+			expect: `{"$schema": "http://json-schema.org/draft-07/schema#", "properties": {"id": {"$ref": "#/$defs/id"}}}`,
+		},
+		"example opts out of expansion": {
+			input: `//+gendoc category=message type=example id=foo expand=false
+{"$schema": "$ref"}
+//-gendoc`,
+			expect: `{"$schema": "$ref"}`,
+		},
+		"expansion turned off": {
+			input: `//+gendoc category=message type=description id=foo expand=false
+costs $foo
+//-gendoc`,
+			expect: "costs $foo",
+		},
+		"expansion turned on for example": {
+			input: `//+gendoc category=message type=example id=foo expand=true
+{"id": "$foo"}
+//-gendoc`,
+			expect: `{"id": "bar"}`,
+		},
+	}
+	for name, tt := range ttests {
+		t.Run(name, func(t *testing.T) {
+			lexerSource.Input = strings.NewReader(tt.input)
+			l := lexer.New(lexerSource)
+			p := parser.New(l, &parser.Config{}).WithLogger(log.New(os.Stderr, log.ErrorLvl)).WithEnvironment([]string{"foo=bar"})
+			got, errs := p.InitialParse()
+			if len(errs) > 0 {
+				t.Fatal(errs)
+			}
+			if got[0].Value != tt.expect {
+				t.Errorf("got: %q, wanted: %q", got[0].Value, tt.expect)
+			}
+		})
+	}
+}
+
+func Test_LoadEnvFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), ".env")
+	content := `# comment
+FOO=bar
+
+export QUOTED="with spaces"
+SINGLE='single = quoted'
+EMPTY=
+`
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	got, err := parser.LoadEnvFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"FOO=bar", "QUOTED=with spaces", "SINGLE=single = quoted", "EMPTY="}
+	if strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Errorf("got: %v, wanted: %v", got, want)
+	}
+
+	if err := os.WriteFile(path, []byte("not an entry\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := parser.LoadEnvFile(path); !errors.Is(err, parser.ErrMalformedEnvEntry) {
+		t.Errorf("got: %v, wanted: %v", err, parser.ErrMalformedEnvEntry)
+	}
+}
+
+func Test_Parse_annotation_escapes_from_source(t *testing.T) {
+	ttests := map[string]struct {
+		input string
+		title string
+	}{
+		"escaped single quotes": {
+			input: "//+gendoc category=message type=description id=cancelled title='Order \\'cancelled\\' event'\ncontent\n//-gendoc\n",
+			title: "Order 'cancelled' event",
+		},
+		"escaped double quotes": {
+			input: "//+gendoc category=message type=description id=cancelled title=\"Order \\\"cancelled\\\" event\"\ncontent\n//-gendoc\n",
+			title: `Order "cancelled" event`,
+		},
+		"escapes on a continued line": {
+			input: "//+gendoc category=message type=description id=cancelled \\\n  title='Order \\'cancelled\\' event'\ncontent\n//-gendoc\n",
+			title: "Order 'cancelled' event",
+		},
+	}
+	for name, tt := range ttests {
+		t.Run(name, func(t *testing.T) {
+			lexerSource.Input = strings.NewReader(tt.input)
+			p := parser.New(lexer.New(lexerSource), &parser.Config{}).WithLogger(log.New(os.Stderr, log.ErrorLvl))
+			got, errs := p.InitialParse()
+			if len(errs) > 0 {
+				t.Fatalf("got: %v, wanted no errors", errs)
+			}
+			if len(got) != 1 || got[0].Annotation.Title != tt.title {
+				t.Errorf("title got: %v, wanted: %q", got, tt.title)
+			}
+		})
+	}
+}
+
+func Test_Parse_annotation_error_position(t *testing.T) {
+	ttests := map[string]struct {
+		input        string
+		line, column int
+	}{
+		// the value of category starts at the 38th character of the line, the 39th byte
+		"after a multi-byte character": {"//+gendoc title=\"Überblick\" category=bar id=first\ncontent\n//-gendoc\n", 1, 38},
+		"before a continued line":      {"//+gendoc category=bar \\\n  id=first type=description\ncontent\n//-gendoc\n", 1, 20},
+		"on a continued line":          {"//+gendoc id=first \\\n  category=bar type=description\ncontent\n//-gendoc\n", 2, 12},
+		"on the last continued line":   {"//+gendoc id=first \\\n  type=description \\\n\tcategory=bar\ncontent\n//-gendoc\n", 3, 11},
+	}
+	for name, tt := range ttests {
+		t.Run(name, func(t *testing.T) {
+			lexerSource.Input = strings.NewReader(tt.input)
+			p := parser.New(lexer.New(lexerSource), &parser.Config{}).WithLogger(log.New(os.Stderr, log.ErrorLvl))
+			_, errs := p.InitialParse()
+			d := &diag.Diagnostic{}
+			if len(errs) != 1 || !errors.As(errs[0], &d) {
+				t.Fatalf("expected a single diagnostic, got: %v", errs)
+			}
+			if d.Line != tt.line || d.Column != tt.column {
+				t.Errorf("position got: %d:%d, wanted: %d:%d", d.Line, d.Column, tt.line, tt.column)
+			}
+		})
+	}
+}
+
+func Test_Parse_mixed_comment_syntax_markers(t *testing.T) {
+	ttests := map[string]struct {
+		input   string
+		wantIds []string
+		// the position of the mismatched end marker, zero when the blocks are closed
+		line, column int
+	}{
+		"slash closed by hash": {
+			input:   "//+gendoc category=message type=description id=mixed\ncontent\n#-gendoc\n//+gendoc category=message type=description id=good\ngood\n//-gendoc\n",
+			wantIds: []string{"good"},
+			line:    3, column: 1,
+		},
+		"html closed by slash": {
+			input:   "<!--+gendoc category=message type=description id=mixed -->\ncontent\n  //-gendoc\n",
+			wantIds: []string{},
+			line:    3, column: 3,
+		},
+		"empty block closed by block": {
+			input:   "#+gendoc category=message type=description id=mixed\n/*-gendoc */\n",
+			wantIds: []string{},
+			line:    2, column: 1,
+		},
+		"each closed by its own": {
+			input:   "#+gendoc category=message type=description id=hash\n# content\n#-gendoc\n/*+gendoc category=message type=description id=block */\ncontent\n/*-gendoc */\n",
+			wantIds: []string{"hash", "block"},
+		},
+	}
+	for name, tt := range ttests {
+		t.Run(name, func(t *testing.T) {
+			lexerSource.Input = strings.NewReader(tt.input)
+			p := parser.New(lexer.New(lexerSource), &parser.Config{}).WithLogger(log.New(os.Stderr, log.ErrorLvl))
+			got, errs := p.InitialParse()
+			gotIds := []string{}
+			for _, block := range got {
+				gotIds = append(gotIds, block.Annotation.Id)
+			}
+			if !slices.Equal(gotIds, tt.wantIds) {
+				t.Errorf("blocks got: %v, wanted: %v", gotIds, tt.wantIds)
+			}
+			if tt.line == 0 {
+				if len(errs) > 0 {
+					t.Errorf("got: %v, wanted no errors", errs)
+				}
+				return
+			}
+			d := &diag.Diagnostic{}
+			if len(errs) != 1 || !errors.As(errs[0], &d) {
+				t.Fatalf("expected a single diagnostic, got: %v", errs)
+			}
+			if !errors.Is(d, parser.ErrMismatchedEndTag) || d.Code != "GD007" || d.Line != tt.line || d.Column != tt.column {
+				t.Errorf("unexpected diagnostic: %s", d)
+			}
+		})
+	}
+}
+
+func Test_Parse_recovers_after_bad_blocks(t *testing.T) {
+	input := `//+gendoc category=bar id=first
+skipped content
+//-gendoc
+//+gendoc category=message type=description id=unclosed
+never closed
+//+gendoc category=message type=description id=good
+good content
+//-gendoc
+`
+	lexerSource.Input = strings.NewReader(input)
+	p := parser.New(lexer.New(lexerSource), &parser.Config{}).WithLogger(log.New(os.Stderr, log.ErrorLvl))
+	got, errs := p.InitialParse()
+	if len(errs) != 2 {
+		t.Fatalf("unexpected number of errors\n got: %v, wanted: 2", errs)
+	}
+	if !errors.Is(errs[0], gendoc.ErrIncorrectCategory) || !errors.Is(errs[1], parser.ErrNoEndTagFound) {
+		t.Errorf("unexpected errors: %v", errs)
+	}
+	d := &diag.Diagnostic{}
+	if !errors.As(errs[1], &d) || d.Line != 4 || d.Code != "GD001" || d.Path != lexerSource.FullPath {
+		t.Errorf("unexpected diagnostic: %#v", d)
+	}
+	if len(got) != 1 || got[0].Annotation.Id != "good" {
+		t.Fatalf("expected the good block to be parsed, got: %v", got)
+	}
+}
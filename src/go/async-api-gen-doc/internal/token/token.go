@@ -30,9 +30,19 @@ const (
 	END_HTML_COMMENT     TokenType = "END_HTML_COMMENT"     // `-->`
 
 	// DOC_GEN Keywords
-	BEGIN_DOC_GEN TokenType = "BEGIN_DOC_GEN"
-	META_DOC_GEN  TokenType = "META_DOC_GEN"
-	END_DOC_GEN   TokenType = "END_DOC_GEN"
+	//
+	// each supported comment style gets its own begin/end pair
+	META_DOC_GEN              TokenType = "META_DOC_GEN"
+	BEGIN_DOC_GEN             TokenType = "BEGIN_DOC_GEN"             // `//+gendoc`
+	END_DOC_GEN               TokenType = "END_DOC_GEN"               // `//-gendoc`
+	BEGIN_DOC_GEN_HASH        TokenType = "BEGIN_DOC_GEN_HASH"        // `#+gendoc`
+	END_DOC_GEN_HASH          TokenType = "END_DOC_GEN_HASH"          // `#-gendoc`
+	BEGIN_DOC_GEN_DOUBLE_DASH TokenType = "BEGIN_DOC_GEN_DOUBLE_DASH" // `--+gendoc`
+	END_DOC_GEN_DOUBLE_DASH   TokenType = "END_DOC_GEN_DOUBLE_DASH"   // `---gendoc`
+	BEGIN_DOC_GEN_BLOCK       TokenType = "BEGIN_DOC_GEN_BLOCK"       // `/*+gendoc ... */`
+	END_DOC_GEN_BLOCK         TokenType = "END_DOC_GEN_BLOCK"         // `/*-gendoc */`
+	BEGIN_DOC_GEN_HTML        TokenType = "BEGIN_DOC_GEN_HTML"        // `<!--+gendoc ... -->`
+	END_DOC_GEN_HTML          TokenType = "END_DOC_GEN_HTML"          // `<!---gendoc -->`
 
 	// Parsed "expressions"
 	GEN_DOC_CONTENT TokenType = "GEN_DOC_CONTENT"
@@ -53,10 +63,20 @@ type Source struct {
 type Token struct {
 	Type           TokenType `json:"type"`
 	Literal        string    `json:"literal"`
-	MetaAnnotation string    `json:"annotationLiteral"` //parser.GenDocMetaAnnotation additional info about the captured token
+	MetaAnnotation string    `json:"annotationLiteral"`          //parser.GenDocMetaAnnotation additional info about the captured token
+	MetaColumn     int       `json:"annotationColumn,omitempty"` // column at which the MetaAnnotation starts
 	Line           int       `json:"line"`
 	Column         int       `json:"column"`
 	Source         Source    `json:"source"`
+	// MetaLines are the lines the MetaAnnotation continues on after a trailing `\`
+	MetaLines []MetaLine `json:"annotationLines,omitempty"`
+}
+
+// MetaLine is the position in the source at which a continued line of the MetaAnnotation starts
+type MetaLine struct {
+	Offset int `json:"offset"` // offset in runes into the MetaAnnotation
+	Line   int `json:"line"`
+	Column int `json:"column"`
 }
 
 var keywords = map[string]TokenType{
@@ -74,6 +94,23 @@ func LookupIdent(ident string) TokenType {
 	return TEXT
 }
 
+// DocGenMarkers returns the begin and end marker types for a named comment syntax,
+// e.g. `hash` returns BEGIN_DOC_GEN_HASH and END_DOC_GEN_HASH
+func DocGenMarkers(syntax string) (begin, end TokenType) {
+	suffix := "_" + strings.ToUpper(strings.NewReplacer("-", "_", " ", "_").Replace(syntax))
+	return BEGIN_DOC_GEN + TokenType(suffix), END_DOC_GEN + TokenType(suffix)
+}
+
+// IsBeginDocGen reports whether the type is a begin marker in any of the comment styles
+func IsBeginDocGen(typ TokenType) bool {
+	return strings.HasPrefix(string(typ), string(BEGIN_DOC_GEN))
+}
+
+// IsEndDocGen reports whether the type is an end marker in any of the comment styles
+func IsEndDocGen(typ TokenType) bool {
+	return strings.HasPrefix(string(typ), string(END_DOC_GEN))
+}
+
 var typeMapper = map[string]TokenType{
 	"MESSAGE":   MESSAGE,
 	"OPERATION": OPERATION,